@@ -0,0 +1,73 @@
+package main
+
+import (
+	"agenda-api/internal/models"
+	"agenda-api/internal/recurrence"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// listEvents prints published and cancelled events, recurring occurrences
+// included, that start within the next days
+func (a *app) listEvents(args []string) error {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	days := flags.Int("days", 7, "how many days ahead to look")
+	flags.Parse(args)
+
+	start := time.Now()
+	end := start.AddDate(0, 0, *days)
+
+	events, err := a.events.GetForExport(start, end)
+	if err != nil {
+		return err
+	}
+
+	var seriesIDs []uuid.UUID
+	for _, event := range events {
+		if event.RecurrenceRule != nil {
+			seriesIDs = append(seriesIDs, event.ID)
+		}
+	}
+	exceptions, err := a.events.GetExceptions(seriesIDs)
+	if err != nil {
+		return err
+	}
+	exceptionsByEvent := make(map[uuid.UUID][]models.EventException)
+	for _, exception := range exceptions {
+		exceptionsByEvent[exception.EventID] = append(exceptionsByEvent[exception.EventID], exception)
+	}
+
+	var upcoming []models.Event
+	for _, event := range events {
+		if event.RecurrenceRule == nil {
+			upcoming = append(upcoming, event)
+			continue
+		}
+		occurrences, err := recurrence.Expand(event, exceptionsByEvent[event.ID], start, end)
+		if err != nil {
+			return fmt.Errorf("expand event %s: %w", event.ID, err)
+		}
+		upcoming = append(upcoming, occurrences...)
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].StartsAt.Before(upcoming[j].StartsAt)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTS\tENDS\tTITLE\tTYPE\tSTATUS\tID")
+	for _, event := range upcoming {
+		zone := event.Zone()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			event.StartsAt.In(zone).Format("2006-01-02 15:04 MST"),
+			event.EndsAt.In(zone).Format("2006-01-02 15:04 MST"),
+			event.Title, event.Type, event.Status, event.ID,
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,121 @@
+// Command agenda operates an agenda deployment from the shell: bootstrapping
+// admins, resetting passwords, managing team members, inspecting upcoming
+// events, moving data between databases and running migrations. It reads the
+// same environment as the server.
+package main
+
+import (
+	"agenda-api/internal/config"
+	"agenda-api/internal/database"
+	"agenda-api/internal/migrate"
+	"agenda-api/internal/repository"
+	"agenda-api/migrations"
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+
+	// Event and user time zones must resolve even without a system zoneinfo
+	_ "time/tzdata"
+)
+
+const usage = `usage: agenda <command> [arguments]
+
+commands:
+  create-admin    -email EMAIL [-name NAME] [-timezone ZONE] [-password-stdin]
+  reset-password  -email EMAIL [-password-stdin]
+  team add        -team ID -email EMAIL [-role owner|manager|member]
+  team remove     -team ID -email EMAIL
+  events          [-days N]
+  export          [-o FILE] [-include-secrets]
+  import          FILE
+  migrate         up | down [N] | redo | status | baseline VERSION`
+
+type app struct {
+	cfg    *config.Config
+	db     *sqlx.DB
+	runner *migrate.Runner
+	users  *repository.UserRepository
+	tokens *repository.TokenRepository
+	teams  *repository.TeamRepository
+	events *repository.EventRepository
+	dump   *repository.DumpRepository
+}
+
+var commands = map[string]func(a *app, args []string) error{
+	"create-admin":   (*app).createAdmin,
+	"reset-password": (*app).resetPassword,
+	"team":           (*app).team,
+	"events":         (*app).listEvents,
+	"export":         (*app).exportData,
+	"import":         (*app).importData,
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("agenda: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	command, ok := commands[name]
+	if !ok && name != "migrate" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := database.NewPostgresDB(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	runner, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if name == "migrate" {
+		err = migrate.Command(context.Background(), runner, args, os.Stdout)
+	} else {
+		a := &app{
+			cfg:    cfg,
+			db:     db,
+			runner: runner,
+			users:  repository.NewUserRepository(db),
+			tokens: repository.NewTokenRepository(db),
+			teams:  repository.NewTeamRepository(db),
+			events: repository.NewEventRepository(db),
+			dump:   repository.NewDumpRepository(db),
+		}
+		err = a.requireSchema()
+		if err == nil {
+			err = command(a, args)
+		}
+	}
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+}
+
+// requireSchema refuses to touch data through a schema the binary does not match
+func (a *app) requireSchema() error {
+	pending, err := a.runner.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is %d migration(s) behind; run `agenda migrate up` first", len(pending))
+	}
+	return nil
+}
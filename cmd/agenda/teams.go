@@ -0,0 +1,100 @@
+package main
+
+import (
+	"agenda-api/internal/models"
+	"agenda-api/internal/repository"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (a *app) team(args []string) error {
+	if len(args) == 0 || (args[0] != "add" && args[0] != "remove") {
+		return errors.New("team: expected add or remove")
+	}
+
+	flags := flag.NewFlagSet("team "+args[0], flag.ExitOnError)
+	teamID := flags.String("team", "", "team ID")
+	email := flags.String("email", "", "email address of the user")
+	role := flags.String("role", string(models.TeamRoleMember), "team role: owner, manager or member")
+	flags.Parse(args[1:])
+
+	id, err := uuid.Parse(*teamID)
+	if err != nil {
+		return errors.New("team: -team must be a team ID")
+	}
+	team, err := a.teams.GetByID(id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no team with ID %s", id)
+	}
+	if err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("team: -email is required")
+	}
+	user, err := a.findUser(*email)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "add" {
+		return a.addMember(team, user, models.TeamRole(*role))
+	}
+	return a.removeMember(team, user)
+}
+
+func (a *app) addMember(team *models.Team, user *models.User, role models.TeamRole) error {
+	switch role {
+	case models.TeamRoleOwner, models.TeamRoleManager, models.TeamRoleMember:
+	default:
+		return fmt.Errorf("team add: invalid role %q", role)
+	}
+
+	isMember, err := a.teams.IsMember(team.ID, user.ID)
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return fmt.Errorf("%s is already a member of %s", user.Email, team.Name)
+	}
+
+	member := &models.TeamMember{
+		ID:        uuid.New(),
+		TeamID:    team.ID,
+		UserID:    user.ID,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+	if err := a.teams.AddMember(member); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %s to %s as %s\n", user.Email, team.Name, role)
+	return nil
+}
+
+func (a *app) removeMember(team *models.Team, user *models.User) error {
+	_, err := a.teams.GetMemberRole(team.ID, user.ID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s is not a member of %s", user.Email, team.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Same rule as the API: a team keeps at least one owner
+	if err := a.teams.RemoveMember(team.ID, user.ID); err != nil {
+		if errors.Is(err, repository.ErrLastOwner) {
+			return fmt.Errorf("%s is the last owner of %s; add another owner first", user.Email, team.Name)
+		}
+		return err
+	}
+
+	fmt.Printf("Removed %s from %s\n", user.Email, team.Name)
+	return nil
+}
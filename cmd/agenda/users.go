@@ -0,0 +1,174 @@
+package main
+
+import (
+	"agenda-api/internal/models"
+	"bufio"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength matches the API's validation of new passwords
+const minPasswordLength = 6
+
+func (a *app) createAdmin(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the admin")
+	name := flags.String("name", "", "display name (defaults to the email's local part)")
+	timeZone := flags.String("timezone", "UTC", "IANA time zone of the admin")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+	flags.Parse(args)
+
+	if *email == "" {
+		return errors.New("create-admin: -email is required")
+	}
+
+	// An existing account is promoted rather than duplicated
+	existing, err := a.users.GetByEmail(*email)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if existing != nil {
+		if existing.Role == models.RoleAdmin {
+			fmt.Printf("%s is already an admin\n", existing.Email)
+			return nil
+		}
+		if err := a.users.UpdateRole(existing.ID, models.RoleAdmin); err != nil {
+			return err
+		}
+		fmt.Printf("Promoted %s to admin\n", existing.Email)
+		return nil
+	}
+
+	loc, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		return fmt.Errorf("create-admin: invalid time zone %q", *timeZone)
+	}
+	if *name == "" {
+		*name, _, _ = strings.Cut(*email, "@")
+	}
+
+	password, generated, err := newPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user := &models.User{
+		ID:        uuid.New(),
+		Email:     *email,
+		Password:  string(hashedPassword),
+		Name:      *name,
+		Role:      models.RoleAdmin,
+		TimeZone:  loc.String(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := a.users.Create(user); err != nil {
+		return err
+	}
+
+	// The operator vouches for the address
+	if err := a.users.MarkEmailVerified(user.ID); err != nil {
+		return err
+	}
+	if generated {
+		if err := a.users.SetPasswordResetRequired(user.ID, true); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Created admin %s (%s)\n", user.Email, user.ID)
+	printPassword(password, generated)
+	return nil
+}
+
+// resetPassword sets a new password and signs the user out everywhere
+func (a *app) resetPassword(args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the user")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+	flags.Parse(args)
+
+	if *email == "" {
+		return errors.New("reset-password: -email is required")
+	}
+
+	user, err := a.findUser(*email)
+	if err != nil {
+		return err
+	}
+
+	password, generated, err := newPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := a.users.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+	if generated {
+		if err := a.users.SetPasswordResetRequired(user.ID, true); err != nil {
+			return err
+		}
+	}
+	if err := a.tokens.RevokeAllForUser(user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Reset the password of %s and signed them out everywhere\n", user.Email)
+	printPassword(password, generated)
+	return nil
+}
+
+func (a *app) findUser(email string) (*models.User, error) {
+	user, err := a.users.GetByEmail(email)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no user with email %s", email)
+	}
+	return user, err
+}
+
+// newPassword reads a password from the first line of stdin, or generates a
+// one-time password that has to be changed at the next login
+func newPassword(fromStdin bool) (string, bool, error) {
+	if !fromStdin {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, errors.New("no password on stdin")
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < minPasswordLength {
+		return "", false, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return password, false, nil
+}
+
+func printPassword(password string, generated bool) {
+	if generated {
+		fmt.Printf("One-time password: %s\n(it must be changed at the next login)\n", password)
+	}
+}
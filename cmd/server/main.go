@@ -3,8 +3,26 @@ package main
 import (
 	"agenda-api/internal/config"
 	"agenda-api/internal/database"
+	"agenda-api/internal/handlers"
+	"agenda-api/internal/keyset"
+	"agenda-api/internal/mailer"
+	"agenda-api/internal/metrics"
+	"agenda-api/internal/migrate"
 	"agenda-api/internal/router"
+	"agenda-api/internal/tracing"
+	"agenda-api/migrations"
+	"context"
+	"errors"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	// Event and user time zones must resolve even without a system zoneinfo
+	_ "time/tzdata"
 )
 
 func main() {
@@ -13,6 +31,15 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	shutdownTracing, err := tracing.Setup(tracing.Options{
+		Endpoint:    cfg.OTLPEndpoint,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	db, err := database.NewPostgresDB(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -20,11 +47,136 @@ func main() {
 	defer db.Close()
 
 	log.Println("Connected to database successfully")
+	metrics.RegisterDB(db.DB)
+
+	runner, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(context.Background(), runner, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		applied, err := runner.Up(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %03d_%s", m.Version, m.Name)
+		}
+	} else {
+		pending, err := runner.Pending(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to check migrations: %v", err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("Database schema is %d migration(s) behind; run `migrate up` or set AUTO_MIGRATE=true", len(pending))
+		}
+	}
+
+	mail, err := mailer.New(
+		cfg.MailDriver, cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom, cfg.MailFile,
+	)
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	keys, err := keyset.New(keyset.Options{
+		Algorithm: cfg.JWTAlgorithm,
+		Secret:    cfg.JWTSecret,
+		Dir:       cfg.JWTKeysDir,
+		Rotation:  time.Duration(cfg.JWTKeyRotationHours) * time.Hour,
+		Retention: time.Duration(cfg.JWTExpirationMinutes) * time.Minute,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// SIGINT or SIGTERM stops accepting connections and drains in-flight requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go keys.Run(ctx)
 
-	r := router.Setup(db, cfg)
+	health := handlers.NewHealthHandler(db, runner)
+	srv := &http.Server{
+		Handler:      router.Setup(db, cfg, mail, keys, health),
+		ReadTimeout:  time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", ":"+cfg.Port)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
 
 	log.Printf("Server starting on port %s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := serve(ctx, srv, ln, shutdown{
+		drain:   health.Drain,
+		delay:   time.Duration(cfg.ShutdownDelaySeconds) * time.Second,
+		timeout: time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second,
+	}); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+
+	// Export the spans of the drained requests
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// shutdown is how serve stops once its context is cancelled
+type shutdown struct {
+	// drain is called first, to fail readiness probes
+	drain func()
+	// delay keeps serving new requests after drain
+	delay time.Duration
+	// timeout bounds how long in-flight requests may take to complete
+	timeout time.Duration
+}
+
+// serve runs srv on ln until ctx is cancelled, then shuts it down gracefully:
+// it drains, waits out the delay and gives in-flight requests up to the
+// timeout to complete
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, stop shutdown) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down, draining in-flight requests")
+	if stop.drain != nil {
+		stop.drain()
+	}
+	if stop.delay > 0 {
+		select {
+		case err := <-errc:
+			return err
+		case <-time.After(stop.delay):
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), stop.timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"agenda-api/internal/handlers"
+	"agenda-api/internal/migrate"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startServe runs serve with handler on a free port and returns its base URL
+// and the channel serve's result arrives on
+func startServe(t *testing.T, ctx context.Context, handler http.Handler, stop shutdown) (string, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &http.Server{Handler: handler}, ln, stop)
+	}()
+	return "http://" + ln.Addr().String(), done
+}
+
+func get(url string) (int, string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+func TestServeFinishesInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url, done := startServe(t, ctx, handler, shutdown{timeout: 5 * time.Second})
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		status, body, err := get(url)
+		responses <- result{status, body, err}
+	}()
+	<-started
+
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-responses
+	if res.err != nil || res.status != http.StatusOK || res.body != "done" {
+		t.Errorf("in-flight request = %d %q, %v; want 200 \"done\"", res.status, res.body, res.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve = %v, want nil", err)
+	}
+
+	if _, _, err := get(url); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
+
+func TestServeGivesUpAfterTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := startServe(t, ctx, handler, shutdown{timeout: 50 * time.Millisecond})
+	go get(url)
+	<-started
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("serve = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+type upDatabase struct{}
+
+func (upDatabase) PingContext(context.Context) error { return nil }
+
+func (upDatabase) Pending(context.Context) ([]migrate.Migration, error) { return nil, nil }
+
+func TestServeFailsReadinessWhileDraining(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	health := handlers.NewHealthHandler(upDatabase{}, upDatabase{})
+	r := gin.New()
+	r.GET("/readyz", health.Ready)
+	r.GET("/healthz", health.Live)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := startServe(t, ctx, r, shutdown{
+		drain:   health.Drain,
+		delay:   500 * time.Millisecond,
+		timeout: time.Second,
+	})
+
+	if status, _, err := get(url + "/readyz"); err != nil || status != http.StatusOK {
+		t.Fatalf("readyz before stop = %d, %v; want 200", status, err)
+	}
+
+	cancel()
+	// During the delay readiness fails but requests are still served
+	deadline := time.Now().Add(250 * time.Millisecond)
+	status, _, err := get(url + "/readyz")
+	for err == nil && status == http.StatusOK && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		status, _, err = get(url + "/readyz")
+	}
+	if err != nil || status != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining = %d, %v; want 503", status, err)
+	}
+	if status, _, err := get(url + "/healthz"); err != nil || status != http.StatusOK {
+		t.Errorf("healthz while draining = %d, %v; want 200", status, err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("serve = %v, want nil", err)
+	}
+}
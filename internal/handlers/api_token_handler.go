@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"agenda-api/internal/repository"
+	"agenda-api/internal/token"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type APITokenHandler struct {
+	apiTokenRepo *repository.APITokenRepository
+	authz        *policy.Policy
+}
+
+func NewAPITokenHandler(apiTokenRepo *repository.APITokenRepository, authz *policy.Policy) *APITokenHandler {
+	return &APITokenHandler{apiTokenRepo: apiTokenRepo, authz: authz}
+}
+
+func (h *APITokenHandler) Create(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.CreateAPITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes := pq.StringArray{}
+	for _, scope := range input.Scopes {
+		if !scope.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + string(scope)})
+			return
+		}
+		scopes = append(scopes, string(scope))
+	}
+
+	secret, _, err := token.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API token"})
+		return
+	}
+	plain := models.APITokenPrefix + secret
+
+	now := time.Now()
+	apiToken := &models.APIToken{
+		ID:        uuid.New(),
+		UserID:    middleware.GetUserID(c),
+		Name:      input.Name,
+		TokenHash: token.Hash(plain),
+		Prefix:    plain[:len(models.APITokenPrefix)+6],
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if input.ExpiresInDays != nil {
+		expiresAt := now.AddDate(0, 0, *input.ExpiresInDays)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := h.apiTokenRepo.With(ctx).Create(apiToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	// The token is only shown once; only its hash is stored
+	c.JSON(http.StatusCreated, gin.H{
+		"apiToken": apiToken,
+		"token":    plain,
+	})
+}
+
+func (h *APITokenHandler) GetMyTokens(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	apiTokens, err := h.apiTokenRepo.With(ctx).GetActiveByUserID(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API tokens"})
+		return
+	}
+
+	if apiTokens == nil {
+		apiTokens = []models.APIToken{}
+	}
+
+	c.JSON(http.StatusOK, apiTokens)
+}
+
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API token ID"})
+		return
+	}
+
+	apiToken, err := h.apiTokenRepo.With(ctx).GetByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API token"})
+		return
+	}
+
+	if !authorize(c, h.authz, policy.Delete, policy.Personal(apiToken.UserID), "API token not found") {
+		return
+	}
+	if apiToken.RevokedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+		return
+	}
+
+	if err := h.apiTokenRepo.With(ctx).Revoke(apiToken.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked successfully"})
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"agenda-api/internal/metrics"
 	"agenda-api/internal/middleware"
 	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"agenda-api/internal/recurrence"
 	"agenda-api/internal/repository"
 	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -14,13 +18,16 @@ import (
 type AssignmentHandler struct {
 	assignmentRepo *repository.AssignmentRepository
 	eventRepo      *repository.EventRepository
+	authz          *policy.Policy
 }
 
-func NewAssignmentHandler(assignmentRepo *repository.AssignmentRepository, eventRepo *repository.EventRepository) *AssignmentHandler {
-	return &AssignmentHandler{assignmentRepo: assignmentRepo, eventRepo: eventRepo}
+func NewAssignmentHandler(assignmentRepo *repository.AssignmentRepository, eventRepo *repository.EventRepository, authz *policy.Policy) *AssignmentHandler {
+	return &AssignmentHandler{assignmentRepo: assignmentRepo, eventRepo: eventRepo, authz: authz}
 }
 
 func (h *AssignmentHandler) GetMyAssignments(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := middleware.GetUserID(c)
 
 	var status *models.AssignmentStatus
@@ -29,7 +36,7 @@ func (h *AssignmentHandler) GetMyAssignments(c *gin.Context) {
 		status = &st
 	}
 
-	assignments, err := h.assignmentRepo.GetByUserID(userID, status)
+	assignments, err := h.assignmentRepo.With(ctx).GetByUserID(userID, status)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
 		return
@@ -43,18 +50,39 @@ func (h *AssignmentHandler) GetMyAssignments(c *gin.Context) {
 }
 
 func (h *AssignmentHandler) GetByEventID(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	eventID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	assignments, err := h.assignmentRepo.GetByEventID(eventID)
+	event, err := h.eventRepo.With(ctx).GetByID(eventID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return
+	}
+
+	assignments, err := h.assignmentRepo.With(ctx).GetByEventID(eventID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
 		return
 	}
 
+	// Assignees see who else is assigned to the event
+	assignees := make([]uuid.UUID, len(assignments))
+	for i, assignment := range assignments {
+		assignees[i] = assignment.UserID
+	}
+	if !authorize(c, h.authz, policy.ViewAssignments, policy.Event(event).WithParticipants(assignees), "You can only view assignments for your events") {
+		return
+	}
+
 	if assignments == nil {
 		assignments = []models.EventAssignmentWithDetails{}
 	}
@@ -63,6 +91,8 @@ func (h *AssignmentHandler) GetByEventID(c *gin.Context) {
 }
 
 func (h *AssignmentHandler) Respond(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	eventID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
@@ -72,7 +102,7 @@ func (h *AssignmentHandler) Respond(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
 	// Get the assignment
-	assignment, err := h.assignmentRepo.GetByEventAndUser(eventID, userID)
+	assignment, err := h.assignmentRepo.With(ctx).GetByEventAndUser(eventID, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
@@ -82,31 +112,124 @@ func (h *AssignmentHandler) Respond(c *gin.Context) {
 		return
 	}
 
+	var input models.RespondAssignmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Recurring events can be answered one occurrence at a time
+	if input.OccurrenceDate != nil {
+		h.respondToOccurrence(c, assignment, &input)
+		return
+	}
+
 	// Check if already responded
 	if assignment.Status != models.AssignmentStatusPending {
 		c.JSON(http.StatusConflict, gin.H{"error": "Assignment already responded"})
 		return
 	}
 
-	var input models.RespondAssignmentInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	if input.Status == models.AssignmentStatusApproved {
+		event, err := h.eventRepo.With(ctx).GetByID(eventID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+			return
+		}
+		conflicts, ok := checkConflicts(c, h.eventRepo.With(ctx), *event, []uuid.UUID{userID})
+		if !ok {
+			return
+		}
+		assignment.Conflicts = conflicts
 	}
 
-	if err := h.assignmentRepo.UpdateStatus(assignment.ID, input.Status); err != nil {
+	if err := h.assignmentRepo.With(ctx).UpdateStatus(assignment.ID, input.Status); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
 		return
 	}
+	metrics.AssignmentResponses.WithLabelValues(string(input.Status)).Inc()
 
 	assignment.Status = input.Status
 	c.JSON(http.StatusOK, assignment)
 }
 
+func (h *AssignmentHandler) respondToOccurrence(c *gin.Context, assignment *models.EventAssignment, input *models.RespondAssignmentInput) {
+	ctx := c.Request.Context()
+
+	event, err := h.eventRepo.With(ctx).GetByID(assignment.EventID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return
+	}
+
+	occurrenceDate, ok := requireOccurrence(c, event, *input.OccurrenceDate)
+	if !ok {
+		return
+	}
+
+	var conflicts []models.Conflict
+	if input.Status == models.AssignmentStatusApproved {
+		exception, err := h.eventRepo.With(ctx).GetException(event.ID, *occurrenceDate)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch occurrence"})
+			return
+		}
+		var ok bool
+		conflicts, ok = checkConflicts(c, h.eventRepo.With(ctx), recurrence.Apply(*event, *occurrenceDate, exception), []uuid.UUID{assignment.UserID})
+		if !ok {
+			return
+		}
+	}
+
+	occurrence, err := h.assignmentRepo.With(ctx).GetByEventUserAndOccurrence(event.ID, assignment.UserID, *occurrenceDate)
+	if err == sql.ErrNoRows {
+		now := time.Now()
+		occurrence = &models.EventAssignment{
+			ID:             uuid.New(),
+			EventID:        event.ID,
+			UserID:         assignment.UserID,
+			Status:         input.Status,
+			Role:           assignment.Role,
+			AssignedAt:     now,
+			RespondedAt:    &now,
+			OccurrenceDate: occurrenceDate,
+			Conflicts:      conflicts,
+		}
+		if err := h.assignmentRepo.With(ctx).Create(occurrence); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
+			return
+		}
+		metrics.AssignmentResponses.WithLabelValues(string(input.Status)).Inc()
+		c.JSON(http.StatusOK, occurrence)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignment"})
+		return
+	}
+
+	if occurrence.Status != models.AssignmentStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Assignment already responded"})
+		return
+	}
+
+	if err := h.assignmentRepo.With(ctx).UpdateStatus(occurrence.ID, input.Status); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
+		return
+	}
+	metrics.AssignmentResponses.WithLabelValues(string(input.Status)).Inc()
+
+	occurrence.Status = input.Status
+	occurrence.Conflicts = conflicts
+	c.JSON(http.StatusOK, occurrence)
+}
+
 func (h *AssignmentHandler) GetPendingCount(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := middleware.GetUserID(c)
 
-	count, err := h.assignmentRepo.GetPendingCountByUserID(userID)
+	count, err := h.assignmentRepo.With(ctx).GetPendingCountByUserID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending count"})
 		return
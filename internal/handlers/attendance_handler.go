@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"agenda-api/internal/metrics"
 	"agenda-api/internal/middleware"
 	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
 	"agenda-api/internal/repository"
 	"database/sql"
 	"net/http"
@@ -15,16 +17,20 @@ import (
 type AttendanceHandler struct {
 	attendanceRepo *repository.AttendanceRepository
 	eventRepo      *repository.EventRepository
+	authz          *policy.Policy
 }
 
-func NewAttendanceHandler(attendanceRepo *repository.AttendanceRepository, eventRepo *repository.EventRepository) *AttendanceHandler {
+func NewAttendanceHandler(attendanceRepo *repository.AttendanceRepository, eventRepo *repository.EventRepository, authz *policy.Policy) *AttendanceHandler {
 	return &AttendanceHandler{
 		attendanceRepo: attendanceRepo,
 		eventRepo:      eventRepo,
+		authz:          authz,
 	}
 }
 
 func (h *AttendanceHandler) Register(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	eventID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
@@ -33,7 +39,7 @@ func (h *AttendanceHandler) Register(c *gin.Context) {
 
 	userID := middleware.GetUserID(c)
 
-	event, err := h.eventRepo.GetByID(eventID)
+	event, err := h.eventRepo.With(ctx).GetByID(eventID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
@@ -48,50 +54,78 @@ func (h *AttendanceHandler) Register(c *gin.Context) {
 		return
 	}
 
-	existing, err := h.attendanceRepo.GetByEventAndUser(eventID, userID)
-	if err == nil && existing.Status == models.AttendanceStatusRegistered {
-		c.JSON(http.StatusConflict, gin.H{"error": "Already registered for this event"})
+	occurrenceDate, ok := requireOccurrence(c, event, c.Query("occurrence"))
+	if !ok {
 		return
 	}
 
-	count, err := h.attendanceRepo.CountByEventID(eventID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check capacity"})
-		return
+	if occurrenceDate != nil {
+		exception, err := h.eventRepo.With(ctx).GetException(eventID, *occurrenceDate)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch occurrence"})
+			return
+		}
+		if exception != nil && exception.Cancelled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot register for a cancelled occurrence"})
+			return
+		}
 	}
 
-	if event.Capacity != nil && count >= *event.Capacity {
-		c.JSON(http.StatusConflict, gin.H{"error": "Event is at full capacity"})
-		return
+	// Registrations beyond capacity join the end of the waitlist
+	attendance := &models.Attendance{
+		ID:             uuid.New(),
+		EventID:        eventID,
+		UserID:         userID,
+		CreatedAt:      time.Now(),
+		OccurrenceDate: occurrenceDate,
 	}
 
-	if existing != nil && existing.Status == models.AttendanceStatusCancelled {
-		if err := h.attendanceRepo.UpdateStatus(existing.ID, models.AttendanceStatusRegistered); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update registration"})
-			return
+	created, err := h.attendanceRepo.With(ctx).Register(attendance)
+	if err != nil {
+		switch err {
+		case repository.ErrAlreadyRegistered:
+			c.JSON(http.StatusConflict, gin.H{"error": "Already registered for this event"})
+		case repository.ErrAlreadyWaitlisted:
+			c.JSON(http.StatusConflict, gin.H{"error": "Already on the waitlist for this event"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register for event"})
 		}
-		existing.Status = models.AttendanceStatusRegistered
-		c.JSON(http.StatusOK, existing)
 		return
 	}
-
-	attendance := &models.Attendance{
-		ID:        uuid.New(),
-		EventID:   eventID,
-		UserID:    userID,
-		Status:    models.AttendanceStatusRegistered,
-		CreatedAt: time.Now(),
+	metrics.Registrations.WithLabelValues(string(attendance.Status)).Inc()
+	if attendance.Status == models.AttendanceStatusWaitlisted {
+		metrics.CapacityRejections.Inc()
+	}
+	if !h.setWaitlistPosition(c, attendance) {
+		return
 	}
 
-	if err := h.attendanceRepo.Create(attendance); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register for event"})
+	if created {
+		c.JSON(http.StatusCreated, attendance)
 		return
 	}
+	c.JSON(http.StatusOK, attendance)
+}
+
+func (h *AttendanceHandler) setWaitlistPosition(c *gin.Context, attendance *models.Attendance) bool {
+	ctx := c.Request.Context()
 
-	c.JSON(http.StatusCreated, attendance)
+	if attendance.Status != models.AttendanceStatusWaitlisted {
+		return true
+	}
+
+	position, err := h.attendanceRepo.With(ctx).GetWaitlistPosition(attendance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch waitlist position"})
+		return false
+	}
+	attendance.Position = &position
+	return true
 }
 
 func (h *AttendanceHandler) Cancel(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	eventID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
@@ -100,7 +134,22 @@ func (h *AttendanceHandler) Cancel(c *gin.Context) {
 
 	userID := middleware.GetUserID(c)
 
-	attendance, err := h.attendanceRepo.GetByEventAndUser(eventID, userID)
+	event, err := h.eventRepo.With(ctx).GetByID(eventID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return
+	}
+
+	occurrenceDate, ok := requireOccurrence(c, event, c.Query("occurrence"))
+	if !ok {
+		return
+	}
+
+	attendance, err := h.attendanceRepo.With(ctx).GetByEventAndUser(eventID, userID, occurrenceDate)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
@@ -110,22 +159,41 @@ func (h *AttendanceHandler) Cancel(c *gin.Context) {
 		return
 	}
 
-	if err := h.attendanceRepo.UpdateStatus(attendance.ID, models.AttendanceStatusCancelled); err != nil {
+	if attendance.Status == models.AttendanceStatusCancelled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+		return
+	}
+
+	// A freed place goes to the first person on the waitlist
+	status, _, err := h.attendanceRepo.With(ctx).Cancel(attendance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Registration not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
 		return
 	}
+	metrics.RegistrationCancellations.WithLabelValues(string(status)).Inc()
+
+	if status == models.AttendanceStatusWaitlisted {
+		c.JSON(http.StatusOK, gin.H{"message": "Removed from the waitlist"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Registration cancelled successfully"})
 }
 
 func (h *AttendanceHandler) GetAttendees(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	eventID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	event, err := h.eventRepo.GetByID(eventID)
+	event, err := h.eventRepo.With(ctx).GetByID(eventID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
@@ -135,16 +203,16 @@ func (h *AttendanceHandler) GetAttendees(c *gin.Context) {
 		return
 	}
 
-	userID := middleware.GetUserID(c)
-	userRole := middleware.GetUserRole(c)
+	if !authorize(c, h.authz, policy.ViewAttendees, policy.Event(event), "You can only view attendees for your events") {
+		return
+	}
 
-	// Admins can see any attendees, users can only see attendees for their own events
-	if userRole != models.RoleAdmin && event.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view attendees for your events"})
+	occurrenceDate, ok := requireOccurrence(c, event, c.Query("occurrence"))
+	if !ok {
 		return
 	}
 
-	attendees, err := h.attendanceRepo.GetByEventID(eventID)
+	attendees, err := h.attendanceRepo.With(ctx).GetByEventID(eventID, occurrenceDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendees"})
 		return
@@ -153,10 +221,53 @@ func (h *AttendanceHandler) GetAttendees(c *gin.Context) {
 	c.JSON(http.StatusOK, attendees)
 }
 
+// GetWaitlist lists the waitlisted registrations of an event in promotion order
+func (h *AttendanceHandler) GetWaitlist(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	eventID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := h.eventRepo.With(ctx).GetByID(eventID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return
+	}
+
+	if !authorize(c, h.authz, policy.ViewAttendees, policy.Event(event), "You can only view the waitlist for your events") {
+		return
+	}
+
+	occurrenceDate, ok := requireOccurrence(c, event, c.Query("occurrence"))
+	if !ok {
+		return
+	}
+
+	waitlist, err := h.attendanceRepo.With(ctx).GetWaitlist(eventID, occurrenceDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch waitlist"})
+		return
+	}
+	if waitlist == nil {
+		waitlist = []models.AttendanceWithUser{}
+	}
+
+	c.JSON(http.StatusOK, waitlist)
+}
+
 func (h *AttendanceHandler) GetMyRegistrations(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := middleware.GetUserID(c)
 
-	registrations, err := h.attendanceRepo.GetByUserID(userID)
+	registrations, err := h.attendanceRepo.With(ctx).GetByUserID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch registrations"})
 		return
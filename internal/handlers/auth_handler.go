@@ -1,11 +1,20 @@
 package handlers
 
 import (
+	"agenda-api/internal/keyset"
+	"agenda-api/internal/lockout"
+	"agenda-api/internal/mailer"
 	"agenda-api/internal/middleware"
 	"agenda-api/internal/models"
 	"agenda-api/internal/repository"
+	"agenda-api/internal/token"
+	"context"
 	"database/sql"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,28 +23,55 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	mfaChallengeTTL      = 5 * time.Minute
+)
+
+type AuthConfig struct {
+	// Keys access tokens are signed with
+	Keys            *keyset.Set
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Verifying this address makes its account admin while none exists
+	BootstrapAdminEmail string
+	// Base URL of the frontend, used for links in emails
+	AppURL string
+	// Admins without two-factor authentication only get user rights
+	RequireAdminMFA bool
+}
+
 type AuthHandler struct {
-	userRepo           *repository.UserRepository
-	jwtSecret          string
-	jwtExpirationHours int
+	userRepo  *repository.UserRepository
+	tokenRepo *repository.TokenRepository
+	mfaRepo   *repository.MFARepository
+	guard     *lockout.Guard
+	mailer    mailer.Mailer
+	config    AuthConfig
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository, jwtSecret string, jwtExpirationHours int) *AuthHandler {
+func NewAuthHandler(userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, mfaRepo *repository.MFARepository, guard *lockout.Guard, mailer mailer.Mailer, config AuthConfig) *AuthHandler {
 	return &AuthHandler{
-		userRepo:           userRepo,
-		jwtSecret:          jwtSecret,
-		jwtExpirationHours: jwtExpirationHours,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		mfaRepo:   mfaRepo,
+		guard:     guard,
+		mailer:    mailer,
+		config:    config,
 	}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var input models.CreateUserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	exists, err := h.userRepo.ExistsByEmail(input.Email)
+	exists, err := h.userRepo.With(ctx).ExistsByEmail(input.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
 		return
@@ -51,9 +87,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	role := input.Role
-	if role == "" {
-		role = models.RoleUser
+	timeZone := "UTC"
+	if input.TimeZone != "" {
+		loc, err := time.LoadLocation(input.TimeZone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+			return
+		}
+		timeZone = loc.String()
 	}
 
 	user := &models.User{
@@ -61,38 +102,84 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Email:     input.Email,
 		Password:  string(hashedPassword),
 		Name:      input.Name,
-		Role:      role,
+		Role:      models.RoleUser,
+		TimeZone:  timeZone,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if err := h.userRepo.Create(user); err != nil {
+	if err := h.userRepo.With(ctx).Create(user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	token, err := h.generateToken(user)
+	// Registration succeeds even if the email cannot be sent; it can be resent
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
+	h.issueTokens(c, http.StatusCreated, user, uuid.New())
+}
+
+// grantBootstrapAdmin makes the configured bootstrap address admin once it is
+// verified, and only while there is no active admin yet. Roles cannot be
+// chosen at sign-up, so every account starts as a user.
+func (h *AuthHandler) grantBootstrapAdmin(ctx context.Context, user *models.User) error {
+	if h.config.BootstrapAdminEmail == "" || !strings.EqualFold(user.Email, h.config.BootstrapAdminEmail) {
+		return nil
+	}
+	if user.EmailVerifiedAt == nil || user.Role == models.RoleAdmin {
+		return nil
+	}
+
+	promoted, err := h.userRepo.With(ctx).PromoteFirstAdmin(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
+		return err
+	}
+	if promoted {
+		user.Role = models.RoleAdmin
 	}
+	return nil
+}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"user":  user.ToResponse(),
-		"token": token,
-	})
+// emailVerified records that the user proved their address
+func (h *AuthHandler) emailVerified(ctx context.Context, userID uuid.UUID) error {
+	if err := h.userRepo.With(ctx).MarkEmailVerified(userID); err != nil {
+		return err
+	}
+
+	user, err := h.userRepo.With(ctx).GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return h.grantBootstrapAdmin(ctx, user)
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var input models.LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	user, err := h.userRepo.GetByEmail(input.Email)
+	ip := c.ClientIP()
+	wait, err := h.guard.Check(input.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Try again later"})
+		return
+	}
+
+	user, err := h.userRepo.With(ctx).GetByEmail(input.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			h.loginFailed(input.Email, ip)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
@@ -101,26 +188,304 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		h.loginFailed(input.Email, ip)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	token, err := h.generateToken(user)
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	// With two-factor authentication the password only earns a challenge; a
+	// forced password change and the lockout reset wait until the second
+	// factor is verified too
+	if user.TOTPEnabledAt != nil {
+		h.startChallenge(c, user)
+		return
+	}
+
+	h.loginSucceeded(input.Email)
+	h.finishLogin(c, user, input.NewPassword)
+}
+
+// startChallenge answers a successful first factor with a challenge to be
+// completed through VerifyMFA
+func (h *AuthHandler) startChallenge(c *gin.Context, user *models.User) {
+	ctx := c.Request.Context()
+
+	plain, hash, err := token.Generate()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+	challenge := &models.MFAChallenge{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := h.mfaRepo.With(ctx).CreateChallenge(challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user":  user.ToResponse(),
-		"token": token,
+		"mfaRequired":           true,
+		"challenge":             plain,
+		"expiresIn":             int(mfaChallengeTTL.Seconds()),
+		"passwordResetRequired": user.PasswordResetRequired,
 	})
 }
 
+// VerifyMFA completes a login challenge with a TOTP or recovery code
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.VerifyMFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := h.mfaRepo.With(ctx).AttemptChallenge(token.Hash(input.Challenge))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify challenge"})
+		return
+	}
+
+	user, err := h.userRepo.With(ctx).GetByID(challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	if user.PasswordResetRequired && input.NewPassword == "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                 "Password reset required. Send a newPassword with the code",
+			"passwordResetRequired": true,
+		})
+		return
+	}
+
+	ok, err := verifySecondFactor(h.mfaRepo.With(ctx), user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		h.loginFailed(user.Email, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	completed, err := h.mfaRepo.With(ctx).CompleteChallenge(challenge.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify challenge"})
+		return
+	}
+	if !completed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	h.loginSucceeded(user.Email)
+	h.finishLogin(c, user, input.NewPassword)
+}
+
+// loginFailed counts a failed attempt towards lockout. A failure to record it
+// does not change the response.
+func (h *AuthHandler) loginFailed(email, ip string) {
+	if err := h.guard.Fail(email, ip); err != nil {
+		log.Printf("Failed to record login attempt for %s: %v", email, err)
+	}
+}
+
+// loginSucceeded clears the account's failed attempts once every factor is
+// verified. A failure to clear them does not change the response.
+func (h *AuthHandler) loginSucceeded(email string) {
+	if err := h.guard.Succeed(email); err != nil {
+		log.Printf("Failed to reset login attempts for %s: %v", email, err)
+	}
+}
+
+// finishLogin applies a password change forced by an admin, then starts a session
+func (h *AuthHandler) finishLogin(c *gin.Context, user *models.User, newPassword string) {
+	ctx := c.Request.Context()
+
+	if user.PasswordResetRequired {
+		if newPassword == "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                 "Password reset required. Log in again with a newPassword",
+				"passwordResetRequired": true,
+			})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(newPassword)) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current one"})
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		if err := h.userRepo.With(ctx).UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+			return
+		}
+		user.PasswordResetRequired = false
+	}
+
+	h.issueTokens(c, http.StatusOK, user, uuid.New())
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Every refresh token can be used once; presenting one again means it
+// leaked, so its whole family is revoked.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, err := h.tokenRepo.With(ctx).GetRefreshTokenByHash(token.Hash(input.RefreshToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refresh token"})
+		return
+	}
+
+	if current.RevokedAt != nil {
+		h.rejectReuse(c, current)
+		return
+	}
+	if time.Now().After(current.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+		return
+	}
+
+	user, err := h.userRepo.With(ctx).GetByID(current.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user"})
+		return
+	}
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	accessToken, err := h.generateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	plain, next, err := h.newRefreshToken(user.ID, current.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	rotated, err := h.tokenRepo.With(ctx).RotateRefreshToken(current, next)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate refresh token"})
+		return
+	}
+	if !rotated {
+		// Lost a race against another refresh with the same token
+		h.rejectReuse(c, current)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.session(user, accessToken, plain))
+}
+
+func (h *AuthHandler) rejectReuse(c *gin.Context, refreshToken *models.RefreshToken) {
+	ctx := c.Request.Context()
+
+	if err := h.tokenRepo.With(ctx).RevokeFamily(refreshToken.FamilyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh tokens"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+}
+
+// Logout revokes the access token of the request and the given refresh token,
+// or every token of the user when all is set
+func (h *AuthHandler) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+	claims := middleware.GetClaims(c)
+
+	var input models.LogoutInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if input.All {
+		if err := h.tokenRepo.With(ctx).RevokeAllForUser(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+		return
+	}
+
+	jti, _ := uuid.Parse(claims.ID)
+	if err := h.tokenRepo.With(ctx).RevokeAccessToken(jti, userID, claims.ExpiresAt.Time); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	if input.RefreshToken != "" {
+		refreshToken, err := h.tokenRepo.With(ctx).GetRefreshTokenByHash(token.Hash(input.RefreshToken))
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refresh token"})
+			return
+		}
+		if refreshToken != nil && refreshToken.UserID == userID {
+			if err := h.tokenRepo.With(ctx).RevokeFamily(refreshToken.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh token"})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
 func (h *AuthHandler) Me(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := middleware.GetUserID(c)
 
-	user, err := h.userRepo.GetByID(userID)
+	user, err := h.userRepo.With(ctx).GetByID(userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -129,17 +494,285 @@ func (h *AuthHandler) Me(c *gin.Context) {
 	c.JSON(http.StatusOK, user.ToResponse())
 }
 
+// UpdateMe lets users change their name and preferred time zone
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+
+	var input models.UpdateProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.With(ctx).GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if input.Name != nil {
+		if *input.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+			return
+		}
+		user.Name = *input.Name
+	}
+	if input.TimeZone != nil {
+		loc, err := time.LoadLocation(*input.TimeZone)
+		if err != nil || *input.TimeZone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+			return
+		}
+		user.TimeZone = loc.String()
+	}
+
+	if err := h.userRepo.With(ctx).UpdateProfile(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether
+// or not the address belongs to an account.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.With(ctx).GetByEmail(input.Email)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user"})
+		return
+	}
+
+	if user != nil && user.DeactivatedAt == nil {
+		plain, err := h.createUserToken(ctx, user.ID, models.UserTokenPasswordReset, passwordResetTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+			return
+		}
+
+		body := "Hello " + user.Name + ",\n\n" +
+			"Someone asked to reset the password of your account. If it was you, open the link below within an hour:\n\n" +
+			h.config.AppURL + "/reset-password?token=" + plain + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n"
+		if err := h.mailer.Send(user.Email, "Reset your password", body); err != nil {
+			log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with a reset token and signs the user out
+// of every session
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userToken, err := h.tokenRepo.With(ctx).ConsumeUserToken(token.Hash(input.Token), models.UserTokenPasswordReset)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := h.userRepo.With(ctx).UpdatePassword(userToken.UserID, string(hashedPassword)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if err := h.tokenRepo.With(ctx).RevokeAllForUser(userToken.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	// The reset link reached the inbox, which proves the address as well
+	if err := h.emailVerified(ctx, userToken.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.VerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userToken, err := h.tokenRepo.With(ctx).ConsumeUserToken(token.Hash(input.Token), models.UserTokenEmailVerification)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		return
+	}
+
+	if err := h.emailVerified(ctx, userToken.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, err := h.userRepo.With(ctx).GetByID(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	plain, err := h.createUserToken(ctx, user.ID, models.UserTokenEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	body := "Hello " + user.Name + ",\n\n" +
+		"Please confirm your email address by opening the link below:\n\n" +
+		h.config.AppURL + "/verify-email?token=" + plain + "\n"
+	return h.mailer.Send(user.Email, "Confirm your email address", body)
+}
+
+func (h *AuthHandler) createUserToken(ctx context.Context, userID uuid.UUID, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	plain, hash, err := token.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	userToken := &models.UserToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+	if err := h.tokenRepo.With(ctx).CreateUserToken(userToken); err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// issueTokens starts a session: an access token plus the first refresh token
+// of a new family
+func (h *AuthHandler) issueTokens(c *gin.Context, status int, user *models.User, familyID uuid.UUID) {
+	ctx := c.Request.Context()
+
+	accessToken, err := h.generateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	plain, refreshToken, err := h.newRefreshToken(user.ID, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if err := h.tokenRepo.With(ctx).CreateRefreshToken(refreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store refresh token"})
+		return
+	}
+
+	c.JSON(status, h.session(user, accessToken, plain))
+}
+
+func (h *AuthHandler) session(user *models.User, accessToken, refreshToken string) gin.H {
+	session := gin.H{
+		"user":         user.ToResponse(),
+		"token":        accessToken,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(h.config.AccessTokenTTL.Seconds()),
+	}
+	if h.restrictedAdmin(user) {
+		session["mfaEnrollmentRequired"] = true
+	}
+	return session
+}
+
+// restrictedAdmin reports whether an admin has to enable two-factor
+// authentication before their tokens carry the admin role
+func (h *AuthHandler) restrictedAdmin(user *models.User) bool {
+	return h.config.RequireAdminMFA && user.Role == models.RoleAdmin && user.TOTPEnabledAt == nil
+}
+
+func (h *AuthHandler) newRefreshToken(userID, familyID uuid.UUID) (string, *models.RefreshToken, error) {
+	plain, hash, err := token.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plain, &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.config.RefreshTokenTTL),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
 func (h *AuthHandler) generateToken(user *models.User) (string, error) {
+	role := user.Role
+	if h.restrictedAdmin(user) {
+		role = models.RoleUser
+	}
+
+	now := time.Now()
 	claims := &middleware.Claims{
 		UserID: user.ID,
 		Email:  user.Email,
-		Role:   user.Role,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(h.jwtExpirationHours) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(h.config.AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(h.jwtSecret))
+	return h.config.Keys.Sign(claims)
 }
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/policy"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorize asks the policy whether the current user may perform the action
+// and answers the request when they may not. Personal resources are reported
+// missing with the given message, teams as not found, anything else forbidden.
+func authorize(c *gin.Context, authz *policy.Policy, action policy.Action, resource policy.Resource, message string) bool {
+	switch err := authz.Authorize(middleware.GetSubject(c), action, resource); err {
+	case nil:
+		return true
+	case policy.ErrNotFound:
+		if resource.Kind == policy.KindTeam {
+			message = "Team not found"
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": message})
+	case policy.ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": message})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+	}
+	return false
+}
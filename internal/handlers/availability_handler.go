@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"agenda-api/internal/repository"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var outOfOfficeLabels = map[models.OutOfOfficeKind]string{
+	models.OutOfOfficeVacation:  "vacation",
+	models.OutOfOfficeSickLeave: "sick leave",
+	models.OutOfOfficeOther:     "other",
+}
+
+type AvailabilityHandler struct {
+	availabilityRepo *repository.AvailabilityRepository
+	userRepo         *repository.UserRepository
+	authz            *policy.Policy
+}
+
+func NewAvailabilityHandler(availabilityRepo *repository.AvailabilityRepository, userRepo *repository.UserRepository, authz *policy.Policy) *AvailabilityHandler {
+	return &AvailabilityHandler{availabilityRepo: availabilityRepo, userRepo: userRepo, authz: authz}
+}
+
+func (h *AvailabilityHandler) GetMyWorkingHours(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+
+	hours, err := h.availabilityRepo.With(ctx).GetWorkingHours(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch working hours"})
+		return
+	}
+
+	if hours == nil {
+		hours = []models.WorkingHours{}
+	}
+
+	c.JSON(http.StatusOK, hours)
+}
+
+// SetMyWorkingHours replaces the user's weekly working hours. Days left out are
+// days off; an empty list clears them.
+func (h *AvailabilityHandler) SetMyWorkingHours(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+
+	var input models.SetWorkingHoursInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hours := make([]models.WorkingHours, 0, len(input.Days))
+	seen := make(map[int]bool, len(input.Days))
+	for _, day := range input.Days {
+		if seen[day.Weekday] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each weekday can only be given once"})
+			return
+		}
+		seen[day.Weekday] = true
+
+		start, err := parseClockTime(day.StartTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid startTime format. Use HH:MM"})
+			return
+		}
+		end, err := parseClockTime(day.EndTime)
+		if err != nil || !end.After(start) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endTime. Use HH:MM after startTime"})
+			return
+		}
+
+		hours = append(hours, models.WorkingHours{
+			UserID:    userID,
+			Weekday:   day.Weekday,
+			StartTime: start.Format("15:04:05"),
+			EndTime:   end.Format("15:04:05"),
+		})
+	}
+
+	if err := h.availabilityRepo.With(ctx).ReplaceWorkingHours(userID, hours); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save working hours"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hours)
+}
+
+func (h *AvailabilityHandler) GetMyOutOfOffice(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+
+	blocks, err := h.availabilityRepo.With(ctx).GetOutOfOfficeByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch out-of-office blocks"})
+		return
+	}
+
+	if blocks == nil {
+		blocks = []models.OutOfOffice{}
+	}
+
+	c.JSON(http.StatusOK, blocks)
+}
+
+func (h *AvailabilityHandler) CreateOutOfOffice(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+
+	var input models.CreateOutOfOfficeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.With(ctx).GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	loc := user.Zone()
+
+	start, err := time.ParseInLocation("2006-01-02", input.StartDate, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid startDate format. Use YYYY-MM-DD"})
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", input.EndDate, loc)
+	if err != nil || end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endDate. Use YYYY-MM-DD, not before startDate"})
+		return
+	}
+
+	kind := input.Kind
+	if kind == "" {
+		kind = models.OutOfOfficeVacation
+	}
+
+	block := &models.OutOfOffice{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Kind:      kind,
+		Note:      input.Note,
+		StartsAt:  start,
+		EndsAt:    end.AddDate(0, 0, 1),
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.availabilityRepo.With(ctx).CreateOutOfOffice(block); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create out-of-office block"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, block)
+}
+
+func (h *AvailabilityHandler) DeleteOutOfOffice(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid out-of-office ID"})
+		return
+	}
+
+	block, err := h.availabilityRepo.With(ctx).GetOutOfOfficeByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Out-of-office block not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch out-of-office block"})
+		return
+	}
+
+	if !authorize(c, h.authz, policy.Delete, policy.Personal(block.UserID), "Out-of-office block not found") {
+		return
+	}
+
+	if err := h.availabilityRepo.With(ctx).DeleteOutOfOffice(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete out-of-office block"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Out-of-office block deleted successfully"})
+}
+
+// outOfOfficeDuring returns the block overlapping [start, end), if any
+func outOfOfficeDuring(blocks []models.OutOfOffice, start, end time.Time) *models.OutOfOffice {
+	for i := range blocks {
+		if blocks[i].StartsAt.Before(end) && start.Before(blocks[i].EndsAt) {
+			return &blocks[i]
+		}
+	}
+	return nil
+}
+
+func outOfOfficeReason(block *models.OutOfOffice) string {
+	return "Out of office (" + outOfOfficeLabels[block.Kind] + ")"
+}
+
+func groupOutOfOffice(blocks []models.OutOfOffice) map[uuid.UUID][]models.OutOfOffice {
+	grouped := make(map[uuid.UUID][]models.OutOfOffice)
+	for _, block := range blocks {
+		grouped[block.UserID] = append(grouped[block.UserID], block)
+	}
+	return grouped
+}
+
+func parseClockTime(value string) (time.Time, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return time.Parse("15:04:05", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/recurrence"
+	"agenda-api/internal/repository"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// conflictHorizon bounds how far ahead the occurrences of a series are checked
+const conflictHorizon = 365 * 24 * time.Hour
+
+// checkConflicts runs findConflicts for a request, as seen by the current
+// user. With ?strict=true any conflict is answered with 409; otherwise
+// conflicts are returned as warnings. The bool is false once a response was
+// written.
+func checkConflicts(c *gin.Context, eventRepo *repository.EventRepository, event models.Event, userIDs []uuid.UUID, exclude ...uuid.UUID) ([]models.Conflict, bool) {
+	conflicts, err := findConflicts(eventRepo, event, userIDs, middleware.GetUserID(c), exclude...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check scheduling conflicts"})
+		return nil, false
+	}
+
+	if len(conflicts) > 0 && c.Query("strict") == "true" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Scheduling conflict",
+			"conflicts": conflicts,
+		})
+		return nil, false
+	}
+
+	return conflicts, true
+}
+
+// findConflicts lists the bookings of userIDs that overlap event, or any of its
+// occurrences for a series. The event itself and exclude are ignored. Bookings
+// are only identified when viewer is the booked user or the event's creator.
+func findConflicts(eventRepo *repository.EventRepository, event models.Event, userIDs []uuid.UUID, viewer uuid.UUID, exclude ...uuid.UUID) ([]models.Conflict, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	slots, err := scheduleSlots(eventRepo, event)
+	if err != nil || len(slots) == 0 {
+		return nil, err
+	}
+
+	start, end := slots[0].StartsAt, slots[0].EndsAt
+	for _, slot := range slots[1:] {
+		if slot.StartsAt.Before(start) {
+			start = slot.StartsAt
+		}
+		if slot.EndsAt.After(end) {
+			end = slot.EndsAt
+		}
+	}
+
+	busy, err := busyByUser(eventRepo, userIDs, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[uuid.UUID]bool{event.ID: true}
+	for _, id := range exclude {
+		skip[id] = true
+	}
+
+	var conflicts []models.Conflict
+	checked := make(map[uuid.UUID]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if checked[userID] {
+			continue
+		}
+		checked[userID] = true
+
+		for _, booked := range busy[userID] {
+			if skip[booked.ID] {
+				continue
+			}
+			for _, slot := range slots {
+				if overlaps(booked, slot.StartsAt, slot.EndsAt) {
+					conflicts = append(conflicts, newConflict(userID, booked, viewer))
+					break
+				}
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+// busyByUser returns the bookings of userIDs that overlap [start, end), with
+// recurring series expanded into their occurrences
+func busyByUser(eventRepo *repository.EventRepository, userIDs []uuid.UUID, start, end time.Time) (map[uuid.UUID][]models.Event, error) {
+	rows, err := eventRepo.GetBusyByUserIDs(userIDs, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var seriesIDs []uuid.UUID
+	for _, row := range rows {
+		if row.RecurrenceRule != nil {
+			seriesIDs = append(seriesIDs, row.ID)
+		}
+	}
+	exceptionsByEvent := map[uuid.UUID][]models.EventException{}
+	if len(seriesIDs) > 0 {
+		exceptions, err := eventRepo.GetExceptions(seriesIDs)
+		if err != nil {
+			return nil, err
+		}
+		exceptionsByEvent = groupExceptions(exceptions)
+	}
+
+	busy := make(map[uuid.UUID][]models.Event)
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		events := []models.Event{row.Event}
+		if row.RecurrenceRule != nil {
+			if row.BusyOccurrenceDate != nil {
+				exception := findException(exceptionsByEvent[row.ID], *row.BusyOccurrenceDate)
+				if exception != nil && exception.Cancelled {
+					continue
+				}
+				events = []models.Event{recurrence.Apply(row.Event, *row.BusyOccurrenceDate, exception)}
+			} else {
+				// Start a day early so occurrences running into the window are kept
+				events, err = recurrence.Expand(row.Event, exceptionsByEvent[row.ID], start.AddDate(0, 0, -1), end)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, event := range events {
+			if !overlaps(event, start, end) {
+				continue
+			}
+			key := row.BusyUserID.String() + "/" + event.ID.String()
+			if event.OccurrenceDate != nil {
+				key = row.BusyUserID.String() + "/" + occurrenceKey(event.ID, *event.OccurrenceDate)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			busy[row.BusyUserID] = append(busy[row.BusyUserID], event)
+		}
+	}
+
+	return busy, nil
+}
+
+// scheduleSlots returns the times taken up by event: the event itself, or the
+// occurrences of a series within conflictHorizon
+func scheduleSlots(eventRepo *repository.EventRepository, event models.Event) ([]models.Event, error) {
+	if event.RecurrenceRule == nil || event.OccurrenceDate != nil {
+		return []models.Event{event}, nil
+	}
+
+	exceptions, err := eventRepo.GetExceptions([]uuid.UUID{event.ID})
+	if err != nil {
+		return nil, err
+	}
+	return recurrence.Expand(event, exceptions, event.StartsAt, event.StartsAt.Add(conflictHorizon))
+}
+
+// bookedUsers returns who is booked on an event: the creator of a personal
+// event and its approved participants
+func bookedUsers(event *models.Event, participants []uuid.UUID) []uuid.UUID {
+	var userIDs []uuid.UUID
+	if event.Type == models.EventTypePersonal {
+		userIDs = append(userIDs, event.CreatedBy)
+	}
+	return append(userIDs, participants...)
+}
+
+func participantIDs(participants []models.ParticipantInput) []uuid.UUID {
+	ids := make([]uuid.UUID, len(participants))
+	for i, p := range participants {
+		ids[i] = p.UserID
+	}
+	return ids
+}
+
+func findException(exceptions []models.EventException, date time.Time) *models.EventException {
+	for i := range exceptions {
+		if exceptions[i].OriginalDate.Equal(date) {
+			return &exceptions[i]
+		}
+	}
+	return nil
+}
+
+func overlaps(event models.Event, start, end time.Time) bool {
+	return event.StartsAt.Before(end) && start.Before(event.EndsAt)
+}
+
+func newConflict(userID uuid.UUID, event models.Event, viewer uuid.UUID) models.Conflict {
+	conflict := models.Conflict{
+		UserID:   userID,
+		Title:    models.ConflictBusyTitle,
+		StartsAt: event.StartsAt,
+		EndsAt:   event.EndsAt,
+	}
+	if viewer != uuid.Nil && (userID == viewer || event.CreatedBy == viewer) {
+		eventID := event.ID
+		conflict.EventID = &eventID
+		conflict.Title = event.Title
+	}
+	if event.OccurrenceDate != nil {
+		date := event.OccurrenceDate.Format("2006-01-02")
+		conflict.OccurrenceDate = &date
+	}
+	return conflict
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"agenda-api/internal/metrics"
 	"agenda-api/internal/middleware"
 	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"agenda-api/internal/recurrence"
 	"agenda-api/internal/repository"
+	"context"
 	"database/sql"
+	"errors"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,16 +19,32 @@ import (
 )
 
 type EventHandler struct {
-	eventRepo      *repository.EventRepository
-	teamRepo       *repository.TeamRepository
-	assignmentRepo *repository.AssignmentRepository
+	eventRepo            *repository.EventRepository
+	teamRepo             *repository.TeamRepository
+	assignmentRepo       *repository.AssignmentRepository
+	userRepo             *repository.UserRepository
+	availabilityRepo     *repository.AvailabilityRepository
+	attendanceRepo       *repository.AttendanceRepository
+	authz                *policy.Policy
+	requireVerifiedEmail bool
 }
 
-func NewEventHandler(eventRepo *repository.EventRepository, teamRepo *repository.TeamRepository, assignmentRepo *repository.AssignmentRepository) *EventHandler {
-	return &EventHandler{eventRepo: eventRepo, teamRepo: teamRepo, assignmentRepo: assignmentRepo}
+func NewEventHandler(eventRepo *repository.EventRepository, teamRepo *repository.TeamRepository, assignmentRepo *repository.AssignmentRepository, userRepo *repository.UserRepository, availabilityRepo *repository.AvailabilityRepository, attendanceRepo *repository.AttendanceRepository, authz *policy.Policy, requireVerifiedEmail bool) *EventHandler {
+	return &EventHandler{
+		eventRepo:            eventRepo,
+		teamRepo:             teamRepo,
+		assignmentRepo:       assignmentRepo,
+		userRepo:             userRepo,
+		availabilityRepo:     availabilityRepo,
+		attendanceRepo:       attendanceRepo,
+		authz:                authz,
+		requireVerifiedEmail: requireVerifiedEmail,
+	}
 }
 
 func (h *EventHandler) Create(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var input models.CreateEventInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -46,95 +68,222 @@ func (h *EventHandler) Create(c *gin.Context) {
 	}
 
 	userID := middleware.GetUserID(c)
-	userRole := middleware.GetUserRole(c)
 
-	// Only admins can create team events
-	if eventType == models.EventTypeTeam && userRole != models.RoleAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create team events"})
+	if !h.checkEventTeam(c, eventType, input.TeamID) {
 		return
 	}
 
-	// Team events require a team
-	if eventType == models.EventTypeTeam && input.TeamID == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Team events require a teamId"})
+	if h.requireVerifiedEmail && !requireVerifiedUsers(c, h.userRepo.With(ctx), participantIDs(input.Participants)) {
 		return
 	}
 
-	// Verify team exists if teamId provided
-	if input.TeamID != nil {
-		_, err := h.teamRepo.GetByID(*input.TeamID)
+	// Events default to the creator's preferred zone
+	timeZone := input.TimeZone
+	if timeZone == "" {
+		user, err := h.userRepo.With(ctx).GetByID(userID)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
 			return
 		}
+		timeZone = user.TimeZone
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+		return
+	}
+
+	var recurrenceRule *string
+	if input.Recurrence != nil {
+		rule, err := recurrence.BuildRule(*input.Recurrence, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recurrenceRule = &rule
 	}
 
 	event := &models.Event{
-		ID:          uuid.New(),
-		Title:       input.Title,
-		Description: input.Description,
-		Date:        date,
-		StartTime:   input.StartTime,
-		EndTime:     input.EndTime,
-		Location:    input.Location,
-		Capacity:    input.Capacity,
-		Status:      status,
-		Type:        eventType,
-		TeamID:      input.TeamID,
-		CreatedBy:   userID,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-	}
-
-	if err := h.eventRepo.Create(event); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
+		ID:             uuid.New(),
+		Title:          input.Title,
+		Description:    input.Description,
+		Date:           date,
+		StartTime:      input.StartTime,
+		EndTime:        input.EndTime,
+		Location:       input.Location,
+		Capacity:       input.Capacity,
+		Status:         status,
+		Type:           eventType,
+		TeamID:         input.TeamID,
+		CreatedBy:      userID,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		RecurrenceRule: recurrenceRule,
+		TimeZone:       loc.String(),
+	}
+	if err := event.SyncInstants(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// If team event, create assignments for all team members
-	if eventType == models.EventTypeTeam && input.TeamID != nil {
-		members, err := h.teamRepo.GetMembers(*input.TeamID)
-		if err == nil && len(members) > 0 {
-			var assignments []models.EventAssignment
-			for _, member := range members {
-				assignments = append(assignments, models.EventAssignment{
-					ID:         uuid.New(),
-					EventID:    event.ID,
-					UserID:     member.UserID,
-					Status:     models.AssignmentStatusPending,
-					AssignedAt: time.Now(),
-				})
-			}
-			h.assignmentRepo.CreateBatch(assignments)
-		}
+	conflicts, ok := checkConflicts(c, h.eventRepo.With(ctx), *event, bookedUsers(event, participantIDs(input.Participants)))
+	if !ok {
+		return
 	}
 
+	if err := h.eventRepo.With(ctx).Create(event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
+		return
+	}
+	metrics.EventsCreated.WithLabelValues(string(event.Type)).Inc()
+
+	h.assignTeamMembers(ctx, event)
+
 	// Set participants for personal events
 	if len(input.Participants) > 0 {
-		h.eventRepo.SetParticipants(event.ID, input.Participants)
+		h.eventRepo.With(ctx).SetParticipants(event.ID, input.Participants)
 	}
 
 	// Return event with participants
-	eventWithParticipants, err := h.eventRepo.GetByIDWithParticipants(event.ID)
+	eventWithParticipants, err := h.eventRepo.With(ctx).GetByIDWithParticipants(event.ID)
 	if err != nil {
 		c.JSON(http.StatusCreated, event)
 		return
 	}
+	eventWithParticipants.Conflicts = conflicts
 	c.JSON(http.StatusCreated, eventWithParticipants)
 }
 
+// checkEventTeam enforces who may create events of a type and validates the team
+func (h *EventHandler) checkEventTeam(c *gin.Context, eventType models.EventType, teamID *uuid.UUID) bool {
+	ctx := c.Request.Context()
+
+	// Team events require a team
+	if eventType == models.EventTypeTeam && teamID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Team events require a teamId"})
+		return false
+	}
+
+	// Verify team exists if teamId provided
+	if teamID != nil {
+		_, err := h.teamRepo.With(ctx).GetByID(*teamID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+			return false
+		}
+	}
+
+	// Only admins and the team's owners and managers can create team events
+	if eventType == models.EventTypeTeam &&
+		!authorize(c, h.authz, policy.CreateEvents, policy.Team(*teamID), "Only team owners and managers can create team events") {
+		return false
+	}
+
+	return true
+}
+
+// assignTeamMembers creates pending assignments for every member of a team
+// event's team (series-wide for recurring events)
+func (h *EventHandler) assignTeamMembers(ctx context.Context, event *models.Event) {
+	if event.Type != models.EventTypeTeam || event.TeamID == nil {
+		return
+	}
+
+	members, err := h.teamRepo.With(ctx).GetMembers(*event.TeamID)
+	if err != nil || len(members) == 0 {
+		return
+	}
+
+	// Members who joined before verification was required are left out
+	skip := map[uuid.UUID]bool{}
+	if h.requireVerifiedEmail {
+		ids := make([]uuid.UUID, len(members))
+		for i, member := range members {
+			ids[i] = member.UserID
+		}
+		unverified, err := unverifiedUsers(h.userRepo.With(ctx), ids)
+		if err != nil {
+			return
+		}
+		for _, id := range unverified {
+			skip[id] = true
+		}
+	}
+
+	// Members who are out of office are declined up front, for a series only
+	// on the occurrences they miss
+	slots, err := scheduleSlots(h.eventRepo.With(ctx), *event)
+	if err != nil {
+		slots = nil
+	}
+	blocks := map[uuid.UUID][]models.OutOfOffice{}
+	if len(slots) > 0 {
+		ids := make([]uuid.UUID, len(members))
+		for i, member := range members {
+			ids[i] = member.UserID
+		}
+		found, err := h.availabilityRepo.With(ctx).GetOutOfOfficeByUserIDs(ids, slots[0].StartsAt, slots[len(slots)-1].EndsAt)
+		if err == nil {
+			blocks = groupOutOfOffice(found)
+		}
+	}
+
+	now := time.Now()
+	var assignments []models.EventAssignment
+	for _, member := range members {
+		if skip[member.UserID] {
+			continue
+		}
+		assignment := models.EventAssignment{
+			ID:         uuid.New(),
+			EventID:    event.ID,
+			UserID:     member.UserID,
+			Status:     models.AssignmentStatusPending,
+			AssignedAt: now,
+		}
+
+		for _, slot := range slots {
+			block := outOfOfficeDuring(blocks[member.UserID], slot.StartsAt, slot.EndsAt)
+			if block == nil {
+				continue
+			}
+			reason := outOfOfficeReason(block)
+			declined := models.EventAssignment{
+				ID:          uuid.New(),
+				EventID:     event.ID,
+				UserID:      member.UserID,
+				Status:      models.AssignmentStatusRejected,
+				AssignedAt:  now,
+				RespondedAt: &now,
+				Reason:      &reason,
+			}
+			if event.RecurrenceRule == nil {
+				assignment = declined
+				break
+			}
+			declined.OccurrenceDate = slot.OccurrenceDate
+			assignments = append(assignments, declined)
+		}
+
+		assignments = append(assignments, assignment)
+	}
+	h.assignmentRepo.With(ctx).CreateBatch(assignments)
+}
+
 func (h *EventHandler) GetAll(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var status *models.EventStatus
 	if s := c.Query("status"); s != "" {
 		st := models.EventStatus(s)
 		status = &st
 	}
 
-	events, err := h.eventRepo.GetAll(status)
+	events, err := h.eventRepo.With(ctx).GetAll(status)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 		return
@@ -148,13 +297,15 @@ func (h *EventHandler) GetAll(c *gin.Context) {
 }
 
 func (h *EventHandler) GetByID(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	event, err := h.eventRepo.GetByIDWithParticipants(id)
+	event, err := h.eventRepo.With(ctx).GetByIDWithParticipants(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
@@ -168,13 +319,15 @@ func (h *EventHandler) GetByID(c *gin.Context) {
 }
 
 func (h *EventHandler) Update(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	event, err := h.eventRepo.GetByID(id)
+	event, err := h.eventRepo.With(ctx).GetByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
@@ -184,12 +337,7 @@ func (h *EventHandler) Update(c *gin.Context) {
 		return
 	}
 
-	userID := middleware.GetUserID(c)
-	userRole := middleware.GetUserRole(c)
-
-	// Admins can edit any event, users can only edit their personal events
-	if userRole != models.RoleAdmin && event.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own events"})
+	if !authorize(c, h.authz, policy.Update, policy.Event(event), "You can only update your own events") {
 		return
 	}
 
@@ -199,63 +347,87 @@ func (h *EventHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if input.Title != nil {
-		event.Title = *input.Title
+	if h.requireVerifiedEmail && !requireVerifiedUsers(c, h.userRepo.With(ctx), participantIDs(input.Participants)) {
+		return
 	}
-	if input.Description != nil {
-		event.Description = *input.Description
+
+	// Moving an event between personal and team calendars is not supported
+	if field := changedTeamField(event, &input); field != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + " cannot be changed after an event is created"})
+		return
 	}
-	if input.Date != nil {
-		date, err := time.Parse("2006-01-02", *input.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+
+	scope := models.RecurrenceScope(c.DefaultQuery("scope", string(models.RecurrenceScopeAll)))
+	if event.RecurrenceRule != nil && scope != models.RecurrenceScopeAll {
+		occurrenceDate, ok := requireOccurrence(c, event, c.Query("occurrence"))
+		if !ok {
+			return
+		}
+
+		switch scope {
+		case models.RecurrenceScopeThis:
+			h.updateOccurrence(c, event, *occurrenceDate, &input)
+			return
+		case models.RecurrenceScopeFollowing:
+			// Splitting at the first occurrence is the same as editing the whole series
+			if occurrenceDate.After(event.Date) {
+				h.updateFollowing(c, event, *occurrenceDate, &input)
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope. Use this, following or all"})
 			return
 		}
-		event.Date = date
-	}
-	if input.StartTime != nil {
-		event.StartTime = *input.StartTime
-	}
-	if input.EndTime != nil {
-		event.EndTime = *input.EndTime
-	}
-	if input.Location != nil {
-		event.Location = *input.Location
 	}
-	if input.Capacity != nil {
-		event.Capacity = input.Capacity
+
+	previousCapacity := event.Capacity
+	if err := applyEventInput(event, &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if input.Status != nil {
-		event.Status = *input.Status
+
+	conflicts, ok := h.checkUpdateConflicts(c, event, event, &input)
+	if !ok {
+		return
 	}
 
-	if err := h.eventRepo.Update(event); err != nil {
+	if err := h.eventRepo.With(ctx).Update(event); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
 		return
 	}
 
+	if capacityRaised(previousCapacity, event.Capacity) {
+		if err := h.promoteWaitlist(ctx, event); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Event updated but failed to promote waitlist"})
+			return
+		}
+	}
+
 	// Update participants if provided
 	if input.Participants != nil {
-		h.eventRepo.SetParticipants(event.ID, input.Participants)
+		h.eventRepo.With(ctx).SetParticipants(event.ID, input.Participants)
 	}
 
 	// Return event with participants
-	eventWithParticipants, err := h.eventRepo.GetByIDWithParticipants(event.ID)
+	eventWithParticipants, err := h.eventRepo.With(ctx).GetByIDWithParticipants(event.ID)
 	if err != nil {
 		c.JSON(http.StatusOK, event)
 		return
 	}
+	eventWithParticipants.Conflicts = conflicts
 	c.JSON(http.StatusOK, eventWithParticipants)
 }
 
 func (h *EventHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	event, err := h.eventRepo.GetByID(id)
+	event, err := h.eventRepo.With(ctx).GetByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
@@ -265,16 +437,34 @@ func (h *EventHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	userID := middleware.GetUserID(c)
-	userRole := middleware.GetUserRole(c)
-
-	// Admins can delete any event, users can only delete their own events
-	if userRole != models.RoleAdmin && event.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only delete your own events"})
+	if !authorize(c, h.authz, policy.Delete, policy.Event(event), "You can only delete your own events") {
 		return
 	}
 
-	if err := h.eventRepo.Delete(id); err != nil {
+	scope := models.RecurrenceScope(c.DefaultQuery("scope", string(models.RecurrenceScopeAll)))
+	if event.RecurrenceRule != nil && scope != models.RecurrenceScopeAll {
+		occurrenceDate, ok := requireOccurrence(c, event, c.Query("occurrence"))
+		if !ok {
+			return
+		}
+
+		switch scope {
+		case models.RecurrenceScopeThis:
+			h.cancelOccurrence(c, event, *occurrenceDate)
+			return
+		case models.RecurrenceScopeFollowing:
+			// Deleting from the first occurrence removes the whole series
+			if occurrenceDate.After(event.Date) {
+				h.deleteFollowing(c, event, *occurrenceDate)
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope. Use this, following or all"})
+			return
+		}
+	}
+
+	if err := h.eventRepo.With(ctx).Delete(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event"})
 		return
 	}
@@ -282,32 +472,41 @@ func (h *EventHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully"})
 }
 
+// GetCalendar returns published events between the start and end dates. Dates
+// are read in the tz query parameter (UTC by default) and events are returned
+// with their times converted to it.
 func (h *EventHandler) GetCalendar(c *gin.Context) {
-	startStr := c.Query("start")
-	endStr := c.Query("end")
+	ctx := c.Request.Context()
 
-	if startStr == "" || endStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end query parameters are required"})
+	loc, ok := calendarZone(c, time.UTC)
+	if !ok {
 		return
 	}
 
-	start, err := time.Parse("2006-01-02", startStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+	start, end, ok := parseCalendarRange(c, loc)
+	if !ok {
 		return
 	}
 
-	end, err := time.Parse("2006-01-02", endStr)
+	events, err := h.eventRepo.With(ctx).GetByDateRange(start, end)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 		return
 	}
 
-	events, err := h.eventRepo.GetByDateRange(start, end)
+	occurrences, err := h.expandPublicSeries(ctx, start, end)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expand recurring events"})
 		return
 	}
+	events = append(events, occurrences...)
+
+	for i := range events {
+		events[i].Localize(loc)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartsAt.Before(events[j].StartsAt)
+	})
 
 	if events == nil {
 		events = []models.EventWithAttendeeCount{}
@@ -316,35 +515,72 @@ func (h *EventHandler) GetCalendar(c *gin.Context) {
 	c.JSON(http.StatusOK, events)
 }
 
+// GetMyCalendar is GetCalendar for the current user, defaulting to their preferred zone
 func (h *EventHandler) GetMyCalendar(c *gin.Context) {
-	startStr := c.Query("start")
-	endStr := c.Query("end")
+	ctx := c.Request.Context()
 
-	if startStr == "" || endStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end query parameters are required"})
-		return
-	}
+	userID := middleware.GetUserID(c)
 
-	start, err := time.Parse("2006-01-02", startStr)
+	user, err := h.userRepo.With(ctx).GetByID(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
 		return
 	}
 
-	end, err := time.Parse("2006-01-02", endStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+	loc, ok := calendarZone(c, user.Zone())
+	if !ok {
 		return
 	}
 
-	userID := middleware.GetUserID(c)
+	start, end, ok := parseCalendarRange(c, loc)
+	if !ok {
+		return
+	}
 
-	events, err := h.eventRepo.GetCalendarByUserID(userID, start, end)
+	events, err := h.eventRepo.With(ctx).GetCalendarByUserID(userID, start, end)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 		return
 	}
 
+	occurrences, err := h.expandUserSeries(ctx, userID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expand recurring events"})
+		return
+	}
+	events = append(events, occurrences...)
+
+	// Out-of-office blocks are listed as entries of their own on request
+	if c.Query("includeOutOfOffice") == "true" {
+		blocks, err := h.availabilityRepo.With(ctx).GetOutOfOfficeByUserIDs([]uuid.UUID{userID}, start, end)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch out-of-office blocks"})
+			return
+		}
+		for i := range blocks {
+			events = append(events, models.EventWithAssignment{
+				Event: models.Event{
+					ID:        blocks[i].ID,
+					Title:     outOfOfficeReason(&blocks[i]),
+					TimeZone:  user.TimeZone,
+					StartsAt:  blocks[i].StartsAt,
+					EndsAt:    blocks[i].EndsAt,
+					CreatedBy: userID,
+					CreatedAt: blocks[i].CreatedAt,
+					UpdatedAt: blocks[i].CreatedAt,
+				},
+				OutOfOffice: &blocks[i],
+			})
+		}
+	}
+
+	for i := range events {
+		events[i].Localize(loc)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartsAt.Before(events[j].StartsAt)
+	})
+
 	if events == nil {
 		events = []models.EventWithAssignment{}
 	}
@@ -353,11 +589,13 @@ func (h *EventHandler) GetMyCalendar(c *gin.Context) {
 }
 
 func (h *EventHandler) GetMyEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := middleware.GetUserID(c)
 	eventType := c.Query("type")
 
 	if eventType == "personal" {
-		events, err := h.eventRepo.GetPersonalByUserID(userID)
+		events, err := h.eventRepo.With(ctx).GetPersonalByUserID(userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 			return
@@ -370,7 +608,7 @@ func (h *EventHandler) GetMyEvents(c *gin.Context) {
 	}
 
 	if eventType == "team" {
-		events, err := h.eventRepo.GetTeamEventsByUserID(userID)
+		events, err := h.eventRepo.With(ctx).GetTeamEventsByUserID(userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 			return
@@ -383,11 +621,439 @@ func (h *EventHandler) GetMyEvents(c *gin.Context) {
 	}
 
 	// Return all events for the user
-	personalEvents, _ := h.eventRepo.GetPersonalByUserID(userID)
-	teamEvents, _ := h.eventRepo.GetTeamEventsByUserID(userID)
+	personalEvents, _ := h.eventRepo.With(ctx).GetPersonalByUserID(userID)
+	teamEvents, _ := h.eventRepo.With(ctx).GetTeamEventsByUserID(userID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"personal": personalEvents,
 		"team":     teamEvents,
 	})
 }
+
+func (h *EventHandler) updateOccurrence(c *gin.Context, event *models.Event, occurrenceDate time.Time, input *models.UpdateEventInput) {
+	ctx := c.Request.Context()
+
+	// An exception only overrides the fields below; the rest belong to the series
+	if field := seriesOnlyField(input); field != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + " cannot be changed for a single occurrence. Use scope=following or scope=all"})
+		return
+	}
+
+	exception, err := h.eventRepo.With(ctx).GetException(event.ID, occurrenceDate)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch occurrence"})
+		return
+	}
+	if exception == nil {
+		exception = &models.EventException{
+			ID:           uuid.New(),
+			EventID:      event.ID,
+			OriginalDate: occurrenceDate,
+			CreatedAt:    time.Now(),
+		}
+	}
+
+	if input.Title != nil {
+		exception.Title = input.Title
+	}
+	if input.Description != nil {
+		exception.Description = input.Description
+	}
+	if input.Date != nil {
+		date, err := time.Parse("2006-01-02", *input.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
+		exception.Date = &date
+	}
+	if input.StartTime != nil {
+		exception.StartTime = input.StartTime
+	}
+	if input.EndTime != nil {
+		exception.EndTime = input.EndTime
+	}
+	if input.Location != nil {
+		exception.Location = input.Location
+	}
+	if input.Status != nil {
+		exception.Cancelled = *input.Status == models.EventStatusCancelled
+	}
+	exception.UpdatedAt = time.Now()
+
+	occurrence := recurrence.Apply(*event, occurrenceDate, exception)
+	if err := occurrence.SyncInstants(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.eventRepo.With(ctx).UpsertException(exception); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update occurrence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, occurrence)
+}
+
+// seriesOnlyField returns the JSON name of the first field in input that an
+// occurrence exception cannot override, or "" if there is none
+func seriesOnlyField(input *models.UpdateEventInput) string {
+	switch {
+	case input.Capacity != nil:
+		return "capacity"
+	case input.Recurrence != nil:
+		return "recurrence"
+	case input.TimeZone != nil:
+		return "timeZone"
+	case input.Participants != nil:
+		return "participants"
+	}
+	return ""
+}
+
+// changedTeamField returns "type" or "teamId" when input gives the event a
+// different type or team, or "" if it keeps them
+func changedTeamField(event *models.Event, input *models.UpdateEventInput) string {
+	switch {
+	case input.Type != nil && *input.Type != event.Type:
+		return "type"
+	case input.TeamID != nil && (event.TeamID == nil || *input.TeamID != *event.TeamID):
+		return "teamId"
+	}
+	return ""
+}
+
+func (h *EventHandler) updateFollowing(c *gin.Context, event *models.Event, occurrenceDate time.Time, input *models.UpdateEventInput) {
+	ctx := c.Request.Context()
+
+	before, after, err := recurrence.Split(*event.RecurrenceRule, event.StartsAt.In(event.Zone()), occurrenceDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to split series"})
+		return
+	}
+
+	next := *event
+	next.ID = uuid.New()
+	next.Date = occurrenceDate
+	next.RecurrenceRule = &after
+	next.CreatedAt = time.Now()
+	next.UpdatedAt = time.Now()
+
+	if err := applyEventInput(&next, input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conflicts, ok := h.checkUpdateConflicts(c, event, &next, input)
+	if !ok {
+		return
+	}
+
+	event.RecurrenceRule = &before
+	if err := h.eventRepo.With(ctx).SplitSeries(event, &next, occurrenceDate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+		return
+	}
+
+	if capacityRaised(event.Capacity, next.Capacity) {
+		if err := h.promoteWaitlist(ctx, &next); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Event updated but failed to promote waitlist"})
+			return
+		}
+	}
+
+	if input.Participants != nil {
+		h.eventRepo.With(ctx).SetParticipants(next.ID, input.Participants)
+	}
+
+	eventWithParticipants, err := h.eventRepo.With(ctx).GetByIDWithParticipants(next.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, next)
+		return
+	}
+	eventWithParticipants.Conflicts = conflicts
+	c.JSON(http.StatusOK, eventWithParticipants)
+}
+
+// promoteWaitlist fills the places freed by a capacity increase, separately
+// for every occurrence of a recurring event
+func (h *EventHandler) promoteWaitlist(ctx context.Context, event *models.Event) error {
+	occurrences, err := h.attendanceRepo.With(ctx).GetWaitlistedOccurrences(event.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, occurrenceDate := range occurrences {
+		if _, err := h.attendanceRepo.With(ctx).PromoteWaitlisted(event.ID, occurrenceDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func capacityRaised(previous, current *int) bool {
+	if previous == nil {
+		return false
+	}
+	return current == nil || *current > *previous
+}
+
+func (h *EventHandler) cancelOccurrence(c *gin.Context, event *models.Event, occurrenceDate time.Time) {
+	ctx := c.Request.Context()
+
+	exception, err := h.eventRepo.With(ctx).GetException(event.ID, occurrenceDate)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch occurrence"})
+		return
+	}
+	if exception == nil {
+		exception = &models.EventException{
+			ID:           uuid.New(),
+			EventID:      event.ID,
+			OriginalDate: occurrenceDate,
+			CreatedAt:    time.Now(),
+		}
+	}
+	exception.Cancelled = true
+	exception.UpdatedAt = time.Now()
+
+	if err := h.eventRepo.With(ctx).UpsertException(exception); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel occurrence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Occurrence cancelled successfully"})
+}
+
+func (h *EventHandler) deleteFollowing(c *gin.Context, event *models.Event, occurrenceDate time.Time) {
+	ctx := c.Request.Context()
+
+	rule, err := recurrence.Truncate(*event.RecurrenceRule, occurrenceDate, event.Zone())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to split series"})
+		return
+	}
+
+	event.RecurrenceRule = &rule
+	if err := h.eventRepo.With(ctx).TruncateSeries(event, occurrenceDate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete occurrences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Following occurrences deleted successfully"})
+}
+
+func (h *EventHandler) expandPublicSeries(ctx context.Context, start, end time.Time) ([]models.EventWithAttendeeCount, error) {
+	series, err := h.eventRepo.With(ctx).GetPublishedSeries(end)
+	if err != nil || len(series) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(series))
+	for i, s := range series {
+		ids[i] = s.ID
+	}
+
+	exceptions, err := h.eventRepo.With(ctx).GetExceptions(ids)
+	if err != nil {
+		return nil, err
+	}
+	exceptionsByEvent := groupExceptions(exceptions)
+
+	counts, err := h.eventRepo.With(ctx).GetOccurrenceAttendeeCounts(ids, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	attendeeCounts := make(map[string]int, len(counts))
+	for _, count := range counts {
+		attendeeCounts[occurrenceKey(count.EventID, count.OccurrenceDate)] = count.Count
+	}
+
+	var events []models.EventWithAttendeeCount
+	for _, s := range series {
+		occurrences, err := recurrence.Expand(s.Event, exceptionsByEvent[s.ID], start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, occurrence := range occurrences {
+			events = append(events, models.EventWithAttendeeCount{
+				Event:         occurrence,
+				AttendeeCount: attendeeCounts[occurrenceKey(s.ID, *occurrence.OccurrenceDate)],
+				TeamName:      s.TeamName,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+func (h *EventHandler) expandUserSeries(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]models.EventWithAssignment, error) {
+	series, err := h.eventRepo.With(ctx).GetSeriesCalendarByUserID(userID, end)
+	if err != nil || len(series) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(series))
+	for i, s := range series {
+		ids[i] = s.ID
+	}
+
+	exceptions, err := h.eventRepo.With(ctx).GetExceptions(ids)
+	if err != nil {
+		return nil, err
+	}
+	exceptionsByEvent := groupExceptions(exceptions)
+
+	responses, err := h.assignmentRepo.With(ctx).GetOccurrencesByUserID(userID, ids, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	occurrenceStatus := make(map[string]models.AssignmentStatus, len(responses))
+	for _, response := range responses {
+		occurrenceStatus[occurrenceKey(response.EventID, *response.OccurrenceDate)] = response.Status
+	}
+
+	var events []models.EventWithAssignment
+	for _, s := range series {
+		occurrences, err := recurrence.Expand(s.Event, exceptionsByEvent[s.ID], start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, occurrence := range occurrences {
+			status := s.AssignmentStatus
+			if st, ok := occurrenceStatus[occurrenceKey(s.ID, *occurrence.OccurrenceDate)]; ok {
+				status = &st
+			}
+
+			// Same visibility rules as single events: own personal events, team
+			// events and approved participations
+			if s.Type != models.EventTypeTeam && s.CreatedBy != userID &&
+				(status == nil || *status != models.AssignmentStatusApproved) {
+				continue
+			}
+
+			events = append(events, models.EventWithAssignment{
+				Event:            occurrence,
+				AssignmentStatus: status,
+				TeamName:         s.TeamName,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+func applyEventInput(event *models.Event, input *models.UpdateEventInput) error {
+	if input.Title != nil {
+		event.Title = *input.Title
+	}
+	if input.Description != nil {
+		event.Description = *input.Description
+	}
+	if input.Date != nil {
+		date, err := time.Parse("2006-01-02", *input.Date)
+		if err != nil {
+			return errors.New("Invalid date format")
+		}
+		event.Date = date
+	}
+	if input.StartTime != nil {
+		event.StartTime = *input.StartTime
+	}
+	if input.EndTime != nil {
+		event.EndTime = *input.EndTime
+	}
+	if input.Location != nil {
+		event.Location = *input.Location
+	}
+	if input.TimeZone != nil {
+		loc, err := time.LoadLocation(*input.TimeZone)
+		if err != nil {
+			return errors.New("Invalid time zone")
+		}
+		event.TimeZone = loc.String()
+	}
+	if input.Capacity != nil {
+		event.Capacity = input.Capacity
+	}
+	if input.Status != nil {
+		event.Status = *input.Status
+	}
+	if input.Recurrence != nil {
+		rule, err := recurrence.BuildRule(*input.Recurrence, event.Zone())
+		if err != nil {
+			return err
+		}
+		event.RecurrenceRule = &rule
+	}
+	return event.SyncInstants()
+}
+
+// checkUpdateConflicts checks the participants of updated when they are replaced
+// or the event is moved. original is the stored event, which differs from
+// updated when a series is split; its occurrences are not counted as conflicts.
+func (h *EventHandler) checkUpdateConflicts(c *gin.Context, original, updated *models.Event, input *models.UpdateEventInput) ([]models.Conflict, bool) {
+	ctx := c.Request.Context()
+
+	rescheduled := input.Date != nil || input.StartTime != nil || input.EndTime != nil ||
+		input.TimeZone != nil || input.Recurrence != nil
+	if input.Participants == nil && !rescheduled {
+		return nil, true
+	}
+
+	var participants []uuid.UUID
+	if input.Participants != nil {
+		participants = participantIDs(input.Participants)
+	} else {
+		current, err := h.eventRepo.With(ctx).GetParticipants(original.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch participants"})
+			return nil, false
+		}
+		for _, p := range current {
+			participants = append(participants, p.UserID)
+		}
+	}
+
+	return checkConflicts(c, h.eventRepo.With(ctx), *updated, bookedUsers(updated, participants), original.ID)
+}
+
+// calendarZone reads the tz query parameter, falling back to fallback
+func calendarZone(c *gin.Context, fallback *time.Location) (*time.Location, bool) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return fallback, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+		return nil, false
+	}
+	return loc, true
+}
+
+// parseCalendarRange reads the inclusive start and end dates as days in loc and
+// returns the instants [start, end) they cover
+func parseCalendarRange(c *gin.Context, loc *time.Location) (time.Time, time.Time, bool) {
+	startStr := c.Query("start")
+	endStr := c.Query("end")
+
+	if startStr == "" || endStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end query parameters are required"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", startStr, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	end, err := time.ParseInLocation("2006-01-02", endStr, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	return start, end.AddDate(0, 0, 1), true
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"agenda-api/internal/ical"
+	"agenda-api/internal/metrics"
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/recurrence"
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxImportSize = 5 << 20
+
+// PreviewImport reports what Import would do with an uploaded .ics file
+func (h *EventHandler) PreviewImport(c *gin.Context) {
+	h.importEvents(c, true)
+}
+
+// Import creates or updates events from an uploaded .ics file. Events are keyed
+// on the VEVENT UID, so importing the same file again updates them.
+func (h *EventHandler) Import(c *gin.Context) {
+	h.importEvents(c, false)
+}
+
+func (h *EventHandler) importEvents(c *gin.Context, dryRun bool) {
+	ctx := c.Request.Context()
+
+	eventType := models.EventType(c.DefaultQuery("type", string(models.EventTypePersonal)))
+	if eventType != models.EventTypePersonal && eventType != models.EventTypeTeam {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type. Use personal or team"})
+		return
+	}
+
+	var teamID *uuid.UUID
+	if s := c.Query("teamId"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			return
+		}
+		teamID = &id
+	}
+
+	// Same rules as creating events one by one
+	if !h.checkEventTeam(c, eventType, teamID) {
+		return
+	}
+
+	// Zone for floating and UTC times; TZID-qualified events keep their own zone
+	location := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+			return
+		}
+		location = loc
+	}
+
+	source, err := importSource(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer source.Close()
+
+	imported, err := ical.Decode(io.LimitReader(source, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid iCalendar file: " + err.Error()})
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	items := make([]models.ImportItem, 0, len(imported))
+	counts := map[models.ImportAction]int{}
+
+	for _, ie := range imported {
+		event, exceptions, warnings, err := importedToEvent(ie, location)
+		if err != nil {
+			items = append(items, models.ImportItem{
+				UID:    ie.UID,
+				Action: models.ImportActionSkip,
+				Title:  ie.Title,
+				Error:  err.Error(),
+			})
+			counts[models.ImportActionSkip]++
+			continue
+		}
+
+		item := models.ImportItem{
+			UID:            ie.UID,
+			Action:         models.ImportActionCreate,
+			Title:          event.Title,
+			Date:           event.Date.Format("2006-01-02"),
+			StartTime:      event.StartTime,
+			EndTime:        event.EndTime,
+			TimeZone:       event.TimeZone,
+			Status:         event.Status,
+			RecurrenceRule: event.RecurrenceRule,
+			Exceptions:     len(exceptions),
+			Warnings:       warnings,
+		}
+
+		existing, err := h.eventRepo.With(ctx).GetByICalUID(userID, ie.UID)
+		if err != nil && err != sql.ErrNoRows {
+			item.Action = models.ImportActionSkip
+			item.Error = "Failed to look up existing event"
+			items = append(items, item)
+			counts[item.Action]++
+			continue
+		}
+		if existing != nil {
+			item.Action = models.ImportActionUpdate
+			item.EventID = &existing.ID
+		}
+
+		if !dryRun {
+			if err := h.saveImported(ctx, existing, event, exceptions, eventType, teamID, userID); err != nil {
+				item.Action = models.ImportActionSkip
+				item.Error = "Failed to save event"
+			} else {
+				item.EventID = &event.ID
+			}
+		}
+
+		items = append(items, item)
+		counts[item.Action]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dryRun":  dryRun,
+		"created": counts[models.ImportActionCreate],
+		"updated": counts[models.ImportActionUpdate],
+		"skipped": counts[models.ImportActionSkip],
+		"items":   items,
+	})
+}
+
+func (h *EventHandler) saveImported(ctx context.Context, existing, event *models.Event, exceptions []models.EventException, eventType models.EventType, teamID *uuid.UUID, userID uuid.UUID) error {
+	if existing != nil {
+		event.ID = existing.ID
+		event.Type = existing.Type
+		event.TeamID = existing.TeamID
+		event.Capacity = existing.Capacity
+		event.CreatedBy = existing.CreatedBy
+		event.CreatedAt = existing.CreatedAt
+		if err := h.eventRepo.With(ctx).Update(event); err != nil {
+			return err
+		}
+	} else {
+		event.ID = uuid.New()
+		event.Type = eventType
+		event.TeamID = teamID
+		event.CreatedBy = userID
+		event.CreatedAt = time.Now()
+		event.UpdatedAt = time.Now()
+		if err := h.eventRepo.With(ctx).Create(event); err != nil {
+			return err
+		}
+		metrics.EventsCreated.WithLabelValues(string(event.Type)).Inc()
+		h.assignTeamMembers(ctx, event)
+	}
+
+	return h.eventRepo.With(ctx).ReplaceExceptions(event.ID, exceptions)
+}
+
+// importSource returns the uploaded file from a multipart "file" field or the raw body
+func importSource(c *gin.Context) (io.ReadCloser, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return header.Open()
+	}
+	if c.Request.Body == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return c.Request.Body, nil
+}
+
+// importedToEvent maps a decoded VEVENT onto the event model. The event keeps
+// the zone of a TZID-qualified DTSTART; other times are placed in location.
+func importedToEvent(ie ical.ImportedEvent, location *time.Location) (*models.Event, []models.EventException, []string, error) {
+	warnings := append([]string(nil), ie.Warnings...)
+
+	zone := location
+	if !ie.Floating && ie.Start.Location() != time.UTC {
+		zone = ie.Start.Location()
+	}
+
+	date, startTime, endTime, multiDay := importedTimes(ie, zone)
+	if multiDay {
+		warnings = append(warnings, "Event spans several days; imported on its first day only")
+	}
+
+	uid := ie.UID
+	event := &models.Event{
+		Title:       ie.Title,
+		Description: ie.Description,
+		Date:        date,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Location:    ie.Location,
+		Status:      ie.Status,
+		UpdatedAt:   time.Now(),
+		ICalUID:     &uid,
+		TimeZone:    zone.String(),
+	}
+	if err := event.SyncInstants(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var exceptions []models.EventException
+	if ie.RecurrenceRule != "" {
+		if err := recurrence.Validate(ie.RecurrenceRule); err != nil {
+			warnings = append(warnings, "Unsupported RRULE ignored: "+err.Error())
+			return event, nil, warnings, nil
+		}
+		rule := ie.RecurrenceRule
+		event.RecurrenceRule = &rule
+
+		for _, exdate := range ie.ExceptionDates {
+			exceptions = append(exceptions, models.EventException{
+				ID:           uuid.New(),
+				OriginalDate: wallDate(inZone(exdate, ie.Floating, zone)),
+				Cancelled:    true,
+				CreatedAt:    time.Now(),
+				UpdatedAt:    time.Now(),
+			})
+		}
+
+		for _, override := range ie.Overrides {
+			date, startTime, endTime, _ := importedTimes(override, zone)
+			title := override.Title
+			exception := models.EventException{
+				ID:           uuid.New(),
+				OriginalDate: wallDate(inZone(*override.RecurrenceID, ie.Floating, zone)),
+				Cancelled:    override.Status == models.EventStatusCancelled,
+				Title:        &title,
+				Date:         &date,
+				StartTime:    &startTime,
+				EndTime:      &endTime,
+				CreatedAt:    time.Now(),
+				UpdatedAt:    time.Now(),
+			}
+			if override.Description != "" {
+				description := override.Description
+				exception.Description = &description
+			}
+			if override.Location != "" {
+				place := override.Location
+				exception.Location = &place
+			}
+			exceptions = append(exceptions, exception)
+		}
+	} else if len(ie.ExceptionDates) > 0 || len(ie.Overrides) > 0 {
+		warnings = append(warnings, "EXDATE and overrides ignored for a non-recurring event")
+	}
+
+	return event, exceptions, warnings, nil
+}
+
+func importedTimes(ie ical.ImportedEvent, zone *time.Location) (date time.Time, startTime, endTime string, multiDay bool) {
+	start := inZone(ie.Start, ie.Floating, zone)
+	end := inZone(ie.End, ie.Floating, zone)
+	date = wallDate(start)
+
+	if ie.AllDay {
+		return date, "00:00:00", "23:59:59", end.Sub(start) > 24*time.Hour
+	}
+
+	// Ending exactly at midnight still counts as the same day
+	lastDay := wallDate(end.Add(-time.Second))
+	return date, start.Format("15:04:05"), end.Format("15:04:05"), lastDay.After(date)
+}
+
+// inZone returns the wall-clock time of t in zone. Floating times already are.
+func inZone(t time.Time, floating bool, zone *time.Location) time.Time {
+	if floating {
+		return t
+	}
+	return t.In(zone)
+}
+
+func wallDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"agenda-api/internal/repository"
+	"agenda-api/internal/token"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type FeedHandler struct {
+	feedRepo  *repository.FeedRepository
+	eventRepo *repository.EventRepository
+	teamRepo  *repository.TeamRepository
+	userRepo  *repository.UserRepository
+	authz     *policy.Policy
+	calendars *ICalHandler
+}
+
+func NewFeedHandler(feedRepo *repository.FeedRepository, eventRepo *repository.EventRepository, teamRepo *repository.TeamRepository, userRepo *repository.UserRepository, authz *policy.Policy, calendars *ICalHandler) *FeedHandler {
+	return &FeedHandler{
+		feedRepo:  feedRepo,
+		eventRepo: eventRepo,
+		teamRepo:  teamRepo,
+		userRepo:  userRepo,
+		authz:     authz,
+		calendars: calendars,
+	}
+}
+
+func (h *FeedHandler) Create(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.CreateFeedInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Team feeds require a team, other scopes must not carry one
+	if input.Scope == models.FeedScopeTeam {
+		if input.TeamID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Team feeds require a teamId"})
+			return
+		}
+		_, err := h.teamRepo.With(ctx).GetByID(*input.TeamID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+			return
+		}
+
+		// Team calendars are only shared with the team's members
+		if !authorize(c, h.authz, policy.View, policy.Team(*input.TeamID), "You are not a member of this team") {
+			return
+		}
+	} else {
+		input.TeamID = nil
+	}
+
+	plain, hash, err := token.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed token"})
+		return
+	}
+
+	feed := &models.CalendarFeed{
+		ID:        uuid.New(),
+		UserID:    middleware.GetUserID(c),
+		Name:      input.Name,
+		TokenHash: hash,
+		Scope:     input.Scope,
+		TeamID:    input.TeamID,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.feedRepo.With(ctx).Create(feed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create feed"})
+		return
+	}
+
+	// The token is only shown once; only its hash is stored
+	c.JSON(http.StatusCreated, gin.H{
+		"feed":  feed,
+		"token": plain,
+		"url":   feedURL(c, plain),
+	})
+}
+
+func (h *FeedHandler) GetMyFeeds(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := middleware.GetUserID(c)
+
+	feeds, err := h.feedRepo.With(ctx).GetActiveByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feeds"})
+		return
+	}
+
+	if feeds == nil {
+		feeds = []models.CalendarFeed{}
+	}
+
+	c.JSON(http.StatusOK, feeds)
+}
+
+func (h *FeedHandler) Update(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	feed, ok := h.getOwnFeed(c)
+	if !ok {
+		return
+	}
+
+	var input models.UpdateFeedInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name != nil {
+		feed.Name = *input.Name
+		if err := h.feedRepo.With(ctx).UpdateName(feed.ID, feed.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feed"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+func (h *FeedHandler) Revoke(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	feed, ok := h.getOwnFeed(c)
+	if !ok {
+		return
+	}
+
+	if err := h.feedRepo.With(ctx).Revoke(feed.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feed revoked successfully"})
+}
+
+// Serve answers calendar clients, which authenticate with the secret in the URL
+// instead of a Bearer token. The feed only works while its owner could still
+// create it: their account must be active and, for team feeds, they must
+// still be allowed to view the team.
+func (h *FeedHandler) Serve(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	plain := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	feed, err := h.feedRepo.With(ctx).GetActiveByTokenHash(token.Hash(plain))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return
+	}
+
+	if !h.ownerMayRead(c, feed) {
+		return
+	}
+
+	start, end, ok := parseExportWindow(c)
+	if !ok {
+		return
+	}
+
+	var events []models.Event
+	switch feed.Scope {
+	case models.FeedScopePublic:
+		events, err = h.eventRepo.With(ctx).GetForExport(start, end)
+	case models.FeedScopeTeam:
+		events, err = h.calendars.teamEvents(ctx, *feed.TeamID, start, end)
+	default:
+		events, err = h.eventRepo.With(ctx).GetExportByUserID(feed.UserID, start, end)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	h.feedRepo.With(ctx).TouchLastPolled(feed.ID)
+
+	// Public feeds hold the same data as the public export
+	h.calendars.writeCalendar(c, feed.Name, "feed.ics", events, feed.Scope != models.FeedScopePublic)
+}
+
+// ownerMayRead checks that the feed's owner is active and, for team feeds,
+// still sees the team. Feeds that fail are reported missing.
+func (h *FeedHandler) ownerMayRead(c *gin.Context, feed *models.CalendarFeed) bool {
+	ctx := c.Request.Context()
+
+	owner, err := h.userRepo.With(ctx).GetByID(feed.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return false
+	}
+	if owner.DeactivatedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return false
+	}
+
+	if feed.Scope != models.FeedScopeTeam || feed.TeamID == nil {
+		return true
+	}
+
+	subject := policy.Subject{UserID: owner.ID, Role: owner.Role}
+	switch err := h.authz.Authorize(subject, policy.View, policy.Team(*feed.TeamID)); err {
+	case nil:
+		return true
+	case policy.ErrNotFound, policy.ErrForbidden:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+	}
+	return false
+}
+
+func (h *FeedHandler) getOwnFeed(c *gin.Context) (*models.CalendarFeed, bool) {
+	ctx := c.Request.Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+		return nil, false
+	}
+
+	feed, err := h.feedRepo.With(ctx).GetByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed"})
+		return nil, false
+	}
+
+	if !authorize(c, h.authz, policy.Update, policy.Personal(feed.UserID), "Feed not found") {
+		return nil, false
+	}
+	if feed.RevokedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return nil, false
+	}
+
+	return feed, true
+}
+
+func feedURL(c *gin.Context, plain string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/api/feeds/" + plain + ".ics"
+}
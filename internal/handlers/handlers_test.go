@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"agenda-api/internal/database"
+	"agenda-api/internal/migrate"
+	"agenda-api/migrations"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it.
+// Tests using it are skipped when the variable is not set.
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := database.NewPostgresDB(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runner, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
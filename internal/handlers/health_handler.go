@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"agenda-api/internal/migrate"
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readyTimeout bounds the database round trips of a readiness probe
+const readyTimeout = 2 * time.Second
+
+// DatabasePinger checks that the database answers, like *sqlx.DB
+type DatabasePinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PendingMigrations lists the migrations the database still lacks, like *migrate.Runner
+type PendingMigrations interface {
+	Pending(ctx context.Context) ([]migrate.Migration, error)
+}
+
+type HealthHandler struct {
+	db       DatabasePinger
+	runner   PendingMigrations
+	draining atomic.Bool
+}
+
+func NewHealthHandler(db DatabasePinger, runner PendingMigrations) *HealthHandler {
+	return &HealthHandler{db: db, runner: runner}
+}
+
+// Drain makes every later readiness probe fail, so load balancers stop
+// sending traffic while in-flight requests finish
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is up and serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports whether the instance can take traffic: it is not shutting
+// down, the database answers and its schema matches the binary
+func (h *HealthHandler) Ready(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	if err := h.db.PingContext(ctx); err != nil {
+		log.Printf("Readiness check failed: database: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Database unreachable"})
+		return
+	}
+
+	pending, err := h.runner.Pending(ctx)
+	if err != nil {
+		log.Printf("Readiness check failed: migrations: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Failed to check migrations"})
+		return
+	}
+	if len(pending) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Database migrations pending"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"agenda-api/internal/migrate"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubPinger struct{ err error }
+
+func (p stubPinger) PingContext(context.Context) error { return p.err }
+
+type stubMigrations struct {
+	pending []migrate.Migration
+	err     error
+}
+
+func (m stubMigrations) Pending(context.Context) ([]migrate.Migration, error) {
+	return m.pending, m.err
+}
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		db         stubPinger
+		migrations stubMigrations
+		drain      bool
+		want       int
+	}{
+		{"ready", stubPinger{}, stubMigrations{}, false, http.StatusOK},
+		{"database down", stubPinger{errors.New("connection refused")}, stubMigrations{}, false, http.StatusServiceUnavailable},
+		{"migrations pending", stubPinger{}, stubMigrations{pending: []migrate.Migration{{Version: 99, Name: "next"}}}, false, http.StatusServiceUnavailable},
+		{"migrations unknown", stubPinger{}, stubMigrations{err: errors.New("no such table")}, false, http.StatusServiceUnavailable},
+		{"draining", stubPinger{}, stubMigrations{}, true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(tt.db, tt.migrations)
+			if tt.drain {
+				h.Drain()
+			}
+			r := gin.New()
+			r.GET("/readyz", h.Ready)
+			r.GET("/healthz", h.Live)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.want {
+				t.Errorf("readyz = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+
+			// Liveness does not depend on the database or on draining
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("healthz = %d, want %d", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
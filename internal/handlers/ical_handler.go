@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"agenda-api/internal/ical"
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/repository"
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Default export window when start/end are not given
+const (
+	exportDaysBefore = 90
+	exportDaysAfter  = 365
+)
+
+type ICalHandler struct {
+	eventRepo      *repository.EventRepository
+	assignmentRepo *repository.AssignmentRepository
+	userRepo       *repository.UserRepository
+	teamRepo       *repository.TeamRepository
+}
+
+func NewICalHandler(eventRepo *repository.EventRepository, assignmentRepo *repository.AssignmentRepository, userRepo *repository.UserRepository, teamRepo *repository.TeamRepository) *ICalHandler {
+	return &ICalHandler{
+		eventRepo:      eventRepo,
+		assignmentRepo: assignmentRepo,
+		userRepo:       userRepo,
+		teamRepo:       teamRepo,
+	}
+}
+
+func (h *ICalHandler) ExportCalendar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	start, end, ok := parseExportWindow(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.eventRepo.With(ctx).GetForExport(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	// The export is unauthenticated, so it must not reveal who takes part
+	h.writeCalendar(c, "Agenda", "agenda.ics", events, false)
+}
+
+func (h *ICalHandler) ExportMyCalendar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	start, end, ok := parseExportWindow(c)
+	if !ok {
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+
+	events, err := h.eventRepo.With(ctx).GetExportByUserID(userID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	h.writeCalendar(c, "My agenda", "my-agenda.ics", events, true)
+}
+
+func (h *ICalHandler) ExportTeamCalendar(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	teamID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	start, end, ok := parseExportWindow(c)
+	if !ok {
+		return
+	}
+
+	team, err := h.teamRepo.With(ctx).GetByID(teamID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+		return
+	}
+
+	events, err := h.teamEvents(ctx, teamID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	h.writeCalendar(c, team.Name, "team-"+teamID.String()+".ics", events, true)
+}
+
+// teamEvents returns the team's non-draft events within the window
+func (h *ICalHandler) teamEvents(ctx context.Context, teamID uuid.UUID, start, end time.Time) ([]models.Event, error) {
+	all, err := h.eventRepo.With(ctx).GetByTeamID(teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []models.Event
+	for _, event := range all {
+		if event.Status == models.EventStatusDraft || !event.StartsAt.Before(end) {
+			continue
+		}
+		if event.RecurrenceRule == nil && event.StartsAt.Before(start) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// writeCalendar answers with events as an iCalendar file. Organizer and
+// attendee email addresses are only written when participants is set.
+func (h *ICalHandler) writeCalendar(c *gin.Context, name, filename string, events []models.Event, participants bool) {
+	ctx := c.Request.Context()
+
+	entries, err := h.buildEntries(ctx, events, participants)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build calendar"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, name, entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build calendar"})
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// buildEntries loads exceptions for events in batch, and organizers and
+// attendees too when participants is set
+func (h *ICalHandler) buildEntries(ctx context.Context, events []models.Event, participants bool) ([]ical.Entry, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	eventIDs := make([]uuid.UUID, len(events))
+	creatorIDs := make([]uuid.UUID, 0, len(events))
+	for i, event := range events {
+		eventIDs[i] = event.ID
+		creatorIDs = append(creatorIDs, event.CreatedBy)
+	}
+
+	organizers := make(map[uuid.UUID]models.User)
+	attendees := make(map[uuid.UUID][]models.EventAssignmentWithDetails)
+	if participants {
+		creators, err := h.userRepo.With(ctx).GetByIDs(creatorIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, creator := range creators {
+			organizers[creator.ID] = creator
+		}
+
+		assignments, err := h.assignmentRepo.With(ctx).GetByEventIDs(eventIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, assignment := range assignments {
+			attendees[assignment.EventID] = append(attendees[assignment.EventID], assignment)
+		}
+	}
+
+	exceptions, err := h.eventRepo.With(ctx).GetExceptions(eventIDs)
+	if err != nil {
+		return nil, err
+	}
+	exceptionsByEvent := groupExceptions(exceptions)
+
+	entries := make([]ical.Entry, 0, len(events))
+	for _, event := range events {
+		organizer := organizers[event.CreatedBy]
+		entries = append(entries, ical.Entry{
+			Event:          event,
+			OrganizerName:  organizer.Name,
+			OrganizerEmail: organizer.Email,
+			Attendees:      attendees[event.ID],
+			Exceptions:     exceptionsByEvent[event.ID],
+		})
+	}
+	return entries, nil
+}
+
+// parseExportWindow returns the UTC instants [start, end) covered by the
+// inclusive start and end dates
+func parseExportWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -exportDaysBefore)
+	end := today.AddDate(0, 0, exportDaysAfter)
+
+	if s := c.Query("start"); s != "" {
+		parsed, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format. Use YYYY-MM-DD"})
+			return start, end, false
+		}
+		start = parsed
+	}
+
+	if e := c.Query("end"); e != "" {
+		parsed, err := time.Parse("2006-01-02", e)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format. Use YYYY-MM-DD"})
+			return start, end, false
+		}
+		end = parsed.AddDate(0, 0, 1)
+	}
+
+	return start, end, true
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"agenda-api/internal/keyset"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *keyset.Set
+}
+
+func NewJWKSHandler(keys *keyset.Set) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// Serve publishes the public signing keys; verifiers should refetch when they
+// see an unknown kid, so the document is only cached briefly
+func (h *JWKSHandler) Serve(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(keyset.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, gin.H{"keys": h.keys.JWKS()})
+}
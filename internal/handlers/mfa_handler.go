@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/repository"
+	"agenda-api/internal/token"
+	"agenda-api/internal/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const recoveryCodeCount = 10
+
+type MFAHandler struct {
+	userRepo *repository.UserRepository
+	mfaRepo  *repository.MFARepository
+	issuer   string
+}
+
+func NewMFAHandler(userRepo *repository.UserRepository, mfaRepo *repository.MFARepository, issuer string) *MFAHandler {
+	return &MFAHandler{userRepo: userRepo, mfaRepo: mfaRepo, issuer: issuer}
+}
+
+func (h *MFAHandler) Status(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	remaining := 0
+	if user.TOTPEnabledAt != nil {
+		count, err := h.mfaRepo.With(ctx).CountRecoveryCodes(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count recovery codes"})
+			return
+		}
+		remaining = count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                user.TOTPEnabledAt != nil,
+		"enabledAt":              user.TOTPEnabledAt,
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+// Enroll generates a new TOTP secret. It only takes effect once a code from
+// it is confirmed.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := h.mfaRepo.With(ctx).SetPendingSecret(user.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrolment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":          secret,
+		"provisioningUri": totp.URI(h.issuer, user.Email, secret),
+	})
+}
+
+// Confirm enables two-factor authentication with a code from the enrolled
+// secret and returns the recovery codes, which are only shown this once
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start an enrolment first"})
+		return
+	}
+
+	step, valid := totp.Validate(*user.TOTPSecret, strings.TrimSpace(input.Code), time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if err := h.mfaRepo.With(ctx).EnableTOTP(user.ID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// Disable turns two-factor authentication off; it takes the password and a
+// current code so a stolen session alone cannot do it
+func (h *MFAHandler) Disable(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.DisableTOTPInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if !h.checkCode(c, user, input.Code) {
+		return
+	}
+
+	if err := h.mfaRepo.With(ctx).DisableTOTP(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !h.checkCode(c, user, input.Code) {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if err := h.mfaRepo.With(ctx).ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (h *MFAHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	ctx := c.Request.Context()
+
+	user, err := h.userRepo.With(ctx).GetByID(middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *MFAHandler) checkCode(c *gin.Context, user *models.User, code string) bool {
+	ctx := c.Request.Context()
+
+	ok, err := verifySecondFactor(h.mfaRepo.With(ctx), user, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor accepts a TOTP code that was not used before or an
+// unused recovery code, spending it
+func verifySecondFactor(mfaRepo *repository.MFARepository, user *models.User, code string) (bool, error) {
+	if user.TOTPEnabledAt == nil || user.TOTPSecret == nil {
+		return false, nil
+	}
+
+	code = strings.TrimSpace(code)
+	if isDigits(code) {
+		step, ok := totp.Validate(*user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return mfaRepo.UseStep(user.ID, step)
+	}
+
+	return mfaRepo.UseRecoveryCode(user.ID, token.Hash(normalizeRecoveryCode(code)))
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx and the hashes
+// to store for them
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = token.Hash(code)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"agenda-api/internal/models"
+	"agenda-api/internal/recurrence"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// parseOccurrence validates an occurrence date of a recurring event. It returns
+// nil when no date was given; the bool is false once an error response was written.
+func parseOccurrence(c *gin.Context, event *models.Event, value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+
+	if event.RecurrenceRule == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event is not recurring"})
+		return nil, false
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid occurrence date format. Use YYYY-MM-DD"})
+		return nil, false
+	}
+
+	ok, err := recurrence.IsOccurrence(*event.RecurrenceRule, event.StartsAt.In(event.Zone()), date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expand recurrence"})
+		return nil, false
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date is not an occurrence of this event"})
+		return nil, false
+	}
+
+	return &date, true
+}
+
+// requireOccurrence is parseOccurrence for actions that must target a single
+// occurrence when the event is recurring.
+func requireOccurrence(c *gin.Context, event *models.Event, value string) (*time.Time, bool) {
+	occurrenceDate, ok := parseOccurrence(c, event, value)
+	if ok && event.RecurrenceRule != nil && occurrenceDate == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "occurrence query parameter is required for recurring events"})
+		return nil, false
+	}
+	return occurrenceDate, ok
+}
+
+func occurrenceKey(eventID uuid.UUID, date time.Time) string {
+	return eventID.String() + "/" + date.Format("2006-01-02")
+}
+
+func groupExceptions(exceptions []models.EventException) map[uuid.UUID][]models.EventException {
+	grouped := make(map[uuid.UUID][]models.EventException)
+	for _, exception := range exceptions {
+		grouped[exception.EventID] = append(grouped[exception.EventID], exception)
+	}
+	return grouped
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"agenda-api/internal/models"
+	"agenda-api/internal/oidc"
+	"agenda-api/internal/repository"
+	"agenda-api/internal/token"
+	"database/sql"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcLoginTTL is how long a user has to sign in at the identity provider
+const oidcLoginTTL = 10 * time.Minute
+
+// OIDCHandler signs users in through the company identity provider and
+// starts the same sessions as a password login
+type OIDCHandler struct {
+	auth         *AuthHandler
+	userRepo     *repository.UserRepository
+	tokenRepo    *repository.TokenRepository
+	identityRepo *repository.IdentityRepository
+	provider     *oidc.Provider
+	// Members of this group are admins, everyone else a user; empty leaves roles alone
+	adminGroup string
+}
+
+func NewOIDCHandler(auth *AuthHandler, userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, identityRepo *repository.IdentityRepository, provider *oidc.Provider, adminGroup string) *OIDCHandler {
+	return &OIDCHandler{
+		auth:         auth,
+		userRepo:     userRepo,
+		tokenRepo:    tokenRepo,
+		identityRepo: identityRepo,
+		provider:     provider,
+		adminGroup:   adminGroup,
+	}
+}
+
+// Start returns the provider URL to send the browser to. The frontend keeps
+// the state and posts it back with the code to Callback.
+func (h *OIDCHandler) Start(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	state, stateHash, err := token.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	nonce, _, err := token.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+
+	authURL, err := h.provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Failed to reach identity provider: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	login := &models.OIDCLogin{
+		ID:           uuid.New(),
+		StateHash:    stateHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+		CreatedAt:    time.Now(),
+	}
+	if err := h.identityRepo.With(ctx).CreateLogin(login); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorizationUrl": authURL,
+		"state":            state,
+		"expiresIn":        int(oidcLoginTTL.Seconds()),
+	})
+}
+
+// Callback redeems the code the provider redirected back with. The provider's
+// sign-in stands in for the password only: accounts with two-factor
+// authentication get the same TOTP challenge as a password login, and admins
+// without it get user rights when RequireAdminMFA is set, however they sign in.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input models.OIDCCallbackInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	login, err := h.identityRepo.With(ctx).ConsumeLogin(token.Hash(input.State))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sign-in"})
+		return
+	}
+
+	identity, err := h.provider.Exchange(c.Request.Context(), input.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("Identity provider sign-in failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in with the identity provider failed"})
+		return
+	}
+
+	user, ok := h.resolveUser(c, identity)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	if err := h.auth.grantBootstrapAdmin(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admins"})
+		return
+	}
+
+	if !h.applyGroups(c, user, identity) {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		h.auth.startChallenge(c, user)
+		return
+	}
+
+	h.auth.issueTokens(c, http.StatusOK, user, uuid.New())
+}
+
+// resolveUser finds the account linked to the identity. Unknown identities
+// are linked to the account with the same email when the provider verified
+// that address, and get a new account otherwise.
+func (h *OIDCHandler) resolveUser(c *gin.Context, identity *oidc.Identity) (*models.User, bool) {
+	ctx := c.Request.Context()
+
+	userID, err := h.identityRepo.With(ctx).GetUserID(identity.Issuer, identity.Subject)
+	if err == nil {
+		user, err := h.userRepo.With(ctx).GetByID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return nil, false
+		}
+		return user, true
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identity"})
+		return nil, false
+	}
+
+	if identity.Email == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The identity provider did not share an email address"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.With(ctx).GetByEmail(identity.Email)
+	if err == nil {
+		// Linking on an unverified address would hand the account to whoever
+		// claims it at the provider
+		if !identity.EmailVerified {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Sign in with your password"})
+			return nil, false
+		}
+		if err := h.identityRepo.With(ctx).Link(user.ID, identity.Issuer, identity.Subject); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+			return nil, false
+		}
+		if user.EmailVerifiedAt == nil {
+			if err := h.userRepo.With(ctx).MarkEmailVerified(user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+				return nil, false
+			}
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+		return user, true
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user"})
+		return nil, false
+	}
+
+	return h.provision(c, identity)
+}
+
+func (h *OIDCHandler) provision(c *gin.Context, identity *oidc.Identity) (*models.User, bool) {
+	ctx := c.Request.Context()
+
+	// Accounts from the provider have no usable password; one can still be
+	// set through the password reset flow
+	secret, _, err := token.Generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return nil, false
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return nil, false
+	}
+
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:        uuid.New(),
+		Email:     identity.Email,
+		Password:  string(hashedPassword),
+		Name:      name,
+		Role:      models.RoleUser,
+		TimeZone:  "UTC",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if identity.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := h.identityRepo.With(ctx).Provision(user, identity.Issuer, identity.Subject); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// applyGroups makes the provider's admin group authoritative for the admin
+// role; a demoted user's existing sessions are revoked
+func (h *OIDCHandler) applyGroups(c *gin.Context, user *models.User, identity *oidc.Identity) bool {
+	ctx := c.Request.Context()
+
+	if h.adminGroup == "" {
+		return true
+	}
+
+	role := models.RoleUser
+	if slices.Contains(identity.Groups, h.adminGroup) {
+		role = models.RoleAdmin
+	}
+	if role == user.Role {
+		return true
+	}
+
+	if err := h.userRepo.With(ctx).UpdateRole(user.ID, role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return false
+	}
+	if user.Role == models.RoleAdmin {
+		if err := h.tokenRepo.With(ctx).RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return false
+		}
+	}
+	user.Role = role
+	return true
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"agenda-api/internal/keyset"
+	"agenda-api/internal/lockout"
+	"agenda-api/internal/mailer"
+	"agenda-api/internal/models"
+	"agenda-api/internal/oidc"
+	"agenda-api/internal/oidc/oidctest"
+	"agenda-api/internal/repository"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const testAdminGroup = "agenda-admins"
+
+type oidcTest struct {
+	t        *testing.T
+	db       *sqlx.DB
+	idp      *oidctest.Server
+	router   *gin.Engine
+	userRepo *repository.UserRepository
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db := testDB(t)
+
+	idp, err := oidctest.NewServer("agenda")
+	if err != nil {
+		t.Fatalf("oidctest.NewServer: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	keys, err := keyset.New(keyset.Options{Algorithm: "HS256", Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("keyset.New: %v", err)
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	policy := lockout.Policy{Threshold: 5, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour}
+	guard := lockout.NewGuard(lockout.NewMemoryStore(time.Hour), policy, policy, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	auth := NewAuthHandler(userRepo, tokenRepo, repository.NewMFARepository(db), guard, mailer.NewLogMailer(io.Discard), AuthConfig{
+		Keys:            keys,
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	})
+	provider := oidc.New(oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "agenda",
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}, http.DefaultClient)
+	h := NewOIDCHandler(auth, userRepo, tokenRepo, repository.NewIdentityRepository(db), provider, testAdminGroup)
+
+	r := gin.New()
+	r.POST("/oidc/start", h.Start)
+	r.POST("/oidc/callback", h.Callback)
+
+	return &oidcTest{t: t, db: db, idp: idp, router: r, userRepo: userRepo}
+}
+
+// uniqueUser returns a provider account whose email no other test uses
+func uniqueUser(verified bool, groups ...string) oidctest.User {
+	id := uuid.NewString()
+	return oidctest.User{
+		Subject:       id,
+		Email:         id + "@example.com",
+		EmailVerified: verified,
+		Name:          "SSO user",
+		Groups:        groups,
+	}
+}
+
+// signIn runs the whole flow for user and returns the callback response
+func (o *oidcTest) signIn(user oidctest.User) *httptest.ResponseRecorder {
+	o.t.Helper()
+
+	start := o.post("/oidc/start", nil)
+	if start.Code != http.StatusOK {
+		o.t.Fatalf("start: status %d: %s", start.Code, start.Body)
+	}
+	var started struct {
+		AuthorizationURL string `json:"authorizationUrl"`
+		State            string `json:"state"`
+	}
+	if err := json.Unmarshal(start.Body.Bytes(), &started); err != nil {
+		o.t.Fatalf("start: %v", err)
+	}
+
+	code, err := o.idp.Authorize(started.AuthorizationURL, user)
+	if err != nil {
+		o.t.Fatalf("Authorize: %v", err)
+	}
+
+	o.t.Cleanup(func() {
+		o.db.Exec(`DELETE FROM users WHERE email = $1`, user.Email)
+	})
+	return o.post("/oidc/callback", gin.H{"code": code, "state": started.State})
+}
+
+func (o *oidcTest) post(path string, body interface{}) *httptest.ResponseRecorder {
+	o.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+// sessionUser returns the user of a successful sign-in
+func (o *oidcTest) sessionUser(w *httptest.ResponseRecorder) models.UserResponse {
+	o.t.Helper()
+
+	if w.Code != http.StatusOK {
+		o.t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+	}
+	var session struct {
+		User  models.UserResponse `json:"user"`
+		Token string              `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil {
+		o.t.Fatalf("callback: %v", err)
+	}
+	if session.Token == "" {
+		o.t.Fatal("callback: no access token")
+	}
+	return session.User
+}
+
+func TestOIDCProvisionsNewUsers(t *testing.T) {
+	o := newOIDCTest(t)
+
+	idpUser := uniqueUser(true)
+	user := o.sessionUser(o.signIn(idpUser))
+
+	if user.Email != idpUser.Email || user.Name != idpUser.Name {
+		t.Errorf("user = %s <%s>, want %s <%s>", user.Name, user.Email, idpUser.Name, idpUser.Email)
+	}
+	if user.Role != models.RoleUser {
+		t.Errorf("role = %s, want %s", user.Role, models.RoleUser)
+	}
+
+	stored, err := o.userRepo.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.EmailVerifiedAt == nil {
+		t.Error("email not marked verified although the provider verified it")
+	}
+
+	// Signing in again reuses the account through the linked identity
+	if again := o.sessionUser(o.signIn(idpUser)); again.ID != user.ID {
+		t.Errorf("second sign-in as %s, want %s", again.ID, user.ID)
+	}
+}
+
+func TestOIDCLinksExistingAccounts(t *testing.T) {
+	o := newOIDCTest(t)
+
+	idpUser := uniqueUser(true)
+	now := time.Now()
+	existing := &models.User{
+		ID:        uuid.New(),
+		Email:     idpUser.Email,
+		Name:      "Password user",
+		Role:      models.RoleUser,
+		TimeZone:  "UTC",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := o.userRepo.Create(existing); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if user := o.sessionUser(o.signIn(idpUser)); user.ID != existing.ID {
+		t.Errorf("signed in as %s, want the existing account %s", user.ID, existing.ID)
+	}
+}
+
+func TestOIDCDoesNotLinkUnverifiedEmails(t *testing.T) {
+	o := newOIDCTest(t)
+
+	idpUser := uniqueUser(false)
+	now := time.Now()
+	existing := &models.User{
+		ID:        uuid.New(),
+		Email:     idpUser.Email,
+		Name:      "Password user",
+		Role:      models.RoleUser,
+		TimeZone:  "UTC",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := o.userRepo.Create(existing); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if w := o.signIn(idpUser); w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+}
+
+func TestOIDCMapsAdminGroup(t *testing.T) {
+	o := newOIDCTest(t)
+
+	idpUser := uniqueUser(true, "staff", testAdminGroup)
+	user := o.sessionUser(o.signIn(idpUser))
+	if user.Role != models.RoleAdmin {
+		t.Fatalf("role in the admin group = %s, want %s", user.Role, models.RoleAdmin)
+	}
+
+	// Leaving the group at the provider demotes on the next sign-in
+	idpUser.Groups = []string{"staff"}
+	user = o.sessionUser(o.signIn(idpUser))
+	if user.Role != models.RoleUser {
+		t.Errorf("role after leaving the admin group = %s, want %s", user.Role, models.RoleUser)
+	}
+}
+
+func TestOIDCChallengesAccountsWithTOTP(t *testing.T) {
+	o := newOIDCTest(t)
+
+	idpUser := uniqueUser(true)
+	user := o.sessionUser(o.signIn(idpUser))
+	if _, err := o.db.Exec(`UPDATE users SET totp_secret = 'JBSWY3DPEHPK3PXP', totp_enabled_at = $1 WHERE id = $2`, time.Now(), user.ID); err != nil {
+		t.Fatalf("enable TOTP: %v", err)
+	}
+
+	w := o.signIn(idpUser)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var challenge struct {
+		MFARequired bool   `json:"mfaRequired"`
+		Challenge   string `json:"challenge"`
+		Token       string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &challenge); err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if !challenge.MFARequired || challenge.Challenge == "" || challenge.Token != "" {
+		t.Errorf("response = %s, want a TOTP challenge instead of a session", w.Body)
+	}
+}
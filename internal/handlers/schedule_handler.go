@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"agenda-api/internal/repository"
+	"context"
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// Longest window a free/busy query may cover
+	maxScheduleDays = 62
+	// Granularity of suggested slot start times
+	slotStep         = 15 * time.Minute
+	defaultSlotCount = 5
+	maxSlotCount     = 50
+)
+
+type ScheduleHandler struct {
+	eventRepo        *repository.EventRepository
+	userRepo         *repository.UserRepository
+	teamRepo         *repository.TeamRepository
+	availabilityRepo *repository.AvailabilityRepository
+	authz            *policy.Policy
+}
+
+func NewScheduleHandler(eventRepo *repository.EventRepository, userRepo *repository.UserRepository, teamRepo *repository.TeamRepository, availabilityRepo *repository.AvailabilityRepository, authz *policy.Policy) *ScheduleHandler {
+	return &ScheduleHandler{
+		eventRepo:        eventRepo,
+		userRepo:         userRepo,
+		teamRepo:         teamRepo,
+		availabilityRepo: availabilityRepo,
+		authz:            authz,
+	}
+}
+
+type dayHours struct {
+	start time.Time
+	end   time.Time
+}
+
+// workingHours is the part of each weekday, in the user's own zone, in which
+// meetings may be suggested. Missing weekdays are days off.
+type workingHours map[time.Weekday]dayHours
+
+// contains reports whether [start, end) falls within working hours on one day in loc
+func (w workingHours) contains(start, end time.Time, loc *time.Location) bool {
+	local := start.In(loc)
+	hours, ok := w[local.Weekday()]
+	if !ok {
+		return false
+	}
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), hours.start.Hour(), hours.start.Minute(), 0, 0, loc)
+	dayEnd := time.Date(local.Year(), local.Month(), local.Day(), hours.end.Hour(), hours.end.Minute(), 0, 0, loc)
+	return !start.Before(dayStart) && !end.After(dayEnd)
+}
+
+// FreeBusy returns the busy intervals of each requested user within the window
+func (h *ScheduleHandler) FreeBusy(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	users, start, end, ok := h.parseScheduleQuery(c)
+	if !ok {
+		return
+	}
+
+	busy, err := h.busyIntervals(ctx, users, start, end, middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch busy times"})
+		return
+	}
+
+	response := make([]models.UserFreeBusy, 0, len(users))
+	for _, user := range users {
+		intervals := busy[user.ID]
+		if intervals == nil {
+			intervals = []models.BusyInterval{}
+		}
+		response = append(response, models.UserFreeBusy{
+			UserID:   user.ID,
+			UserName: user.Name,
+			TimeZone: user.TimeZone,
+			Busy:     intervals,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"start": start,
+		"end":   end,
+		"users": response,
+	})
+}
+
+// SuggestSlots returns the best windows of the requested duration in which all
+// users, or at least quorum of them, are free and within working hours
+func (h *ScheduleHandler) SuggestSlots(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	users, start, end, ok := h.parseScheduleQuery(c)
+	if !ok {
+		return
+	}
+
+	duration, err := strconv.Atoi(c.Query("duration"))
+	if err != nil || duration <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive number of minutes"})
+		return
+	}
+
+	limit := defaultSlotCount
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxSlotCount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50"})
+			return
+		}
+	}
+
+	quorum := len(users)
+	if q := c.Query("quorum"); q != "" {
+		quorum, err = strconv.Atoi(q)
+		if err != nil || quorum < 1 || quorum > len(users) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quorum must be between 1 and the number of users"})
+			return
+		}
+	}
+
+	defaults, ok := parseWorkingHours(c)
+	if !ok {
+		return
+	}
+
+	hours, err := h.workingHoursByUser(ctx, users, defaults)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch working hours"})
+		return
+	}
+
+	busy, err := h.busyIntervals(ctx, users, start, end, uuid.Nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch busy times"})
+		return
+	}
+
+	slots := suggestSlots(users, busy, hours, start, end, time.Duration(duration)*time.Minute, quorum, limit)
+	c.JSON(http.StatusOK, slots)
+}
+
+// parseScheduleQuery resolves the users and window of a free/busy request.
+// Users come from a comma-separated users parameter and/or a teamId.
+func (h *ScheduleHandler) parseScheduleQuery(c *gin.Context) ([]models.User, time.Time, time.Time, bool) {
+	ctx := c.Request.Context()
+
+	var ids []uuid.UUID
+	if s := c.Query("users"); s != "" {
+		for _, part := range strings.Split(s, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(part))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+				return nil, time.Time{}, time.Time{}, false
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if s := c.Query("teamId"); s != "" {
+		teamID, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			return nil, time.Time{}, time.Time{}, false
+		}
+		members, ok := h.teamMembers(c, teamID)
+		if !ok {
+			return nil, time.Time{}, time.Time{}, false
+		}
+		ids = append(ids, members...)
+	}
+
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "users or teamId query parameter is required"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	users, err := h.userRepo.With(ctx).GetByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+	if len(users) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Users not found"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+
+	loc, ok := calendarZone(c, time.UTC)
+	if !ok {
+		return nil, time.Time{}, time.Time{}, false
+	}
+	start, end, ok := parseCalendarRange(c, loc)
+	if !ok {
+		return nil, time.Time{}, time.Time{}, false
+	}
+	if !end.After(start) || end.Sub(start) > maxScheduleDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Window must cover between 1 and 62 days"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	return users, start, end, true
+}
+
+// teamMembers returns the member IDs of a team the current user may see
+func (h *ScheduleHandler) teamMembers(c *gin.Context, teamID uuid.UUID) ([]uuid.UUID, bool) {
+	ctx := c.Request.Context()
+
+	if _, err := h.teamRepo.With(ctx).GetByID(teamID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team"})
+		return nil, false
+	}
+
+	if !authorize(c, h.authz, policy.View, policy.Team(teamID), "You are not a member of this team") {
+		return nil, false
+	}
+
+	members, err := h.teamRepo.With(ctx).GetMembers(teamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch team members"})
+		return nil, false
+	}
+
+	ids := make([]uuid.UUID, len(members))
+	for i, member := range members {
+		ids[i] = member.UserID
+	}
+	return ids, true
+}
+
+// workingHoursByUser returns each user's own working hours, or defaults for
+// users who have not set any
+func (h *ScheduleHandler) workingHoursByUser(ctx context.Context, users []models.User, defaults workingHours) (map[uuid.UUID]workingHours, error) {
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	rows, err := h.availabilityRepo.With(ctx).GetWorkingHoursByUserIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[uuid.UUID]workingHours, len(users))
+	for _, row := range rows {
+		start, err := parseClockTime(row.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClockTime(row.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if byUser[row.UserID] == nil {
+			byUser[row.UserID] = workingHours{}
+		}
+		byUser[row.UserID][time.Weekday(row.Weekday)] = dayHours{start: start, end: end}
+	}
+
+	for _, user := range users {
+		if byUser[user.ID] == nil {
+			byUser[user.ID] = defaults
+		}
+	}
+	return byUser, nil
+}
+
+// busyIntervals returns each user's bookings and out-of-office blocks within
+// [start, end). Details are only filled in for viewer's own bookings and
+// events viewer created.
+func (h *ScheduleHandler) busyIntervals(ctx context.Context, users []models.User, start, end time.Time, viewer uuid.UUID) (map[uuid.UUID][]models.BusyInterval, error) {
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	busy, err := busyByUser(h.eventRepo.With(ctx), ids, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := h.availabilityRepo.With(ctx).GetOutOfOfficeByUserIDs(ids, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	intervals := make(map[uuid.UUID][]models.BusyInterval, len(users))
+	for userID, events := range busy {
+		for _, event := range events {
+			interval := models.BusyInterval{StartsAt: event.StartsAt, EndsAt: event.EndsAt}
+			if viewer != uuid.Nil && (userID == viewer || event.CreatedBy == viewer) {
+				eventID, title := event.ID, event.Title
+				interval.EventID = &eventID
+				interval.Title = &title
+			}
+			intervals[userID] = append(intervals[userID], interval)
+		}
+	}
+	for i := range blocks {
+		interval := models.BusyInterval{StartsAt: blocks[i].StartsAt, EndsAt: blocks[i].EndsAt}
+		if viewer != uuid.Nil && blocks[i].UserID == viewer {
+			title := outOfOfficeReason(&blocks[i])
+			interval.Title = &title
+		}
+		intervals[blocks[i].UserID] = append(intervals[blocks[i].UserID], interval)
+	}
+
+	for _, userIntervals := range intervals {
+		sort.Slice(userIntervals, func(i, j int) bool {
+			return userIntervals[i].StartsAt.Before(userIntervals[j].StartsAt)
+		})
+	}
+	return intervals, nil
+}
+
+// suggestSlots scores every slotStep-aligned window of duration in [start, end)
+// and returns up to limit non-overlapping ones, most available users first
+func suggestSlots(users []models.User, busy map[uuid.UUID][]models.BusyInterval, hours map[uuid.UUID]workingHours, start, end time.Time, duration time.Duration, quorum, limit int) []models.SuggestedSlot {
+	// Never suggest a time that has already started
+	if now := time.Now(); start.Before(now) {
+		start = now.Truncate(slotStep).Add(slotStep)
+	}
+
+	zones := make(map[uuid.UUID]*time.Location, len(users))
+	for i := range users {
+		zones[users[i].ID] = users[i].Zone()
+	}
+
+	var candidates []models.SuggestedSlot
+	for slotStart := start; !slotStart.Add(duration).After(end); slotStart = slotStart.Add(slotStep) {
+		slotEnd := slotStart.Add(duration)
+		slot := models.SuggestedSlot{
+			StartsAt:    slotStart,
+			EndsAt:      slotEnd,
+			Available:   []uuid.UUID{},
+			Unavailable: []uuid.UUID{},
+		}
+		for _, user := range users {
+			if hours[user.ID].contains(slotStart, slotEnd, zones[user.ID]) && isFree(busy[user.ID], slotStart, slotEnd) {
+				slot.Available = append(slot.Available, user.ID)
+			} else {
+				slot.Unavailable = append(slot.Unavailable, user.ID)
+			}
+		}
+		if len(slot.Available) >= quorum {
+			candidates = append(candidates, slot)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].Available) > len(candidates[j].Available)
+	})
+
+	slots := []models.SuggestedSlot{}
+	for _, candidate := range candidates {
+		if len(slots) == limit {
+			break
+		}
+		overlapping := false
+		for _, picked := range slots {
+			if candidate.StartsAt.Before(picked.EndsAt) && picked.StartsAt.Before(candidate.EndsAt) {
+				overlapping = true
+				break
+			}
+		}
+		if !overlapping {
+			slots = append(slots, candidate)
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].StartsAt.Before(slots[j].StartsAt)
+	})
+	return slots
+}
+
+func isFree(busy []models.BusyInterval, start, end time.Time) bool {
+	for _, interval := range busy {
+		if interval.StartsAt.Before(end) && start.Before(interval.EndsAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseWorkingHours reads the working hours used for users who have not set
+// their own: dayStart and dayEnd (HH:MM, default 09:00-17:00) and the
+// comma-separated weekdays (default MO-FR)
+func parseWorkingHours(c *gin.Context) (workingHours, bool) {
+	hours := workingHours{}
+
+	start, err := time.Parse("15:04", c.DefaultQuery("dayStart", "09:00"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dayStart format. Use HH:MM"})
+		return hours, false
+	}
+	end, err := time.Parse("15:04", c.DefaultQuery("dayEnd", "17:00"))
+	if err != nil || !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dayEnd. Use HH:MM after dayStart"})
+		return hours, false
+	}
+
+	weekdays := map[string]time.Weekday{
+		"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+		"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+	}
+	for _, day := range strings.Split(c.DefaultQuery("days", "MO,TU,WE,TH,FR"), ",") {
+		weekday, ok := weekdays[strings.ToUpper(strings.TrimSpace(day))]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days value. Use MO,TU,WE,TH,FR,SA,SU"})
+			return hours, false
+		}
+		hours[weekday] = dayHours{start: start, end: end}
+	}
+
+	return hours, true
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"agenda-api/internal/middleware"
 	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
 	"agenda-api/internal/repository"
 	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
@@ -13,21 +15,29 @@ import (
 )
 
 type TeamHandler struct {
-	teamRepo *repository.TeamRepository
-	userRepo *repository.UserRepository
+	teamRepo             *repository.TeamRepository
+	userRepo             *repository.UserRepository
+	authz                *policy.Policy
+	requireVerifiedEmail bool
 }
 
-func NewTeamHandler(teamRepo *repository.TeamRepository, userRepo *repository.UserRepository) *TeamHandler {
-	return &TeamHandler{teamRepo: teamRepo, userRepo: userRepo}
+func NewTeamHandler(teamRepo *repository.TeamRepository, userRepo *repository.UserRepository, authz *policy.Policy, requireVerifiedEmail bool) *TeamHandler {
+	return &TeamHandler{teamRepo: teamRepo, userRepo: userRepo, authz: authz, requireVerifiedEmail: requireVerifiedEmail}
 }
 
 func (h *TeamHandler) Create(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	var input models.CreateTeamInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !authorize(c, h.authz, policy.Create, policy.NewTeam, "You cannot create teams") {
+		return
+	}
+
 	userID := middleware.GetUserID(c)
 
 	team := &models.Team{
@@ -39,7 +49,7 @@ func (h *TeamHandler) Create(c *gin.Context) {
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := h.teamRepo.Create(team); err != nil {
+	if err := h.teamRepo.With(ctx).Create(team); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
 		return
 	}
@@ -47,8 +57,21 @@ func (h *TeamHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, team)
 }
 
+// GetAll lists every team to those allowed to see them all, admins, and the
+// teams they belong to to everyone else
 func (h *TeamHandler) GetAll(c *gin.Context) {
-	teams, err := h.teamRepo.GetAll()
+	ctx := c.Request.Context()
+
+	subject := middleware.GetSubject(c)
+
+	var teams []models.Team
+	err := h.authz.Authorize(subject, policy.View, policy.AllTeams)
+	switch err {
+	case nil:
+		teams, err = h.teamRepo.With(ctx).GetAll()
+	case policy.ErrNotFound, policy.ErrForbidden:
+		teams, err = h.teamRepo.With(ctx).GetByMemberUserID(subject.UserID)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
 		return
@@ -62,13 +85,15 @@ func (h *TeamHandler) GetAll(c *gin.Context) {
 }
 
 func (h *TeamHandler) GetByID(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
 		return
 	}
 
-	team, err := h.teamRepo.GetByID(id)
+	team, err := h.teamRepo.With(ctx).GetByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
@@ -82,13 +107,15 @@ func (h *TeamHandler) GetByID(c *gin.Context) {
 }
 
 func (h *TeamHandler) Update(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
 		return
 	}
 
-	team, err := h.teamRepo.GetByID(id)
+	team, err := h.teamRepo.With(ctx).GetByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
@@ -111,7 +138,7 @@ func (h *TeamHandler) Update(c *gin.Context) {
 		team.Description = *input.Description
 	}
 
-	if err := h.teamRepo.Update(team); err != nil {
+	if err := h.teamRepo.With(ctx).Update(team); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update team"})
 		return
 	}
@@ -120,13 +147,15 @@ func (h *TeamHandler) Update(c *gin.Context) {
 }
 
 func (h *TeamHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
 		return
 	}
 
-	if err := h.teamRepo.Delete(id); err != nil {
+	if err := h.teamRepo.With(ctx).Delete(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
 		return
 	}
@@ -135,6 +164,8 @@ func (h *TeamHandler) Delete(c *gin.Context) {
 }
 
 func (h *TeamHandler) AddMember(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	teamID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
@@ -148,7 +179,7 @@ func (h *TeamHandler) AddMember(c *gin.Context) {
 	}
 
 	// Verify team exists
-	_, err = h.teamRepo.GetByID(teamID)
+	_, err = h.teamRepo.With(ctx).GetByID(teamID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
@@ -159,7 +190,7 @@ func (h *TeamHandler) AddMember(c *gin.Context) {
 	}
 
 	// Verify user exists
-	_, err = h.userRepo.GetByID(input.UserID)
+	user, err := h.userRepo.With(ctx).GetByID(input.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -169,8 +200,13 @@ func (h *TeamHandler) AddMember(c *gin.Context) {
 		return
 	}
 
+	if h.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User must verify their email first"})
+		return
+	}
+
 	// Check if already a member
-	isMember, err := h.teamRepo.IsMember(teamID, input.UserID)
+	isMember, err := h.teamRepo.With(ctx).IsMember(teamID, input.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
 		return
@@ -180,14 +216,24 @@ func (h *TeamHandler) AddMember(c *gin.Context) {
 		return
 	}
 
+	// Managers can only add plain members
+	if input.Role == "" {
+		input.Role = models.TeamRoleMember
+	}
+	if input.Role != models.TeamRoleMember &&
+		!authorize(c, h.authz, policy.ManageRoles, policy.Team(teamID), "Only team owners can add managers or owners") {
+		return
+	}
+
 	member := &models.TeamMember{
 		ID:        uuid.New(),
 		TeamID:    teamID,
 		UserID:    input.UserID,
+		Role:      input.Role,
 		CreatedAt: time.Now(),
 	}
 
-	if err := h.teamRepo.AddMember(member); err != nil {
+	if err := h.teamRepo.With(ctx).AddMember(member); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
 		return
 	}
@@ -196,6 +242,8 @@ func (h *TeamHandler) AddMember(c *gin.Context) {
 }
 
 func (h *TeamHandler) RemoveMember(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	teamID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
@@ -208,7 +256,33 @@ func (h *TeamHandler) RemoveMember(c *gin.Context) {
 		return
 	}
 
-	if err := h.teamRepo.RemoveMember(teamID, userID); err != nil {
+	memberRole, ok := h.memberRole(c, teamID, userID)
+	if !ok {
+		return
+	}
+
+	// Members can leave on their own; removing others takes a manager, and
+	// removing managers or owners takes an owner
+	switch {
+	case userID == middleware.GetUserID(c):
+		if !authorize(c, h.authz, policy.Leave, policy.Team(teamID), "You are not a member of this team") {
+			return
+		}
+	case memberRole != models.TeamRoleMember:
+		if !authorize(c, h.authz, policy.ManageRoles, policy.Team(teamID), "Only team owners can remove managers or owners") {
+			return
+		}
+	default:
+		if !authorize(c, h.authz, policy.ManageMembers, policy.Team(teamID), "Only team owners and managers can remove members") {
+			return
+		}
+	}
+
+	if err := h.teamRepo.With(ctx).RemoveMember(teamID, userID); err != nil {
+		if errors.Is(err, repository.ErrLastOwner) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A team needs at least one owner"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
 		return
 	}
@@ -216,14 +290,69 @@ func (h *TeamHandler) RemoveMember(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
 }
 
+// UpdateMemberRole changes a member's role in the team; owners only
+func (h *TeamHandler) UpdateMemberRole(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	teamID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input models.UpdateTeamMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := h.memberRole(c, teamID, userID); !ok {
+		return
+	}
+
+	if err := h.teamRepo.With(ctx).UpdateMemberRole(teamID, userID, input.Role); err != nil {
+		if errors.Is(err, repository.ErrLastOwner) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A team needs at least one owner"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member role updated successfully"})
+}
+
+func (h *TeamHandler) memberRole(c *gin.Context, teamID, userID uuid.UUID) (models.TeamRole, bool) {
+	ctx := c.Request.Context()
+
+	role, err := h.teamRepo.With(ctx).GetMemberRole(teamID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch member"})
+		return "", false
+	}
+	return role, true
+}
+
 func (h *TeamHandler) GetMembers(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	teamID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
 		return
 	}
 
-	members, err := h.teamRepo.GetMembers(teamID)
+	members, err := h.teamRepo.With(ctx).GetMembers(teamID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
 		return
@@ -237,9 +366,11 @@ func (h *TeamHandler) GetMembers(c *gin.Context) {
 }
 
 func (h *TeamHandler) GetMyTeams(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := middleware.GetUserID(c)
 
-	teams, err := h.teamRepo.GetByMemberUserID(userID)
+	teams, err := h.teamRepo.With(ctx).GetByMemberUserID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
 		return
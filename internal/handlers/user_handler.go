@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
+	"agenda-api/internal/lockout"
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
 	"agenda-api/internal/repository"
 
 	"github.com/gin-gonic/gin"
@@ -10,21 +15,25 @@ import (
 )
 
 type UserHandler struct {
-	userRepo *repository.UserRepository
+	userRepo  *repository.UserRepository
+	tokenRepo *repository.TokenRepository
+	guard     *lockout.Guard
 }
 
-func NewUserHandler(userRepo *repository.UserRepository) *UserHandler {
-	return &UserHandler{userRepo: userRepo}
+func NewUserHandler(userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, guard *lockout.Guard) *UserHandler {
+	return &UserHandler{userRepo: userRepo, tokenRepo: tokenRepo, guard: guard}
 }
 
 func (h *UserHandler) Search(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	query := c.Query("q")
 	if len(query) < 2 {
 		c.JSON(http.StatusOK, []interface{}{})
 		return
 	}
 
-	users, err := h.userRepo.Search(query)
+	users, err := h.userRepo.With(ctx).Search(query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching users"})
 		return
@@ -50,7 +59,9 @@ func (h *UserHandler) Search(c *gin.Context) {
 }
 
 func (h *UserHandler) GetAll(c *gin.Context) {
-	users, err := h.userRepo.GetAll()
+	ctx := c.Request.Context()
+
+	users, err := h.userRepo.With(ctx).GetAll()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
 		return
@@ -75,6 +86,8 @@ func (h *UserHandler) GetAll(c *gin.Context) {
 }
 
 func (h *UserHandler) GetByID(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
@@ -82,7 +95,7 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.GetByID(id)
+	user, err := h.userRepo.With(ctx).GetByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -90,3 +103,160 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user.ToResponse())
 }
+
+// UpdateRole promotes or demotes a user (admin only). Tokens issued with the
+// old role are revoked.
+func (h *UserHandler) UpdateRole(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.managedUser(c)
+	if !ok {
+		return
+	}
+
+	var input models.UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Role != user.Role {
+		if err := h.userRepo.With(ctx).UpdateRole(user.ID, input.Role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+			return
+		}
+		if err := h.tokenRepo.With(ctx).RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+		user.Role = input.Role
+	}
+
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// Deactivate blocks a user from logging in and revokes their tokens (admin only)
+func (h *UserHandler) Deactivate(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.managedUser(c)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt == nil {
+		now := time.Now()
+		if err := h.userRepo.With(ctx).SetDeactivated(user.ID, &now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+			return
+		}
+		if err := h.tokenRepo.With(ctx).RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+		user.DeactivatedAt = &now
+	}
+
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+func (h *UserHandler) Reactivate(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.managedUser(c)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		if err := h.userRepo.With(ctx).SetDeactivated(user.ID, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate user"})
+			return
+		}
+		user.DeactivatedAt = nil
+	}
+
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// ForcePasswordReset signs a user out everywhere; they have to choose a new
+// password at their next login (admin only)
+func (h *UserHandler) ForcePasswordReset(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.managedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.With(ctx).SetPasswordResetRequired(user.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to require password reset"})
+		return
+	}
+	if err := h.tokenRepo.With(ctx).RevokeAllForUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required at next login"})
+}
+
+// Unlock clears a login lockout of the user's account (admin only)
+func (h *UserHandler) Unlock(c *gin.Context) {
+	user, ok := h.managedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.guard.UnlockAccount(user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
+
+func (h *UserHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := h.managedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.With(ctx).Delete(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// managedUser loads the user an admin action targets. Admins cannot act on
+// their own account, which also keeps at least one active admin around.
+func (h *UserHandler) managedUser(c *gin.Context) (*models.User, bool) {
+	ctx := c.Request.Context()
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	if id == middleware.GetUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot manage your own account"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.With(ctx).GetByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return nil, false
+	}
+
+	return user, true
+}
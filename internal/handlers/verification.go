@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"agenda-api/internal/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// unverifiedUsers returns those of the given users whose email is not verified
+func unverifiedUsers(userRepo *repository.UserRepository, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	users, err := userRepo.GetByIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var unverified []uuid.UUID
+	for _, user := range users {
+		if user.EmailVerifiedAt == nil {
+			unverified = append(unverified, user.ID)
+		}
+	}
+	return unverified, nil
+}
+
+// requireVerifiedUsers rejects the request when any of the users has not
+// verified their email. The bool is false once an error response was written.
+func requireVerifiedUsers(c *gin.Context, userRepo *repository.UserRepository, userIDs []uuid.UUID) bool {
+	unverified, err := unverifiedUsers(userRepo, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return false
+	}
+	if len(unverified) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Users must verify their email first",
+			"users": unverified,
+		})
+		return false
+	}
+	return true
+}
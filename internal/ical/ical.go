@@ -0,0 +1,254 @@
+package ical
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"agenda-api/internal/models"
+	"agenda-api/internal/recurrence"
+)
+
+const (
+	productID  = "-//agenda-api//Agenda API//EN"
+	uidDomain  = "agenda-api"
+	dateLayout = "2006-01-02"
+	maxLine    = 75
+)
+
+// Entry is an event to be written as one or more VEVENTs. Attendees may contain
+// per-occurrence responses, which are written as RECURRENCE-ID overrides.
+type Entry struct {
+	Event          models.Event
+	OrganizerName  string
+	OrganizerEmail string
+	Attendees      []models.EventAssignmentWithDetails
+	Exceptions     []models.EventException
+}
+
+var eventStatuses = map[models.EventStatus]string{
+	models.EventStatusDraft:     "TENTATIVE",
+	models.EventStatusPublished: "CONFIRMED",
+	models.EventStatusCancelled: "CANCELLED",
+}
+
+var partStats = map[models.AssignmentStatus]string{
+	models.AssignmentStatusPending:  "NEEDS-ACTION",
+	models.AssignmentStatusApproved: "ACCEPTED",
+	models.AssignmentStatusRejected: "DECLINED",
+}
+
+var attendeeRoles = map[models.ParticipantRole]string{
+	models.ParticipantRoleSpeaker:     "CHAIR",
+	models.ParticipantRoleAssistant:   "REQ-PARTICIPANT",
+	models.ParticipantRoleParticipant: "OPT-PARTICIPANT",
+}
+
+// Encode writes an RFC 5545 VCALENDAR containing entries to w
+func Encode(w io.Writer, name string, entries []Entry) error {
+	e := &encoder{w: w}
+
+	e.line("BEGIN:VCALENDAR")
+	e.line("VERSION:2.0")
+	e.line("PRODID:" + productID)
+	e.line("CALSCALE:GREGORIAN")
+	e.line("METHOD:PUBLISH")
+	if name != "" {
+		e.line("X-WR-CALNAME:" + escapeText(name))
+	}
+
+	for _, zone := range zones(entries) {
+		e.vtimezone(zone.loc, zone.year)
+	}
+
+	for _, entry := range entries {
+		e.entry(entry)
+	}
+
+	e.line("END:VCALENDAR")
+	return e.err
+}
+
+// UID returns the iCalendar UID of an event, keeping the original one for imported events
+func UID(event models.Event) string {
+	if event.ICalUID != nil {
+		return *event.ICalUID
+	}
+	return event.ID.String() + "@" + uidDomain
+}
+
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) entry(entry Entry) {
+	event := entry.Event
+
+	var seriesAttendees []models.EventAssignmentWithDetails
+	occurrenceAttendees := make(map[string][]models.EventAssignmentWithDetails)
+	for _, attendee := range entry.Attendees {
+		if attendee.OccurrenceDate == nil {
+			seriesAttendees = append(seriesAttendees, attendee)
+			continue
+		}
+		key := attendee.OccurrenceDate.Format(dateLayout)
+		occurrenceAttendees[key] = append(occurrenceAttendees[key], attendee)
+	}
+
+	e.vevent(entry, event, nil, seriesAttendees)
+
+	if event.RecurrenceRule == nil {
+		return
+	}
+
+	// Occurrences that differ from the series are written as overrides
+	exceptions := make(map[string]*models.EventException, len(entry.Exceptions))
+	dates := make(map[string]time.Time)
+	for i := range entry.Exceptions {
+		key := entry.Exceptions[i].OriginalDate.Format(dateLayout)
+		exceptions[key] = &entry.Exceptions[i]
+		dates[key] = entry.Exceptions[i].OriginalDate
+	}
+	for key, attendees := range occurrenceAttendees {
+		dates[key] = *attendees[0].OccurrenceDate
+	}
+
+	keys := make([]string, 0, len(dates))
+	for key := range dates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		occurrence := recurrence.Apply(event, dates[key], exceptions[key])
+		recurrenceID := dates[key]
+		e.vevent(entry, occurrence, &recurrenceID, mergeAttendees(seriesAttendees, occurrenceAttendees[key]))
+	}
+}
+
+func (e *encoder) vevent(entry Entry, event models.Event, recurrenceID *time.Time, attendees []models.EventAssignmentWithDetails) {
+	e.line("BEGIN:VEVENT")
+	e.line("UID:" + UID(entry.Event))
+	e.line("DTSTAMP:" + formatUTC(event.UpdatedAt))
+	e.line("CREATED:" + formatUTC(event.CreatedAt))
+	e.line("LAST-MODIFIED:" + formatUTC(event.UpdatedAt))
+
+	zone := event.Zone()
+	if recurrenceID != nil {
+		// The original start of the occurrence, before any override moved it
+		original := recurrence.Apply(entry.Event, *recurrenceID, nil)
+		e.line("RECURRENCE-ID" + formatTime(original.StartsAt, zone))
+	}
+
+	e.line("DTSTART" + formatTime(event.StartsAt, zone))
+	e.line("DTEND" + formatTime(event.EndsAt, zone))
+
+	if recurrenceID == nil && event.RecurrenceRule != nil {
+		e.line("RRULE:" + *event.RecurrenceRule)
+	}
+
+	e.line("SUMMARY:" + escapeText(event.Title))
+	if event.Description != "" {
+		e.line("DESCRIPTION:" + escapeText(event.Description))
+	}
+	if event.Location != "" {
+		e.line("LOCATION:" + escapeText(event.Location))
+	}
+	if status, ok := eventStatuses[event.Status]; ok {
+		e.line("STATUS:" + status)
+	}
+
+	if entry.OrganizerEmail != "" {
+		e.line("ORGANIZER" + param("CN", entry.OrganizerName) + ":mailto:" + entry.OrganizerEmail)
+	}
+
+	for _, attendee := range attendees {
+		role, ok := attendeeRoles[attendee.Role]
+		if !ok {
+			role = "REQ-PARTICIPANT"
+		}
+		partStat, ok := partStats[attendee.Status]
+		if !ok {
+			partStat = "NEEDS-ACTION"
+		}
+		e.line("ATTENDEE" + param("CN", attendee.UserName) + ";ROLE=" + role + ";PARTSTAT=" + partStat +
+			":mailto:" + attendee.UserEmail)
+	}
+
+	e.line("END:VEVENT")
+}
+
+// line writes a content line, folded to 75 octets as required by RFC 5545
+func (e *encoder) line(content string) {
+	if e.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range content {
+		size := utf8.RuneLen(r)
+		if width+size > maxLine {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+
+	_, e.err = io.WriteString(e.w, b.String())
+}
+
+func mergeAttendees(series, occurrence []models.EventAssignmentWithDetails) []models.EventAssignmentWithDetails {
+	merged := make([]models.EventAssignmentWithDetails, 0, len(series))
+	overrides := make(map[string]models.EventAssignmentWithDetails, len(occurrence))
+	for _, attendee := range occurrence {
+		overrides[attendee.UserID.String()] = attendee
+	}
+	for _, attendee := range series {
+		if override, ok := overrides[attendee.UserID.String()]; ok {
+			attendee.Status = override.Status
+		}
+		merged = append(merged, attendee)
+	}
+	return merged
+}
+
+func formatUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// formatTime formats the parameters and value of a DATE-TIME property: UTC for
+// UTC events, otherwise wall-clock time with a TZID so recurrences follow DST
+func formatTime(t time.Time, zone *time.Location) string {
+	if zone == time.UTC {
+		return ":" + formatUTC(t)
+	}
+	return ";TZID=" + zone.String() + ":" + t.In(zone).Format("20060102T150405")
+}
+
+func param(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	value = strings.ReplaceAll(value, `"`, "'")
+	if strings.ContainsAny(value, ":;,") {
+		value = `"` + value + `"`
+	}
+	return ";" + name + "=" + value
+}
+
+func escapeText(value string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return replacer.Replace(value)
+}
@@ -0,0 +1,407 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"agenda-api/internal/models"
+)
+
+// Component is a parsed iCalendar component such as VCALENDAR or VEVENT
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Get returns the first property called name, or nil
+func (c *Component) Get(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// All returns every property called name
+func (c *Component) All(name string) []Property {
+	var properties []Property
+	for _, property := range c.Properties {
+		if property.Name == name {
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+// Parse reads a VCALENDAR object, unfolding content lines as in RFC 5545
+func Parse(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root *Component
+	var stack []*Component
+	for n, line := range lines {
+		property, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		switch property.Name {
+		case "BEGIN":
+			component := &Component{Name: strings.ToUpper(property.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, component)
+			} else if root == nil {
+				root = component
+			}
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(property.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", n+1, property.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside of a component", n+1)
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, property)
+		}
+	}
+
+	if root == nil || root.Name != "VCALENDAR" {
+		return nil, errors.New("no VCALENDAR found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unterminated %s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func parseLine(line string) (Property, error) {
+	property := Property{Params: map[string]string{}}
+
+	// Find the value separator, skipping colons inside quoted parameter values
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property, errors.New("missing ':'")
+	}
+
+	head := line[:colon]
+	property.Value = line[colon+1:]
+
+	parts := splitParams(head)
+	property.Name = strings.ToUpper(parts[0])
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		property.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return property, nil
+}
+
+func splitParams(head string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range head {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ';' && !quoted {
+			parts = append(parts, head[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, head[start:])
+}
+
+// ImportedEvent is a VEVENT decoded into the fields this API understands
+type ImportedEvent struct {
+	UID            string
+	Title          string
+	Description    string
+	Location       string
+	Start          time.Time
+	End            time.Time
+	AllDay         bool
+	Floating       bool
+	Status         models.EventStatus
+	RecurrenceRule string
+	ExceptionDates []time.Time
+	RecurrenceID   *time.Time
+	Overrides      []ImportedEvent
+	Warnings       []string
+}
+
+// Decode parses an iCalendar stream and returns its events. VEVENTs carrying a
+// RECURRENCE-ID are attached to their series as Overrides.
+func Decode(r io.Reader) ([]ImportedEvent, error) {
+	calendar, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ImportedEvent
+	var overrides []ImportedEvent
+	for _, component := range calendar.Components {
+		if component.Name != "VEVENT" {
+			continue
+		}
+		event, err := decodeEvent(component)
+		if err != nil {
+			return nil, err
+		}
+		if event.RecurrenceID != nil {
+			overrides = append(overrides, event)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	for _, override := range overrides {
+		attached := false
+		for i := range events {
+			if events[i].UID == override.UID {
+				events[i].Overrides = append(events[i].Overrides, override)
+				attached = true
+				break
+			}
+		}
+		// An override whose series is not in the file stands on its own
+		if !attached {
+			override.RecurrenceID = nil
+			override.Warnings = append(override.Warnings, "Series for this occurrence was not found; imported as a single event")
+			events = append(events, override)
+		}
+	}
+
+	return events, nil
+}
+
+func decodeEvent(component *Component) (ImportedEvent, error) {
+	event := ImportedEvent{Status: models.EventStatusPublished}
+
+	if uid := component.Get("UID"); uid != nil {
+		event.UID = uid.Value
+	}
+	if event.UID == "" {
+		return event, errors.New("VEVENT without UID")
+	}
+
+	if summary := component.Get("SUMMARY"); summary != nil {
+		event.Title = unescapeText(summary.Value)
+	}
+	if event.Title == "" {
+		event.Title = "(untitled)"
+	}
+	if description := component.Get("DESCRIPTION"); description != nil {
+		event.Description = unescapeText(description.Value)
+	}
+	if location := component.Get("LOCATION"); location != nil {
+		event.Location = unescapeText(location.Value)
+	}
+
+	if status := component.Get("STATUS"); status != nil {
+		switch strings.ToUpper(status.Value) {
+		case "CANCELLED":
+			event.Status = models.EventStatusCancelled
+		case "TENTATIVE":
+			event.Status = models.EventStatusDraft
+		}
+	}
+
+	dtstart := component.Get("DTSTART")
+	if dtstart == nil {
+		return event, fmt.Errorf("VEVENT %s without DTSTART", event.UID)
+	}
+	start, allDay, floating, warning, err := parseDateTime(*dtstart)
+	if err != nil {
+		return event, fmt.Errorf("VEVENT %s: %w", event.UID, err)
+	}
+	event.Start, event.AllDay, event.Floating = start, allDay, floating
+	event.addWarning(warning)
+
+	switch {
+	case component.Get("DTEND") != nil:
+		end, _, _, warning, err := parseDateTime(*component.Get("DTEND"))
+		if err != nil {
+			return event, fmt.Errorf("VEVENT %s: %w", event.UID, err)
+		}
+		event.End = end
+		event.addWarning(warning)
+	case component.Get("DURATION") != nil:
+		duration, err := parseDuration(component.Get("DURATION").Value)
+		if err != nil {
+			return event, fmt.Errorf("VEVENT %s: %w", event.UID, err)
+		}
+		event.End = event.Start.Add(duration)
+	case allDay:
+		event.End = event.Start.AddDate(0, 0, 1)
+	default:
+		event.End = event.Start
+	}
+
+	if rrule := component.Get("RRULE"); rrule != nil {
+		event.RecurrenceRule = rrule.Value
+	}
+
+	for _, exdate := range component.All("EXDATE") {
+		for _, value := range strings.Split(exdate.Value, ",") {
+			date, _, _, warning, err := parseDateTime(Property{Name: exdate.Name, Params: exdate.Params, Value: value})
+			if err != nil {
+				return event, fmt.Errorf("VEVENT %s: %w", event.UID, err)
+			}
+			event.ExceptionDates = append(event.ExceptionDates, date)
+			event.addWarning(warning)
+		}
+	}
+
+	if recurrenceID := component.Get("RECURRENCE-ID"); recurrenceID != nil {
+		date, _, _, warning, err := parseDateTime(*recurrenceID)
+		if err != nil {
+			return event, fmt.Errorf("VEVENT %s: %w", event.UID, err)
+		}
+		event.RecurrenceID = &date
+		event.addWarning(warning)
+	}
+
+	return event, nil
+}
+
+func (e *ImportedEvent) addWarning(warning string) {
+	if warning == "" {
+		return
+	}
+	for _, existing := range e.Warnings {
+		if existing == warning {
+			return
+		}
+	}
+	e.Warnings = append(e.Warnings, warning)
+}
+
+// parseDateTime reads DATE, floating, UTC and TZID-qualified DATE-TIME values
+func parseDateTime(property Property) (t time.Time, allDay, floating bool, warning string, err error) {
+	value := strings.TrimSpace(property.Value)
+
+	if strings.EqualFold(property.Params["VALUE"], "DATE") || len(value) == len("20060102") {
+		t, err = time.Parse("20060102", value)
+		return t, true, true, "", err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, false, "", err
+	}
+
+	if tzid := strings.TrimPrefix(property.Params["TZID"], "/"); tzid != "" {
+		location, locErr := time.LoadLocation(tzid)
+		if locErr == nil {
+			t, err = time.ParseInLocation("20060102T150405", value, location)
+			return t, false, false, "", err
+		}
+		warning = fmt.Sprintf("Unknown time zone %q; times imported as local wall-clock time", tzid)
+	}
+
+	t, err = time.Parse("20060102T150405", value)
+	return t, false, true, warning, err
+}
+
+// parseDuration reads the RFC 5545 dur-value subset used by calendar clients
+func parseDuration(value string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign = -1
+		value = value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var total time.Duration
+	number := 0
+	inTime := false
+	for _, r := range value[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number = number*10 + int(r-'0')
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		case r == 'W':
+			total += time.Duration(number) * 7 * 24 * time.Hour
+		case r == 'D':
+			total += time.Duration(number) * 24 * time.Hour
+		case r == 'H' && inTime:
+			total += time.Duration(number) * time.Hour
+		case r == 'M' && inTime:
+			total += time.Duration(number) * time.Minute
+		case r == 'S' && inTime:
+			total += time.Duration(number) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		number = 0
+	}
+	return sign * total, nil
+}
+
+func unescapeText(value string) string {
+	replacer := strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, ";",
+		`\,`, ",",
+		`\n`, "\n",
+		`\N`, "\n",
+	)
+	return replacer.Replace(value)
+}
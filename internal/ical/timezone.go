@@ -0,0 +1,128 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type zoneUse struct {
+	loc  *time.Location
+	year int
+}
+
+// zones lists the non-UTC zones used by entries, with the earliest year each
+// one is needed from
+func zones(entries []Entry) []zoneUse {
+	byName := make(map[string]*zoneUse)
+	for _, entry := range entries {
+		loc := entry.Event.Zone()
+		if loc == time.UTC {
+			continue
+		}
+		year := entry.Event.StartsAt.In(loc).Year()
+		if use, ok := byName[loc.String()]; ok {
+			if year < use.year {
+				use.year = year
+			}
+			continue
+		}
+		byName[loc.String()] = &zoneUse{loc: loc, year: year}
+	}
+
+	uses := make([]zoneUse, 0, len(byName))
+	for _, use := range byName {
+		uses = append(uses, *use)
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		return uses[i].loc.String() < uses[j].loc.String()
+	})
+	return uses
+}
+
+// vtimezone writes a VTIMEZONE for loc. Its offset changes in year are written
+// as yearly rules, which is how calendar clients expect DST to be described.
+func (e *encoder) vtimezone(loc *time.Location, year int) {
+	e.line("BEGIN:VTIMEZONE")
+	e.line("TZID:" + loc.String())
+
+	transitions := transitionsIn(loc, year)
+	if len(transitions) == 0 {
+		name, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+		e.line("BEGIN:STANDARD")
+		e.line(fmt.Sprintf("DTSTART:%04d0101T000000", year))
+		e.line("TZOFFSETFROM:" + formatOffset(offset))
+		e.line("TZOFFSETTO:" + formatOffset(offset))
+		e.line("TZNAME:" + name)
+		e.line("END:STANDARD")
+	}
+
+	for _, t := range transitions {
+		_, from := t.Add(-time.Second).In(loc).Zone()
+		name, to := t.In(loc).Zone()
+
+		kind := "STANDARD"
+		if t.In(loc).IsDST() {
+			kind = "DAYLIGHT"
+		}
+
+		// Local time of the change, as seen on the clock before it
+		local := t.UTC().Add(time.Duration(from) * time.Second)
+
+		e.line("BEGIN:" + kind)
+		e.line("DTSTART:" + local.Format("20060102T150405"))
+		e.line("RRULE:FREQ=YEARLY;BYMONTH=" + fmt.Sprint(int(local.Month())) + ";BYDAY=" + weekdayOrdinal(local))
+		e.line("TZOFFSETFROM:" + formatOffset(from))
+		e.line("TZOFFSETTO:" + formatOffset(to))
+		e.line("TZNAME:" + name)
+		e.line("END:" + kind)
+	}
+
+	e.line("END:VTIMEZONE")
+}
+
+// transitionsIn returns the instants at which loc changes offset during year
+func transitionsIn(loc *time.Location, year int) []time.Time {
+	var transitions []time.Time
+	day := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := day.AddDate(1, 0, 0)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		_, before := day.In(loc).Zone()
+		_, after := next.In(loc).Zone()
+		if before == after {
+			continue
+		}
+
+		// Narrow the change down to the second
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, offset := mid.In(loc).Zone(); offset == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transitions = append(transitions, hi)
+	}
+	return transitions
+}
+
+// weekdayOrdinal describes the day of t within its month, such as 2SU or -1SU
+func weekdayOrdinal(t time.Time) string {
+	day := [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}[t.Weekday()]
+	if t.AddDate(0, 0, 7).Month() != t.Month() {
+		return "-1" + day
+	}
+	return fmt.Sprint((t.Day()-1)/7+1) + day
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
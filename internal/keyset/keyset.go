@@ -0,0 +1,439 @@
+// Package keyset holds the keys access tokens are signed and verified with.
+//
+// HS256 uses the shared JWT secret. RS256 and EdDSA keys are PEM files named
+// <kid>.pem in a directory that replicas share. A key ID is the time the key
+// starts signing; the newest key of the configured algorithm whose time has
+// come signs, and superseded keys keep verifying tokens until those can no
+// longer be valid. Rotated keys are published ahead of that time, so that
+// verifiers caching the JWKS document know them before they see them.
+package keyset
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+const (
+	// How often the key directory is re-read to pick up keys of other replicas
+	reloadInterval = time.Minute
+	// Unknown key IDs trigger a reload at most this often
+	minReloadInterval = 10 * time.Second
+	kidLayout         = "20060102T150405Z"
+	// A rotated key is generated this long before it starts signing: every
+	// replica loads it within reloadInterval, and cached JWKS documents
+	// expire within JWKSMaxAge after that
+	publishAhead = reloadInterval + JWKSMaxAge
+)
+
+// JWKSMaxAge is how long clients may cache the JWKS document
+const JWKSMaxAge = 5 * time.Minute
+
+var ErrUnknownKey = errors.New("keyset: unknown signing key")
+
+type Options struct {
+	Algorithm string
+	// Shared secret, only used with HS256
+	Secret string
+	// Directory holding the private keys of RS256 and EdDSA
+	Dir string
+	// A new signing key is generated this often; zero keeps the newest key
+	Rotation time.Duration
+	// How long a superseded key still verifies tokens, at least the access token lifetime
+	Retention time.Duration
+}
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	// When the key starts signing, read from its ID
+	createdAt time.Time
+}
+
+type Set struct {
+	opts Options
+
+	reloadMu sync.Mutex
+	loadedAt time.Time
+
+	mu     sync.RWMutex
+	keys   map[string]*key
+	signer *key
+}
+
+func New(opts Options) (*Set, error) {
+	s := &Set{opts: opts}
+
+	switch opts.Algorithm {
+	case HS256:
+		if opts.Secret == "" {
+			return nil, errors.New("keyset: HS256 requires a secret")
+		}
+		return s, nil
+	case RS256, EdDSA:
+	default:
+		return nil, fmt.Errorf("keyset: unsupported algorithm %q", opts.Algorithm)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := s.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run keeps the key set current, generating keys when rotation is due and
+// dropping those no token can still be signed with, until ctx is done.
+func (s *Set) Run(ctx context.Context) {
+	if s.opts.Algorithm == HS256 {
+		return
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.reload(now); err != nil {
+				log.Printf("Failed to reload signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// Sign returns the signed token for claims, carrying the key ID in its header
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	if s.opts.Algorithm == HS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.opts.Secret))
+	}
+
+	s.mu.RLock()
+	signer := s.signer
+	s.mu.RUnlock()
+
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["kid"] = signer.id
+	return token.SignedString(signer.private)
+}
+
+// Methods lists the algorithms accepted when verifying tokens
+func (s *Set) Methods() []string {
+	if s.opts.Algorithm == HS256 {
+		return []string{HS256}
+	}
+	return []string{RS256, EdDSA}
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse
+func (s *Set) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if s.opts.Algorithm == HS256 {
+		return []byte(s.opts.Secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k := s.lookup(kid)
+	if k == nil {
+		// Another replica may have rotated to a key we have not loaded yet
+		if err := s.reloadIfStale(time.Now()); err != nil {
+			return nil, err
+		}
+		k = s.lookup(kid)
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("keyset: key %s does not use %s", kid, token.Method.Alg())
+	}
+	return k.private.Public(), nil
+}
+
+// JWK is the public part of a signing key, as published in the JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys tokens may currently be verified with; the
+// shared HS256 secret is never published
+func (s *Set) JWKS() []JWK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := []JWK{}
+	for _, k := range s.keys {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+func (s *Set) lookup(kid string) *key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[kid]
+}
+
+func (s *Set) reloadIfStale(now time.Time) error {
+	s.reloadMu.Lock()
+	stale := now.Sub(s.loadedAt) >= minReloadInterval
+	s.reloadMu.Unlock()
+
+	if !stale {
+		return nil
+	}
+	return s.reload(now)
+}
+
+func (s *Set) reload(now time.Time) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	signer := s.newest(keys, now)
+	if signer == nil {
+		// Nothing was signed yet, so the first key signs at once. Replicas
+		// derive the same key ID, so only one of them creates the key.
+		kid := now.UTC().Format(kidLayout)
+		if s.opts.Rotation > 0 {
+			kid = now.UTC().Truncate(s.opts.Rotation).Format(kidLayout)
+		}
+		if keys, err = s.add(kid); err != nil {
+			return err
+		}
+		signer = s.newest(keys, now)
+	}
+	if signer == nil {
+		return fmt.Errorf("keyset: no %s key in %s", s.opts.Algorithm, s.opts.Dir)
+	}
+
+	if s.opts.Rotation > 0 {
+		next := now.Add(publishAhead).UTC().Truncate(s.opts.Rotation)
+		if !s.scheduled(keys, next) {
+			// A rotation missed while no replica ran still has to be
+			// published before the key signs
+			if !next.After(now) {
+				next = now.Add(publishAhead).UTC().Truncate(time.Second)
+			}
+			if keys, err = s.add(next.Format(kidLayout)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Tokens signed by older keys have expired once the newest key has been
+	// in use for longer than the retention
+	if now.Sub(signer.createdAt) > s.opts.Retention+reloadInterval {
+		for kid, k := range keys {
+			if k.createdAt.Before(signer.createdAt) {
+				delete(keys, kid)
+				os.Remove(filepath.Join(s.opts.Dir, kid+".pem"))
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.signer = signer
+	s.mu.Unlock()
+
+	s.loadedAt = now
+	return nil
+}
+
+// add generates the key kid unless another replica already did, and returns
+// the keys found afterwards
+func (s *Set) add(kid string) (map[string]*key, error) {
+	if err := s.generate(kid); err != nil && !errors.Is(err, fs.ErrExist) {
+		return nil, err
+	}
+	return s.load()
+}
+
+// scheduled reports whether a key of the configured algorithm signs from at or later
+func (s *Set) scheduled(keys map[string]*key, at time.Time) bool {
+	for _, k := range keys {
+		if k.method.Alg() == s.opts.Algorithm && !k.createdAt.Before(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// newest returns the newest key of the configured algorithm that signs at
+// time at, or nil if there is none
+func (s *Set) newest(keys map[string]*key, at time.Time) *key {
+	var newest *key
+	for _, k := range keys {
+		if k.method.Alg() != s.opts.Algorithm || k.createdAt.After(at) {
+			continue
+		}
+		if newest == nil || k.createdAt.After(newest.createdAt) ||
+			(k.createdAt.Equal(newest.createdAt) && k.id > newest.id) {
+			newest = k
+		}
+	}
+	return newest
+}
+
+func (s *Set) load() (map[string]*key, error) {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*key)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+
+		path := filepath.Join(s.opts.Dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		k, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("keyset: %s: %w", path, err)
+		}
+		k.id = strings.TrimSuffix(entry.Name(), ".pem")
+		k.createdAt = info.ModTime()
+		// Copying keys around changes their modification time, but not their ID
+		if createdAt, err := time.Parse(kidLayout, k.id); err == nil {
+			k.createdAt = createdAt
+		}
+		keys[k.id] = k
+	}
+	return keys, nil
+}
+
+// generate writes a new key of the configured algorithm; the file appears
+// atomically and fs.ErrExist is returned when the key ID is taken
+func (s *Set) generate(kid string) error {
+	var private crypto.Signer
+	var err error
+	switch s.opts.Algorithm {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.opts.Dir, ".key-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Link(tmp.Name(), filepath.Join(s.opts.Dir, kid+".pem")); err != nil {
+		return err
+	}
+	log.Printf("Generated %s signing key %s", s.opts.Algorithm, kid)
+	return nil
+}
+
+func parseKey(data []byte) (*key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &key{method: jwt.SigningMethodRS256, private: private}, nil
+	case ed25519.PrivateKey:
+		return &key{method: jwt.SigningMethodEdDSA, private: private}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
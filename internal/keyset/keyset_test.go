@@ -0,0 +1,176 @@
+package keyset
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestSet(t *testing.T, opts Options) *Set {
+	t.Helper()
+	opts.Algorithm = EdDSA
+	opts.Dir = t.TempDir()
+	return &Set{opts: opts}
+}
+
+func reload(t *testing.T, s *Set, now time.Time) {
+	t.Helper()
+	if err := s.reload(now); err != nil {
+		t.Fatalf("reload at %s: %v", now, err)
+	}
+}
+
+// signingKid returns the key ID a newly signed token carries
+func signingKid(t *testing.T, s *Set) string {
+	t.Helper()
+	signed, err := s.Sign(jwt.RegisteredClaims{Subject: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func published(s *Set) []string {
+	var kids []string
+	for _, jwk := range s.JWKS() {
+		kids = append(kids, jwk.Kid)
+	}
+	return kids
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCreatedAtComesFromKid(t *testing.T) {
+	s := newTestSet(t, Options{})
+	if err := s.generate("20250301T000000Z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.generate("legacy"); err != nil {
+		t.Fatal(err)
+	}
+	// A restored backup has fresh modification times
+	modified := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"20250301T000000Z.pem", "legacy.pem"} {
+		if err := os.Chtimes(filepath.Join(s.opts.Dir, name), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := s.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys["20250301T000000Z"].createdAt, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("createdAt = %s, want %s", got, want)
+	}
+	if got := keys["legacy"].createdAt; !got.Equal(modified) {
+		t.Errorf("createdAt of a key without a time in its ID = %s, want %s", got, modified)
+	}
+}
+
+func TestRotationPublishesKeysBeforeTheySign(t *testing.T) {
+	s := newTestSet(t, Options{Rotation: 24 * time.Hour, Retention: time.Hour})
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	const first, second = "20250301T000000Z", "20250302T000000Z"
+
+	reload(t, s, day.Add(12*time.Hour))
+	if kid := signingKid(t, s); kid != first {
+		t.Fatalf("signing with %s, want %s", kid, first)
+	}
+
+	next := day.AddDate(0, 0, 1)
+	reload(t, s, next.Add(-publishAhead-time.Second))
+	if kids := published(s); !equal(kids, []string{first}) {
+		t.Errorf("published %v before the next key is due", kids)
+	}
+
+	reload(t, s, next.Add(-publishAhead))
+	if kids := published(s); !equal(kids, []string{first, second}) {
+		t.Errorf("published %v, want the next key too", kids)
+	}
+	if kid := signingKid(t, s); kid != first {
+		t.Errorf("signing with %s before its time", kid)
+	}
+
+	reload(t, s, next)
+	if kid := signingKid(t, s); kid != second {
+		t.Errorf("signing with %s, want %s", kid, second)
+	}
+	if kids := published(s); !equal(kids, []string{first, second}) {
+		t.Errorf("published %v, want the superseded key kept", kids)
+	}
+}
+
+func TestMissedRotationIsPublishedFirst(t *testing.T) {
+	s := newTestSet(t, Options{Rotation: 24 * time.Hour, Retention: time.Hour})
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	reload(t, s, day)
+
+	// No replica ran when the next key was due
+	now := day.AddDate(0, 0, 3).Add(5 * time.Hour)
+	reload(t, s, now)
+	kids := published(s)
+	if len(kids) != 2 {
+		t.Fatalf("published %v, want a new key", kids)
+	}
+	if kid := signingKid(t, s); kid != kids[0] {
+		t.Errorf("signing with %s before it was published long enough", kid)
+	}
+
+	reload(t, s, now.Add(time.Minute))
+	if got := published(s); !equal(got, kids) {
+		t.Errorf("published %v after the next reload, want %v", got, kids)
+	}
+
+	reload(t, s, now.Add(publishAhead))
+	if kid := signingKid(t, s); kid != kids[1] {
+		t.Errorf("signing with %s, want %s", kid, kids[1])
+	}
+}
+
+func TestRetentionDropsSupersededKeys(t *testing.T) {
+	s := newTestSet(t, Options{Rotation: 24 * time.Hour, Retention: time.Hour})
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	next := day.AddDate(0, 0, 1)
+	const first, second = "20250301T000000Z", "20250302T000000Z"
+
+	reload(t, s, day)
+	reload(t, s, next.Add(-publishAhead))
+	reload(t, s, next)
+
+	// Tokens of the first key may still be valid, so it stays published
+	reload(t, s, next.Add(s.opts.Retention+reloadInterval))
+	if kids := published(s); !equal(kids, []string{first, second}) {
+		t.Errorf("published %v within the retention", kids)
+	}
+	// and still verifies them
+	if _, err := s.Keyfunc(&jwt.Token{Method: jwt.SigningMethodEdDSA, Header: map[string]interface{}{"kid": first}}); err != nil {
+		t.Errorf("first key no longer verifies: %v", err)
+	}
+
+	reload(t, s, next.Add(s.opts.Retention+reloadInterval+time.Second))
+	if kids := published(s); !equal(kids, []string{second}) {
+		t.Errorf("published %v after the retention, want only %s", kids, second)
+	}
+	if _, err := os.Stat(filepath.Join(s.opts.Dir, first+".pem")); !os.IsNotExist(err) {
+		t.Errorf("superseded key file kept: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Package lockout tracks failed login attempts per account and per client IP
+// and locks them out temporarily, doubling the lockout with every further
+// failure.
+package lockout
+
+import (
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+)
+
+// Store keeps failure counters. MemoryStore serves a single instance; a
+// database-backed store lets several replicas share counters.
+type Store interface {
+	// Fail records a failed attempt and returns the number of failures in a
+	// row, restarting the count when the previous one is older than window
+	Fail(key string, now time.Time, window time.Duration) (int, error)
+	Lock(key string, until time.Time) error
+	LockedUntil(key string) (time.Time, error)
+	Reset(key string) error
+}
+
+// Policy says after how many failures a key is locked and for how long. The
+// first lockout lasts BaseLock and each further failure doubles it, up to
+// MaxLock. A zero Threshold disables lockouts.
+type Policy struct {
+	Threshold int
+	BaseLock  time.Duration
+	MaxLock   time.Duration
+	// Failures further apart than this start a new count
+	Window time.Duration
+}
+
+func (p Policy) lockFor(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	lock := float64(p.BaseLock) * math.Pow(2, float64(failures-p.Threshold))
+	if lock > float64(p.MaxLock) {
+		return p.MaxLock
+	}
+	return time.Duration(lock)
+}
+
+type Guard struct {
+	store   Store
+	account Policy
+	ip      Policy
+	logger  *slog.Logger
+}
+
+func NewGuard(store Store, account, ip Policy, logger *slog.Logger) *Guard {
+	return &Guard{store: store, account: account, ip: ip, logger: logger}
+}
+
+// Check returns how long the account or IP is still locked; zero means the
+// attempt may proceed
+func (g *Guard) Check(email, ip string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		until, err := g.store.LockedUntil(key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := until.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed login for the account and the IP, locking whichever
+// crossed its threshold
+func (g *Guard) Fail(email, ip string) error {
+	if err := g.fail(accountKey(email), g.account); err != nil {
+		return err
+	}
+	return g.fail(ipKey(ip), g.ip)
+}
+
+func (g *Guard) fail(key string, policy Policy) error {
+	now := time.Now()
+	failures, err := g.store.Fail(key, now, policy.Window)
+	if err != nil {
+		return err
+	}
+
+	lock := policy.lockFor(failures)
+	if lock == 0 {
+		return nil
+	}
+
+	until := now.Add(lock)
+	if err := g.store.Lock(key, until); err != nil {
+		return err
+	}
+	g.logger.Warn("login locked out",
+		"key", key,
+		"failures", failures,
+		"lockedFor", lock.String(),
+		"lockedUntil", until.UTC().Format(time.RFC3339),
+	)
+	return nil
+}
+
+// Succeed clears the account's failures after a successful login. The IP
+// counter is left alone so one valid account cannot reset it.
+func (g *Guard) Succeed(email string) error {
+	return g.store.Reset(accountKey(email))
+}
+
+func (g *Guard) UnlockAccount(email string) error {
+	key := accountKey(email)
+	if err := g.store.Reset(key); err != nil {
+		return err
+	}
+	g.logger.Info("login lockout cleared", "key", key)
+	return nil
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,125 @@
+package lockout
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLockDoubles(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{8, 32 * time.Minute},
+		{9, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.lockFor(tt.failures); got != tt.want {
+			t.Errorf("lockFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	if got := (Policy{BaseLock: time.Minute, MaxLock: time.Hour}).lockFor(100); got != 0 {
+		t.Errorf("lockFor without a threshold = %v, want 0", got)
+	}
+}
+
+func TestMemoryStoreDropsStaleEntries(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	now := time.Now()
+
+	store.Fail("stale", now.Add(-2*time.Hour), time.Hour)
+	store.Fail("locked", now.Add(-2*time.Hour), time.Hour)
+	store.Lock("locked", now.Add(time.Hour))
+	store.Fail("fresh", now, time.Hour)
+
+	if _, ok := store.entries["stale"]; ok {
+		t.Error("stale entry kept")
+	}
+	if _, ok := store.entries["locked"]; !ok {
+		t.Error("entry still locked was dropped")
+	}
+}
+
+func newTestGuard(account, ip Policy) *Guard {
+	return NewGuard(NewMemoryStore(24*time.Hour), account, ip, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestGuardLocksAccountAndIP(t *testing.T) {
+	guard := newTestGuard(
+		Policy{Threshold: 2, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+		Policy{Threshold: 3, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+	)
+
+	check := func(email, ip string) time.Duration {
+		t.Helper()
+		wait, err := guard.Check(email, ip)
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		return wait
+	}
+
+	guard.Fail("Alice@Example.com", "192.0.2.1")
+	if wait := check("alice@example.com", "192.0.2.1"); wait != 0 {
+		t.Errorf("locked after one failure for %v", wait)
+	}
+	guard.Fail(" alice@example.com", "192.0.2.2")
+	if wait := check("alice@example.com", "192.0.2.9"); wait <= 0 || wait > time.Minute {
+		t.Errorf("account locked for %v, want up to a minute", wait)
+	}
+	if wait := check("bob@example.com", "192.0.2.1"); wait != 0 {
+		t.Errorf("other account locked for %v", wait)
+	}
+
+	guard.Fail("bob@example.com", "192.0.2.1")
+	guard.Fail("carol@example.com", "192.0.2.1")
+	if wait := check("dave@example.com", "192.0.2.1"); wait <= 0 {
+		t.Error("IP not locked after three failures")
+	}
+
+	if err := guard.UnlockAccount("ALICE@example.com"); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+	if wait := check("alice@example.com", "192.0.2.9"); wait != 0 {
+		t.Errorf("unlocked account still locked for %v", wait)
+	}
+}
+
+func TestSucceedLeavesIPCounter(t *testing.T) {
+	guard := newTestGuard(
+		Policy{Threshold: 2, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+		Policy{Threshold: 3, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+	)
+	const ip = "192.0.2.1"
+
+	guard.Fail("alice@example.com", ip)
+	guard.Fail("bob@example.com", ip)
+	// Signing in to one's own account must not wipe the IP's failures
+	if err := guard.Succeed("mallory@example.com"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	guard.Fail("carol@example.com", ip)
+
+	if wait, _ := guard.Check("mallory@example.com", ip); wait <= 0 {
+		t.Error("IP not locked: a successful login reset its counter")
+	}
+
+	// It does clear the account's own failures
+	guard.Fail("erin@example.com", "192.0.2.50")
+	guard.Succeed("erin@example.com")
+	guard.Fail("erin@example.com", "192.0.2.51")
+	if wait, _ := guard.Check("erin@example.com", "192.0.2.52"); wait != 0 {
+		t.Errorf("account locked for %v after a success between failures", wait)
+	}
+}
@@ -0,0 +1,102 @@
+// Package lockouttest checks that a lockout.Store keeps counters the way the
+// Guard expects, so every store is held to the same behaviour.
+package lockouttest
+
+import (
+	"agenda-api/internal/lockout"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestStore runs the store checks against store. Keys are unique to the run
+// and reset afterwards, so a shared database can be used.
+func TestStore(t *testing.T, store lockout.Store) {
+	prefix := "lockouttest:" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":"
+	key := func(t *testing.T) string {
+		k := prefix + t.Name()
+		t.Cleanup(func() { store.Reset(k) })
+		return k
+	}
+	// Stores may keep microseconds only
+	now := time.Now().Truncate(time.Millisecond)
+	const window = time.Minute
+
+	fail := func(t *testing.T, key string, at time.Time) int {
+		t.Helper()
+		failures, err := store.Fail(key, at, window)
+		if err != nil {
+			t.Fatalf("Fail: %v", err)
+		}
+		return failures
+	}
+	lockedUntil := func(t *testing.T, key string) time.Time {
+		t.Helper()
+		until, err := store.LockedUntil(key)
+		if err != nil {
+			t.Fatalf("LockedUntil: %v", err)
+		}
+		return until
+	}
+
+	t.Run("counts failures in a row", func(t *testing.T) {
+		k := key(t)
+		for want := 1; want <= 3; want++ {
+			if got := fail(t, k, now.Add(time.Duration(want)*time.Second)); got != want {
+				t.Errorf("failure %d counted as %d", want, got)
+			}
+		}
+	})
+
+	t.Run("restarts after the window", func(t *testing.T) {
+		k := key(t)
+		fail(t, k, now)
+		fail(t, k, now.Add(window/2))
+		if got := fail(t, k, now.Add(window/2+window+time.Second)); got != 1 {
+			t.Errorf("failure after the window counted as %d, want 1", got)
+		}
+	})
+
+	t.Run("keeps keys apart", func(t *testing.T) {
+		a, b := key(t)+":a", key(t)+":b"
+		t.Cleanup(func() { store.Reset(a); store.Reset(b) })
+		fail(t, a, now)
+		fail(t, a, now)
+		if got := fail(t, b, now); got != 1 {
+			t.Errorf("first failure of another key counted as %d", got)
+		}
+	})
+
+	t.Run("locks", func(t *testing.T) {
+		k := key(t)
+		if until := lockedUntil(t, k); !until.IsZero() {
+			t.Errorf("unknown key locked until %v", until)
+		}
+		fail(t, k, now)
+		until := now.Add(time.Hour)
+		if err := store.Lock(k, until); err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		if got := lockedUntil(t, k); !got.Equal(until) {
+			t.Errorf("locked until %v, want %v", got, until)
+		}
+	})
+
+	t.Run("resets", func(t *testing.T) {
+		k := key(t)
+		fail(t, k, now)
+		fail(t, k, now)
+		if err := store.Lock(k, now.Add(time.Hour)); err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		if err := store.Reset(k); err != nil {
+			t.Fatalf("Reset: %v", err)
+		}
+		if until := lockedUntil(t, k); !until.IsZero() {
+			t.Errorf("reset key locked until %v", until)
+		}
+		if got := fail(t, k, now); got != 1 {
+			t.Errorf("failure after reset counted as %d, want 1", got)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// MemoryStore keeps counters in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	// Entries untouched for this long are dropped
+	retention time.Duration
+}
+
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry), retention: retention}
+}
+
+func (s *MemoryStore) Fail(key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+	if now.Sub(e.lastFailure) > window {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+	return e.failures, nil
+}
+
+func (s *MemoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.lockedUntil = until
+	}
+	return nil
+}
+
+func (s *MemoryStore) LockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		return e.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.lastFailure) > s.retention && now.After(e.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
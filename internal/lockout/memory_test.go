@@ -0,0 +1,12 @@
+package lockout_test
+
+import (
+	"agenda-api/internal/lockout"
+	"agenda-api/internal/lockout/lockouttest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	lockouttest.TestStore(t, lockout.NewMemoryStore(24*time.Hour))
+}
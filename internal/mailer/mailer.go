@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer delivers mail through an SMTP server, authenticating with PLAIN
+// auth when a username is configured
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, message(m.from, to, subject, body))
+}
+
+// LogMailer writes emails to a log instead of sending them, for development
+type LogMailer struct {
+	logger *log.Logger
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{logger: log.New(w, "[mail] ", log.LstdFlags)}
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	m.logger.Printf("To: %s\nSubject: %s\n\n%s\n", to, subject, body)
+	return nil
+}
+
+// New picks the mailer for a driver: "smtp", "file" (appending to path) or
+// "log" (standard output)
+func New(driver, host string, port int, username, password, from, path string) (Mailer, error) {
+	switch driver {
+	case "smtp":
+		if host == "" {
+			return nil, fmt.Errorf("smtp mailer requires a host")
+		}
+		return NewSMTPMailer(host, port, username, password, from), nil
+	case "file":
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogMailer(f), nil
+	case "", "log":
+		return NewLogMailer(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+func message(from, to, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
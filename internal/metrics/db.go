@@ -0,0 +1,14 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// RegisterDB reports the connection pool statistics of db: open, in-use and
+// idle connections and how often and how long queries waited for one. It may
+// be called once per process.
+func RegisterDB(db *sql.DB) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, "agenda"))
+}
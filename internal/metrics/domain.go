@@ -0,0 +1,27 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Domain counters, incremented by the handlers once a change is stored
+var (
+	EventsCreated = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "agenda_events_created_total",
+		Help: "Events created, by type",
+	}, []string{"type"})
+	Registrations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "agenda_registrations_total",
+		Help: "Event registrations, by resulting status (registered or waitlisted)",
+	}, []string{"status"})
+	RegistrationCancellations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "agenda_registration_cancellations_total",
+		Help: "Registrations cancelled by the attendee, by status before cancelling",
+	}, []string{"status"})
+	CapacityRejections = factory.NewCounter(prometheus.CounterOpts{
+		Name: "agenda_capacity_rejections_total",
+		Help: "Registrations that found the event full and joined the waitlist",
+	})
+	AssignmentResponses = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "agenda_assignment_responses_total",
+		Help: "Assignment approvals and rejections",
+	}, []string{"status"})
+)
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "agenda_http_requests_total",
+		Help: "HTTP requests by method, route template and status code",
+	}, []string{"method", "route", "status"})
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "agenda_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// standardMethods are recorded as sent; anything else a client makes up is
+// recorded as "OTHER" so it cannot add series
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Middleware records every request under its route template, e.g.
+// /api/events/:id, so that IDs in paths do not become labels. Requests that
+// match no route are grouped under "unmatched", and non-standard methods
+// under "OTHER".
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		if !standardMethods[method] {
+			method = "OTHER"
+		}
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics. A non-empty token must be presented as a
+// bearer token.
+func Handler(token string) gin.HandlerFunc {
+	serve := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		if token != "" {
+			presented := c.GetHeader("Authorization")
+			if subtle.ConstantTimeCompare([]byte(presented), []byte("Bearer "+token)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+				return
+			}
+		}
+
+		serve.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scrape returns what a Prometheus server scraping /metrics would read
+func scrape(t *testing.T) string {
+	t.Helper()
+	r := gin.New()
+	r.GET("/metrics", Handler(""))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape = %d: %s", w.Code, w.Body)
+	}
+	return w.Body.String()
+}
+
+func TestMiddlewareLabels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	methods := []string{"GET", "DELETE", "FOO", "BAR"}
+	for _, method := range methods {
+		r.Handle(method, "/things/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}
+
+	for _, method := range methods {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/things/123", nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere/123", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BAZ", "/nowhere/123", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("get", "/things/123", nil))
+
+	got := scrape(t)
+	for _, want := range []string{
+		`agenda_http_requests_total{method="GET",route="/things/:id",status="204"} 1`,
+		`agenda_http_requests_total{method="DELETE",route="/things/:id",status="204"} 1`,
+		`agenda_http_requests_total{method="OTHER",route="/things/:id",status="204"} 2`,
+		`agenda_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`agenda_http_requests_total{method="OTHER",route="unmatched",status="404"} 2`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("exposition lacks %s\n%s", want, got)
+		}
+	}
+	for _, leaked := range []string{`"FOO"`, `"BAR"`, `"BAZ"`, `"get"`, "/things/123", "/nowhere"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("exposition contains %s\n%s", leaked, got)
+		}
+	}
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", Handler("secret"))
+
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: status = %d, want %d", tt.header, w.Code, tt.want)
+		}
+		if w.Code == http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+			t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+		}
+	}
+}
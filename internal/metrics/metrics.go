@@ -0,0 +1,22 @@
+// Package metrics defines the application's Prometheus metrics and serves
+// them with the Go runtime and process metrics at /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// registry holds every metric of the process; the metrics of this package
+// register themselves with it when they are created
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
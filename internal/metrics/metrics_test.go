@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDomainCounters(t *testing.T) {
+	before := testutil.ToFloat64(Registrations.WithLabelValues("waitlisted"))
+	Registrations.WithLabelValues("waitlisted").Inc()
+	CapacityRejections.Inc()
+
+	if got := testutil.ToFloat64(Registrations.WithLabelValues("waitlisted")); got != before+1 {
+		t.Errorf("waitlisted registrations = %v, want %v", got, before+1)
+	}
+
+	gin.SetMode(gin.TestMode)
+	got := scrape(t)
+	for _, want := range []string{
+		`agenda_registrations_total{status="waitlisted"}`,
+		"agenda_capacity_rejections_total 1",
+		"# TYPE agenda_http_request_duration_seconds histogram",
+		"go_goroutines",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("scrape lacks %s", want)
+		}
+	}
+}
+
+func TestRegisterDB(t *testing.T) {
+	// Opening does not connect; only the pool's statistics are read
+	db, err := sql.Open("postgres", "postgres://localhost:1/none")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+
+	RegisterDB(db)
+	got := scrape(t)
+	for _, want := range []string{
+		`go_sql_max_open_connections{db_name="agenda"} 7`,
+		`go_sql_in_use_connections{db_name="agenda"} 0`,
+		`go_sql_wait_count_total{db_name="agenda"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("scrape lacks %s", want)
+		}
+	}
+}
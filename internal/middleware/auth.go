@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"agenda-api/internal/keyset"
 	"agenda-api/internal/models"
+	"agenda-api/internal/token"
+	"database/sql"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -17,42 +21,135 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func JWTAuth(jwtSecret string) gin.HandlerFunc {
+// RevocationChecker reports whether an otherwise valid access token was revoked
+type RevocationChecker interface {
+	IsRevoked(jti, userID uuid.UUID, issuedAt time.Time) (bool, error)
+}
+
+// APITokenAuthenticator resolves a personal access token by its hash
+type APITokenAuthenticator interface {
+	Authenticate(tokenHash string) (*models.APITokenOwner, error)
+}
+
+// JWTAuth accepts session access tokens only; API tokens are rejected
+func JWTAuth(keys *keyset.Set, revocations RevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+		tokenString, ok := bearerToken(c)
+		if !ok {
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API tokens are not accepted for this endpoint"})
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
+		if authenticateJWT(c, tokenString, keys, revocations) {
+			c.Next()
+		}
+	}
+}
+
+// TokenAuth accepts either a session access token or a personal access token
+// granting the given scope. With requireAdminMFA, personal access tokens of
+// admins without two-factor authentication act as a plain user, the same as
+// their session tokens.
+func TokenAuth(keys *keyset.Set, revocations RevocationChecker, apiTokens APITokenAuthenticator, scope models.APIScope, requireAdminMFA bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := bearerToken(c)
+		if !ok {
+			return
+		}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
+		if !strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			if authenticateJWT(c, tokenString, keys, revocations) {
+				c.Next()
+			}
+			return
+		}
 
-		if err != nil || !token.Valid {
+		owner, err := apiTokens.Authenticate(token.Hash(tokenString))
+		if err == sql.ErrNoRows {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			c.Abort()
+			return
+		}
+
+		if !owner.Allows(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token does not have the " + string(scope) + " scope"})
+			c.Abort()
+			return
+		}
 
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Set("role", claims.Role)
+		c.Set("userID", owner.UserID)
+		c.Set("email", owner.Email)
+		c.Set("role", owner.EffectiveRole(requireAdminMFA))
+		c.Set("apiTokenID", owner.ID)
 		c.Next()
 	}
 }
 
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		c.Abort()
+		return "", false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		c.Abort()
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+func authenticateJWT(c *gin.Context, tokenString string, keys *keyset.Set, revocations RevocationChecker) bool {
+	claims := &Claims{}
+
+	parsed, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc, jwt.WithValidMethods(keys.Methods()), jwt.WithIssuedAt())
+
+	if err != nil || !parsed.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return false
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return false
+	}
+
+	revoked, err := revocations.IsRevoked(jti, claims.UserID, claims.IssuedAt.Time)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+		c.Abort()
+		return false
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		c.Abort()
+		return false
+	}
+
+	c.Set("userID", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("role", claims.Role)
+	c.Set("claims", claims)
+	return true
+}
+
 func GetUserID(c *gin.Context) uuid.UUID {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -68,3 +165,22 @@ func GetUserRole(c *gin.Context) models.Role {
 	}
 	return role.(models.Role)
 }
+
+// GetClaims returns the claims of the access token the request was authenticated with
+func GetClaims(c *gin.Context) *Claims {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil
+	}
+	return claims.(*Claims)
+}
+
+// GetAPITokenID returns the personal access token the request was
+// authenticated with, or uuid.Nil for session tokens
+func GetAPITokenID(c *gin.Context) uuid.UUID {
+	id, exists := c.Get("apiTokenID")
+	if !exists {
+		return uuid.Nil
+	}
+	return id.(uuid.UUID)
+}
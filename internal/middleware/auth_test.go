@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"agenda-api/internal/keyset"
+	"agenda-api/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type recordingRevocations struct {
+	issuedAt time.Time
+}
+
+func (r *recordingRevocations) IsRevoked(jti, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	r.issuedAt = issuedAt
+	return false, nil
+}
+
+func TestAccessTokensCarryWholeSeconds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys, err := keyset.New(keyset.Options{Algorithm: "HS256", Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("keyset.New: %v", err)
+	}
+
+	issued := time.Date(2026, 1, 2, 3, 4, 5, 678_901_234, time.UTC)
+	signed, err := keys.Sign(&Claims{
+		UserID: uuid.New(),
+		Role:   models.RoleUser,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(issued),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// Verifiers reading the JWKS expect NumericDates in whole seconds
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(signed, ".")[1])
+	if err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	for _, name := range []string{"iat", "exp"} {
+		if strings.ContainsAny(string(claims[name]), ".eE") {
+			t.Errorf("%s = %s, want whole seconds", name, claims[name])
+		}
+	}
+
+	revocations := &recordingRevocations{}
+	r := gin.New()
+	r.GET("/", JWTAuth(keys, revocations), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	// Revocation compares the second the token was issued in
+	if want := issued.Truncate(time.Second); !revocations.issuedAt.Equal(want) {
+		t.Errorf("issuedAt = %v, want %v", revocations.issuedAt, want)
+	}
+}
+
+type stubAPITokens struct {
+	owner *models.APITokenOwner
+}
+
+func (s stubAPITokens) Authenticate(tokenHash string) (*models.APITokenOwner, error) {
+	return s.owner, nil
+}
+
+func TestTokenAuthRestrictsAdminsWithoutMFA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys, err := keyset.New(keyset.Options{Algorithm: "HS256", Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("keyset.New: %v", err)
+	}
+
+	enabled := time.Now()
+	tests := []struct {
+		name            string
+		role            models.Role
+		totpEnabledAt   *time.Time
+		requireAdminMFA bool
+		want            models.Role
+	}{
+		{"admin without MFA when required", models.RoleAdmin, nil, true, models.RoleUser},
+		{"admin with MFA when required", models.RoleAdmin, &enabled, true, models.RoleAdmin},
+		{"admin without MFA when optional", models.RoleAdmin, nil, false, models.RoleAdmin},
+		{"user without MFA when required", models.RoleUser, nil, true, models.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := &models.APITokenOwner{
+				APIToken:      models.APIToken{ID: uuid.New(), UserID: uuid.New(), Scopes: []string{string(models.ScopeEventsRead)}},
+				Role:          tt.role,
+				TOTPEnabledAt: tt.totpEnabledAt,
+			}
+
+			var role models.Role
+			r := gin.New()
+			r.GET("/", TokenAuth(keys, &recordingRevocations{}, stubAPITokens{owner}, models.ScopeEventsRead, tt.requireAdminMFA), func(c *gin.Context) {
+				role = GetUserRole(c)
+				c.Status(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+models.APITokenPrefix+"secret")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+			}
+			if role != tt.want {
+				t.Errorf("role = %s, want %s", role, tt.want)
+			}
+		})
+	}
+}
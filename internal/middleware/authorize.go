@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"agenda-api/internal/policy"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetSubject returns the authenticated user as seen by the policy
+func GetSubject(c *gin.Context) policy.Subject {
+	return policy.Subject{UserID: GetUserID(c), Role: GetUserRole(c)}
+}
+
+// Authorize lets the request through when the policy allows the action on
+// the resource
+func Authorize(p *policy.Policy, action policy.Action, resource policy.Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deny(c, p.Authorize(GetSubject(c), action, resource), "Not found") {
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthorizeTeam checks the action on the team in the :id parameter
+func AuthorizeTeam(p *policy.Policy, action policy.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			c.Abort()
+			return
+		}
+
+		if deny(c, p.Authorize(GetSubject(c), action, policy.Team(teamID)), "Team not found") {
+			return
+		}
+		c.Next()
+	}
+}
+
+func deny(c *gin.Context, err error, notFound string) bool {
+	switch err {
+	case nil:
+		return false
+	case policy.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case policy.ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+	}
+	c.Abort()
+	return true
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"agenda-api/internal/models"
+	"agenda-api/internal/policy"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type teamRoles map[uuid.UUID]models.TeamRole
+
+func (r teamRoles) GetMemberRole(teamID, userID uuid.UUID) (models.TeamRole, error) {
+	role, ok := r[userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return role, nil
+}
+
+func TestAuthorizeTeam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memberID, managerID, strangerID, adminID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	p := policy.New(teamRoles{memberID: models.TeamRoleMember, managerID: models.TeamRoleManager})
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		role   models.Role
+		action policy.Action
+		teamID string
+		want   int
+	}{
+		{"member views", memberID, models.RoleUser, policy.View, uuid.NewString(), http.StatusOK},
+		{"stranger views", strangerID, models.RoleUser, policy.View, uuid.NewString(), http.StatusNotFound},
+		{"member updates", memberID, models.RoleUser, policy.Update, uuid.NewString(), http.StatusForbidden},
+		{"manager updates", managerID, models.RoleUser, policy.Update, uuid.NewString(), http.StatusOK},
+		{"manager deletes", managerID, models.RoleUser, policy.Delete, uuid.NewString(), http.StatusForbidden},
+		{"admin deletes", adminID, models.RoleAdmin, policy.Delete, uuid.NewString(), http.StatusOK},
+		{"invalid team ID", memberID, models.RoleUser, policy.View, "not-a-uuid", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/teams/:id", func(c *gin.Context) {
+				c.Set("userID", tt.userID)
+				c.Set("role", tt.role)
+			}, AuthorizeTeam(p, tt.action), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/teams/"+tt.teamID, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := policy.New(teamRoles{})
+
+	tests := []struct {
+		name string
+		role models.Role
+		want int
+	}{
+		{"admin", models.RoleAdmin, http.StatusOK},
+		{"user", models.RoleUser, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/admin", func(c *gin.Context) {
+				c.Set("userID", uuid.New())
+				c.Set("role", tt.role)
+			}, Authorize(p, policy.ManageUsers, policy.Users), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
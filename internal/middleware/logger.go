@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// secretPathPrefixes are followed by a credential in the URL, like a feed
+// token, that must not reach the access log
+var secretPathPrefixes = []string{"/api/feeds/"}
+
+// Logger writes an access log line per request in Gin's format, with
+// credentials in the path replaced by "REDACTED"
+func Logger(out io.Writer) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{Output: out, Formatter: formatLog})
+}
+
+func formatLog(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactPath(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactPath keeps the prefix of a secret path and drops the rest, query included
+func redactPath(path string) string {
+	for _, prefix := range secretPathPrefixes {
+		if strings.HasPrefix(path, prefix) && len(path) > len(prefix) {
+			return prefix + "REDACTED"
+		}
+	}
+	return path
+}
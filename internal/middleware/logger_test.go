@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoggerRedactsFeedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	r := gin.New()
+	r.Use(Logger(&out))
+	r.GET("/api/feeds/:token", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/api/events/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/api/feeds/s3cr3t-token", "/api/feeds/s3cr3t-token?download=1", "/api/events/42?view=full"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("logged %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("feed token logged:\n%s", out.String())
+	}
+	for _, line := range lines[:2] {
+		if !strings.Contains(line, `"/api/feeds/REDACTED"`) {
+			t.Errorf("feed request logged as %s", line)
+		}
+	}
+	if !strings.Contains(lines[2], `"/api/events/42?view=full"`) {
+		t.Errorf("other request logged as %s", lines[2])
+	}
+}
@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = "usage: migrate up | down [N] | redo | status | baseline VERSION"
+
+// Command runs a migrate subcommand and reports to out
+func Command(ctx context.Context, runner *Runner, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "Applied %03d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "Database is up to date")
+		}
+		return err
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return errors.New("down takes a positive number of migrations")
+			}
+		}
+		reverted, err := runner.Down(ctx, n)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "Reverted %03d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "redo":
+		m, err := runner.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Redid %03d_%s\n", m.Version, m.Name)
+		return nil
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			name := status.Name
+			if status.Unknown {
+				name = "(unknown to this binary)"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, name, applied)
+		}
+		return w.Flush()
+
+	case "baseline":
+		if len(args) < 2 {
+			return errors.New("baseline takes the version the database is already at")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := runner.Baseline(ctx, version); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Marked migrations up to %03d as applied\n", version)
+		return nil
+	}
+
+	return errors.New(usage)
+}
@@ -0,0 +1,382 @@
+// Package migrate applies the versioned SQL migrations. Files are named
+// NNN_name.sql and hold an "-- +migrate Up" and an "-- +migrate Down"
+// section; applied versions are recorded in schema_migrations.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockKey identifies the advisory lock held while migrating, so replicas
+// starting together apply migrations one at a time
+const lockKey = 7_263_118_004
+
+// ErrUnversioned is returned for a database that has tables but no recorded
+// migrations, e.g. one migrated by hand before schema_migrations existed.
+// Applying 001 to it would fail, so the operator has to baseline it first.
+var ErrUnversioned = errors.New("migrate: the database has tables but no recorded migrations; run `migrate baseline VERSION` with the version its schema is at")
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Applied to the database but unknown to this binary
+	Unknown bool
+}
+
+type Runner struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+func New(db *sqlx.DB, fsys fs.FS) (*Runner, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations in fsys, ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := map[int]string{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrate: %s and %s share version %d", other, entry.Name(), version)
+		}
+		seen[version] = entry.Name()
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := split(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", path.Base(entry.Name()), err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: match[2], Up: up, Down: down})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func split(content string) (string, string, error) {
+	var up, down strings.Builder
+	var section *strings.Builder
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		switch strings.TrimSpace(line) {
+		case "-- +migrate Up":
+			section = &up
+			continue
+		case "-- +migrate Down":
+			section = &down
+			continue
+		}
+		if section != nil {
+			section.WriteString(line)
+		}
+	}
+
+	if strings.TrimSpace(up.String()) == "" {
+		return "", "", errors.New("no -- +migrate Up section")
+	}
+	return up.String(), down.String(), nil
+}
+
+// Latest is the version the binary expects the database to be at
+func (r *Runner) Latest() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Up applies every pending migration, each in its own transaction
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := r.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkVersioned(ctx, conn, versions); err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			if err := r.apply(ctx, conn, m, m.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the n most recently applied migrations
+func (r *Runner) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+	err := r.withLock(ctx, func(conn *sqlx.Conn) error {
+		var err error
+		reverted, err = r.down(ctx, conn, n)
+		return err
+	})
+	return reverted, err
+}
+
+// Redo rolls back the latest migration and applies it again
+func (r *Runner) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := r.withLock(ctx, func(conn *sqlx.Conn) error {
+		reverted, err := r.down(ctx, conn, 1)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			return errors.New("migrate: nothing to redo")
+		}
+
+		redone = &reverted[0]
+		return r.apply(ctx, conn, *redone, redone.Up, true)
+	})
+	return redone, err
+}
+
+func (r *Runner) down(ctx context.Context, conn *sqlx.Conn, n int) ([]Migration, error) {
+	var versions []int
+	query := `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT $1`
+	if err := conn.SelectContext(ctx, &versions, query, n); err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for _, version := range versions {
+		m, ok := r.find(version)
+		if !ok {
+			return reverted, fmt.Errorf("migrate: version %d is not known to this binary", version)
+		}
+		if err := r.apply(ctx, conn, m, m.Down, false); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// Baseline records every migration up to version as applied without running
+// it, for databases that were migrated by hand
+func (r *Runner) Baseline(ctx context.Context, version int) error {
+	return r.withLock(ctx, func(conn *sqlx.Conn) error {
+		for _, m := range r.migrations {
+			if m.Version > version {
+				break
+			}
+			query := `
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+				ON CONFLICT (version) DO NOTHING`
+			if _, err := conn.ExecContext(ctx, query, m.Version, m.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists the known migrations and any applied ones the binary does not know
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	versions, err := appliedVersions(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, m := range r.migrations {
+		status := Status{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := versions[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+			delete(versions, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, appliedAt := range versions {
+		appliedAt := appliedAt
+		statuses = append(statuses, Status{Version: version, AppliedAt: &appliedAt, Unknown: true})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	versions, err := appliedVersions(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersioned(ctx, r.db, versions); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range r.migrations {
+		if _, ok := versions[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func (r *Runner) find(version int) (Migration, bool) {
+	for _, m := range r.migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+func (r *Runner) apply(ctx context.Context, conn *sqlx.Conn, m Migration, statements string, up bool) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(statements) != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate: %03d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withLock runs fn on a single connection holding the migration lock
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+type querier interface {
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// appliedVersions maps applied versions to when they were applied; a
+// database that was never migrated has none
+func appliedVersions(ctx context.Context, q querier) (map[int]time.Time, error) {
+	var exists bool
+	if err := q.GetContext(ctx, &exists, `SELECT to_regclass('schema_migrations') IS NOT NULL`); err != nil {
+		return nil, err
+	}
+
+	versions := map[int]time.Time{}
+	if !exists {
+		return versions, nil
+	}
+
+	var rows []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := q.SelectContext(ctx, &rows, `SELECT version, applied_at FROM schema_migrations`); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+	return versions, nil
+}
+
+// checkVersioned returns ErrUnversioned when no migration is recorded but the
+// schema already holds tables other than schema_migrations
+func checkVersioned(ctx context.Context, q querier, versions map[int]time.Time) error {
+	if len(versions) > 0 {
+		return nil
+	}
+
+	var exists bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.tables
+			WHERE table_schema = current_schema()
+				AND table_type = 'BASE TABLE'
+				AND table_name <> 'schema_migrations'
+		)`
+	if err := q.GetContext(ctx, &exists, query); err != nil {
+		return err
+	}
+	if exists {
+		return ErrUnversioned
+	}
+	return nil
+}
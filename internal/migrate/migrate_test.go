@@ -0,0 +1,227 @@
+package migrate
+
+import (
+	"agenda-api/internal/database"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_b.sql":    {Data: []byte("-- +migrate Up\nCREATE TABLE b (id INT);\n-- +migrate Down\nDROP TABLE b;\n")},
+		"001_create_a.sql": {Data: []byte("-- leading comment\n-- +migrate Up\nCREATE TABLE a (id INT);\n")},
+		"README.md":        {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("loaded %d migrations, want 2", len(migrations))
+	}
+
+	a, b := migrations[0], migrations[1]
+	if a.Version != 1 || a.Name != "create_a" || a.Up != "CREATE TABLE a (id INT);\n" || a.Down != "" {
+		t.Errorf("first = %+v", a)
+	}
+	if b.Version != 2 || b.Name != "add_b" || b.Up != "CREATE TABLE b (id INT);\n" || b.Down != "DROP TABLE b;\n" {
+		t.Errorf("second = %+v", b)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"001_a.sql": {Data: []byte("-- +migrate Up\nSELECT 1;\n")},
+				"01_b.sql":  {Data: []byte("-- +migrate Up\nSELECT 1;\n")},
+			},
+			want: "share version 1",
+		},
+		{
+			name: "no up section",
+			fsys: fstest.MapFS{"001_a.sql": {Data: []byte("CREATE TABLE a (id INT);\n")}},
+			want: "001_a.sql: no -- +migrate Up section",
+		},
+		{
+			name: "empty up section",
+			fsys: fstest.MapFS{"001_a.sql": {Data: []byte("-- +migrate Up\n\n-- +migrate Down\nDROP TABLE a;\n")}},
+			want: "no -- +migrate Up section",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+var fixtures = fstest.MapFS{
+	"001_create_a.sql": {Data: []byte("-- +migrate Up\nCREATE TABLE a (id INT);\n-- +migrate Down\nDROP TABLE a;\n")},
+	"002_create_b.sql": {Data: []byte("-- +migrate Up\nCREATE TABLE b (id INT);\n-- +migrate Down\nDROP TABLE b;\n")},
+	"003_create_c.sql": {Data: []byte("-- +migrate Up\nCREATE TABLE c (id INT);\n-- +migrate Down\nDROP TABLE c;\n")},
+}
+
+// testDB connects to an empty schema of its own, so that migrating does not
+// touch the tables other packages test against
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	raw := os.Getenv("TEST_DATABASE_URL")
+	if raw == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := database.NewPostgresDB(raw)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	reset := `DROP SCHEMA IF EXISTS migrate_test CASCADE; CREATE SCHEMA migrate_test`
+	if _, err := admin.Exec(reset); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA IF EXISTS migrate_test CASCADE`) })
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", "migrate_test")
+	u.RawQuery = query.Encode()
+
+	db, err := database.NewPostgresDB(u.String())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tables(t *testing.T, db *sqlx.DB) string {
+	t.Helper()
+	var names []string
+	query := `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'
+		ORDER BY table_name`
+	if err := db.Select(&names, query); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(names, ",")
+}
+
+func pendingVersions(t *testing.T, runner *Runner) []int {
+	t.Helper()
+	pending, err := runner.Pending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	for _, m := range pending {
+		versions = append(versions, m.Version)
+	}
+	return versions
+}
+
+func TestUpDownRedo(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	runner, err := New(db, fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := runner.Up(ctx)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != 3 || tables(t, db) != "a,b,c" {
+		t.Fatalf("up applied %d migrations, tables %q", len(applied), tables(t, db))
+	}
+	if applied, err := runner.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second up applied %d migrations: %v", len(applied), err)
+	}
+
+	reverted, err := runner.Down(ctx, 2)
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if len(reverted) != 2 || reverted[0].Version != 3 || reverted[1].Version != 2 {
+		t.Errorf("down reverted %+v, want 3 then 2", reverted)
+	}
+	if got := tables(t, db); got != "a" {
+		t.Errorf("tables after down = %q", got)
+	}
+	if got := pendingVersions(t, runner); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("pending after down = %v", got)
+	}
+
+	redone, err := runner.Redo(ctx)
+	if err != nil {
+		t.Fatalf("redo: %v", err)
+	}
+	if redone.Version != 1 || tables(t, db) != "a" {
+		t.Errorf("redo = %d, tables %q", redone.Version, tables(t, db))
+	}
+
+	if _, err := runner.Down(ctx, 5); err != nil {
+		t.Fatalf("down past the first: %v", err)
+	}
+	if _, err := runner.Redo(ctx); err == nil {
+		t.Error("redo with nothing applied succeeded")
+	}
+}
+
+func TestUpRefusesUnversionedSchema(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	runner, err := New(db, fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrated by hand up to 002
+	if _, err := db.Exec(`CREATE TABLE a (id INT); CREATE TABLE b (id INT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runner.Up(ctx); !errors.Is(err, ErrUnversioned) {
+		t.Fatalf("up = %v, want ErrUnversioned", err)
+	}
+	if _, err := runner.Pending(ctx); !errors.Is(err, ErrUnversioned) {
+		t.Fatalf("pending = %v, want ErrUnversioned", err)
+	}
+
+	if err := runner.Baseline(ctx, 2); err != nil {
+		t.Fatalf("baseline: %v", err)
+	}
+	if got := pendingVersions(t, runner); len(got) != 1 || got[0] != 3 {
+		t.Errorf("pending after baseline = %v, want [3]", got)
+	}
+	applied, err := runner.Up(ctx)
+	if err != nil {
+		t.Fatalf("up after baseline: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 3 || tables(t, db) != "a,b,c" {
+		t.Errorf("up after baseline applied %+v, tables %q", applied, tables(t, db))
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// APITokenPrefix marks personal access tokens so they are never mistaken for JWTs
+const APITokenPrefix = "agd_"
+
+type APIScope string
+
+const (
+	ScopeEventsRead  APIScope = "events:read"
+	ScopeEventsWrite APIScope = "events:write"
+	ScopeTeamsAdmin  APIScope = "teams:admin"
+)
+
+func (s APIScope) Valid() bool {
+	switch s {
+	case ScopeEventsRead, ScopeEventsWrite, ScopeTeamsAdmin:
+		return true
+	}
+	return false
+}
+
+type APIToken struct {
+	ID         uuid.UUID      `db:"id" json:"id"`
+	UserID     uuid.UUID      `db:"user_id" json:"userId"`
+	Name       string         `db:"name" json:"name"`
+	TokenHash  string         `db:"token_hash" json:"-"`
+	Prefix     string         `db:"prefix" json:"prefix"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time     `db:"expires_at" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time     `db:"last_used_at" json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time      `db:"created_at" json:"createdAt"`
+	RevokedAt  *time.Time     `db:"revoked_at" json:"revokedAt,omitempty"`
+}
+
+// Allows reports whether the token grants a scope; managing events includes
+// reading them
+func (t *APIToken) Allows(scope APIScope) bool {
+	for _, s := range t.Scopes {
+		if APIScope(s) == scope || (APIScope(s) == ScopeEventsWrite && scope == ScopeEventsRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenOwner is an active API token together with the account it acts for
+type APITokenOwner struct {
+	APIToken
+	Email         string     `db:"email"`
+	Role          Role       `db:"role"`
+	TOTPEnabledAt *time.Time `db:"totp_enabled_at"`
+}
+
+// EffectiveRole is the role the token acts with. As with session tokens, an
+// admin without two-factor authentication only acts as a user when
+// requireAdminMFA is set.
+func (o *APITokenOwner) EffectiveRole(requireAdminMFA bool) Role {
+	if requireAdminMFA && o.Role == RoleAdmin && o.TOTPEnabledAt == nil {
+		return RoleUser
+	}
+	return o.Role
+}
+
+type CreateAPITokenInput struct {
+	Name   string     `json:"name" binding:"required,max=255"`
+	Scopes []APIScope `json:"scopes" binding:"required,min=1"`
+	// Days until the token expires; tokens without it do not expire
+	ExpiresInDays *int `json:"expiresInDays" binding:"omitempty,min=1"`
+}
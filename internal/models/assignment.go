@@ -15,12 +15,16 @@ const (
 )
 
 type EventAssignment struct {
-	ID          uuid.UUID        `db:"id" json:"id"`
-	EventID     uuid.UUID        `db:"event_id" json:"eventId"`
-	UserID      uuid.UUID        `db:"user_id" json:"userId"`
-	Status      AssignmentStatus `db:"status" json:"status"`
-	AssignedAt  time.Time        `db:"assigned_at" json:"assignedAt"`
-	RespondedAt *time.Time       `db:"responded_at" json:"respondedAt,omitempty"`
+	ID             uuid.UUID        `db:"id" json:"id"`
+	EventID        uuid.UUID        `db:"event_id" json:"eventId"`
+	UserID         uuid.UUID        `db:"user_id" json:"userId"`
+	Status         AssignmentStatus `db:"status" json:"status"`
+	Role           ParticipantRole  `db:"role" json:"role"`
+	AssignedAt     time.Time        `db:"assigned_at" json:"assignedAt"`
+	RespondedAt    *time.Time       `db:"responded_at" json:"respondedAt,omitempty"`
+	OccurrenceDate *time.Time       `db:"occurrence_date" json:"occurrenceDate,omitempty"`
+	Reason         *string          `db:"reason" json:"reason,omitempty"`
+	Conflicts      []Conflict       `db:"-" json:"conflicts,omitempty"`
 }
 
 type EventAssignmentWithDetails struct {
@@ -32,5 +36,6 @@ type EventAssignmentWithDetails struct {
 }
 
 type RespondAssignmentInput struct {
-	Status AssignmentStatus `json:"status" binding:"required,oneof=approved rejected"`
+	Status         AssignmentStatus `json:"status" binding:"required,oneof=approved rejected"`
+	OccurrenceDate *string          `json:"occurrenceDate"`
 }
@@ -12,14 +12,18 @@ const (
 	AttendanceStatusRegistered AttendanceStatus = "registered"
 	AttendanceStatusCancelled  AttendanceStatus = "cancelled"
 	AttendanceStatusAttended   AttendanceStatus = "attended"
+	AttendanceStatusWaitlisted AttendanceStatus = "waitlisted"
 )
 
 type Attendance struct {
-	ID        uuid.UUID        `db:"id" json:"id"`
-	EventID   uuid.UUID        `db:"event_id" json:"eventId"`
-	UserID    uuid.UUID        `db:"user_id" json:"userId"`
-	Status    AttendanceStatus `db:"status" json:"status"`
-	CreatedAt time.Time        `db:"created_at" json:"createdAt"`
+	ID             uuid.UUID        `db:"id" json:"id"`
+	EventID        uuid.UUID        `db:"event_id" json:"eventId"`
+	UserID         uuid.UUID        `db:"user_id" json:"userId"`
+	Status         AttendanceStatus `db:"status" json:"status"`
+	CreatedAt      time.Time        `db:"created_at" json:"createdAt"`
+	OccurrenceDate *time.Time       `db:"occurrence_date" json:"occurrenceDate,omitempty"`
+	WaitlistedAt   *time.Time       `db:"waitlisted_at" json:"waitlistedAt,omitempty"`
+	Position       *int             `db:"waitlist_position" json:"waitlistPosition,omitempty"`
 }
 
 type AttendanceWithUser struct {
@@ -27,3 +31,9 @@ type AttendanceWithUser struct {
 	UserName  string `db:"user_name" json:"userName"`
 	UserEmail string `db:"user_email" json:"userEmail"`
 }
+
+type OccurrenceCount struct {
+	EventID        uuid.UUID `db:"event_id"`
+	OccurrenceDate time.Time `db:"occurrence_date"`
+	Count          int       `db:"count"`
+}
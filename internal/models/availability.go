@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OutOfOfficeKind string
+
+const (
+	OutOfOfficeVacation  OutOfOfficeKind = "vacation"
+	OutOfOfficeSickLeave OutOfOfficeKind = "sick_leave"
+	OutOfOfficeOther     OutOfOfficeKind = "other"
+)
+
+// WorkingHours is a user's working time on one weekday (0 = Sunday), in their zone
+type WorkingHours struct {
+	UserID    uuid.UUID `db:"user_id" json:"-"`
+	Weekday   int       `db:"weekday" json:"weekday"`
+	StartTime string    `db:"start_time" json:"startTime"`
+	EndTime   string    `db:"end_time" json:"endTime"`
+}
+
+type OutOfOffice struct {
+	ID        uuid.UUID       `db:"id" json:"id"`
+	UserID    uuid.UUID       `db:"user_id" json:"userId"`
+	Kind      OutOfOfficeKind `db:"kind" json:"kind"`
+	Note      *string         `db:"note" json:"note,omitempty"`
+	StartsAt  time.Time       `db:"starts_at" json:"startsAt"`
+	EndsAt    time.Time       `db:"ends_at" json:"endsAt"`
+	CreatedAt time.Time       `db:"created_at" json:"createdAt"`
+}
+
+type WorkingHoursInput struct {
+	Weekday   int    `json:"weekday" binding:"min=0,max=6"`
+	StartTime string `json:"startTime" binding:"required"`
+	EndTime   string `json:"endTime" binding:"required"`
+}
+
+type SetWorkingHoursInput struct {
+	Days []WorkingHoursInput `json:"days" binding:"dive"`
+}
+
+// CreateOutOfOfficeInput covers whole days from StartDate to EndDate inclusive,
+// in the user's preferred zone
+type CreateOutOfOfficeInput struct {
+	Kind      OutOfOfficeKind `json:"kind" binding:"omitempty,oneof=vacation sick_leave other"`
+	Note      *string         `json:"note"`
+	StartDate string          `json:"startDate" binding:"required"`
+	EndDate   string          `json:"endDate" binding:"required"`
+}
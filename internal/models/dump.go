@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Dump is a JSON snapshot of the application data, written by `agenda export`
+// and read back by `agenda import`. Sessions, one-time tokens and API tokens
+// are never part of it; password hashes, TOTP secrets and recovery codes only
+// when Secrets is set.
+type Dump struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	ExportedAt    time.Time   `json:"exportedAt"`
+	Secrets       bool        `json:"secrets"`
+	Tables        []DumpTable `json:"tables"`
+}
+
+type DumpTable struct {
+	Name string          `json:"name"`
+	Rows json.RawMessage `json:"rows"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,20 +23,70 @@ const (
 )
 
 type Event struct {
-	ID          uuid.UUID   `db:"id" json:"id"`
-	Title       string      `db:"title" json:"title"`
-	Description string      `db:"description" json:"description"`
-	Date        time.Time   `db:"date" json:"date"`
-	StartTime   string      `db:"start_time" json:"startTime"`
-	EndTime     string      `db:"end_time" json:"endTime"`
-	Location    string      `db:"location" json:"location"`
-	Capacity    *int        `db:"capacity" json:"capacity,omitempty"`
-	Status      EventStatus `db:"status" json:"status"`
-	Type        EventType   `db:"type" json:"type"`
-	TeamID      *uuid.UUID  `db:"team_id" json:"teamId,omitempty"`
-	CreatedBy   uuid.UUID   `db:"created_by" json:"createdBy"`
-	CreatedAt   time.Time   `db:"created_at" json:"createdAt"`
-	UpdatedAt   time.Time   `db:"updated_at" json:"updatedAt"`
+	ID             uuid.UUID   `db:"id" json:"id"`
+	Title          string      `db:"title" json:"title"`
+	Description    string      `db:"description" json:"description"`
+	Date           time.Time   `db:"date" json:"date"`
+	StartTime      string      `db:"start_time" json:"startTime"`
+	EndTime        string      `db:"end_time" json:"endTime"`
+	Location       string      `db:"location" json:"location"`
+	Capacity       *int        `db:"capacity" json:"capacity,omitempty"`
+	Status         EventStatus `db:"status" json:"status"`
+	Type           EventType   `db:"type" json:"type"`
+	TeamID         *uuid.UUID  `db:"team_id" json:"teamId,omitempty"`
+	CreatedBy      uuid.UUID   `db:"created_by" json:"createdBy"`
+	CreatedAt      time.Time   `db:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time   `db:"updated_at" json:"updatedAt"`
+	RecurrenceRule *string     `db:"recurrence_rule" json:"recurrenceRule,omitempty"`
+	ICalUID        *string     `db:"ical_uid" json:"icalUid,omitempty"`
+	TimeZone       string      `db:"time_zone" json:"timeZone"`
+	StartsAt       time.Time   `db:"starts_at" json:"startsAt"`
+	EndsAt         time.Time   `db:"ends_at" json:"endsAt"`
+	OccurrenceDate *time.Time  `db:"-" json:"occurrenceDate,omitempty"`
+}
+
+// Zone returns the event's time zone, falling back to UTC
+func (e *Event) Zone() *time.Location {
+	return loadZone(e.TimeZone)
+}
+
+// SyncInstants recomputes StartsAt and EndsAt from the wall-clock date and times
+// in the event's zone. An end time before the start time means the next day.
+func (e *Event) SyncInstants() error {
+	start, err := parseClock(e.StartTime)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(e.EndTime)
+	if err != nil {
+		return err
+	}
+
+	loc := e.Zone()
+	e.StartsAt = time.Date(e.Date.Year(), e.Date.Month(), e.Date.Day(), start.Hour(), start.Minute(), start.Second(), 0, loc)
+	e.EndsAt = time.Date(e.Date.Year(), e.Date.Month(), e.Date.Day(), end.Hour(), end.Minute(), end.Second(), 0, loc)
+	if e.EndsAt.Before(e.StartsAt) {
+		e.EndsAt = time.Date(e.Date.Year(), e.Date.Month(), e.Date.Day()+1, end.Hour(), end.Minute(), end.Second(), 0, loc)
+	}
+	return nil
+}
+
+// Localize rewrites the event's date, times and instants as seen from loc
+func (e *Event) Localize(loc *time.Location) {
+	e.StartsAt = e.StartsAt.In(loc)
+	e.EndsAt = e.EndsAt.In(loc)
+	e.Date = time.Date(e.StartsAt.Year(), e.StartsAt.Month(), e.StartsAt.Day(), 0, 0, 0, 0, time.UTC)
+	e.StartTime = e.StartsAt.Format("15:04:05")
+	e.EndTime = e.EndsAt.Format("15:04:05")
+}
+
+func parseClock(value string) (time.Time, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("Invalid time format. Use HH:MM")
 }
 
 type CreateEventInput struct {
@@ -45,11 +96,13 @@ type CreateEventInput struct {
 	StartTime    string             `json:"startTime" binding:"required"`
 	EndTime      string             `json:"endTime" binding:"required"`
 	Location     string             `json:"location"`
+	TimeZone     string             `json:"timeZone"`
 	Capacity     *int               `json:"capacity"`
 	Status       EventStatus        `json:"status"`
 	Type         EventType          `json:"type"`
 	TeamID       *uuid.UUID         `json:"teamId"`
 	Participants []ParticipantInput `json:"participants"`
+	Recurrence   *RecurrenceInput   `json:"recurrence"`
 }
 
 type UpdateEventInput struct {
@@ -59,11 +112,13 @@ type UpdateEventInput struct {
 	StartTime    *string            `json:"startTime"`
 	EndTime      *string            `json:"endTime"`
 	Location     *string            `json:"location"`
+	TimeZone     *string            `json:"timeZone"`
 	Capacity     *int               `json:"capacity"`
 	Status       *EventStatus       `json:"status"`
 	Type         *EventType         `json:"type"`
 	TeamID       *uuid.UUID         `json:"teamId"`
 	Participants []ParticipantInput `json:"participants"`
+	Recurrence   *RecurrenceInput   `json:"recurrence"`
 }
 
 type EventWithAttendeeCount struct {
@@ -76,6 +131,7 @@ type EventWithAssignment struct {
 	Event
 	AssignmentStatus *AssignmentStatus `db:"assignment_status" json:"assignmentStatus,omitempty"`
 	TeamName         *string           `db:"team_name" json:"teamName,omitempty"`
+	OutOfOffice      *OutOfOffice      `db:"-" json:"outOfOffice,omitempty"`
 }
 
 type ParticipantRole string
@@ -103,6 +159,7 @@ type EventWithParticipants struct {
 	AttendeeCount int                `db:"attendee_count" json:"attendeeCount"`
 	TeamName      *string            `db:"team_name" json:"teamName,omitempty"`
 	Participants  []EventParticipant `json:"participants,omitempty"`
+	Conflicts     []Conflict         `json:"conflicts,omitempty"`
 }
 
 type EventWithParticipantCount struct {
@@ -117,3 +174,67 @@ type EventWithAssignmentAndCount struct {
 	TeamName         *string           `db:"team_name" json:"teamName,omitempty"`
 	ParticipantCount int               `db:"participant_count" json:"participantCount"`
 }
+
+type RecurrenceFrequency string
+
+const (
+	RecurrenceDaily   RecurrenceFrequency = "daily"
+	RecurrenceWeekly  RecurrenceFrequency = "weekly"
+	RecurrenceMonthly RecurrenceFrequency = "monthly"
+)
+
+type RecurrenceInput struct {
+	Frequency RecurrenceFrequency `json:"frequency" binding:"required,oneof=daily weekly monthly"`
+	Interval  int                 `json:"interval" binding:"min=0"`
+	ByDay     []string            `json:"byDay"`
+	Count     *int                `json:"count" binding:"omitempty,min=1"`
+	Until     *string             `json:"until"`
+}
+
+// RecurrenceScope selects which occurrences of a series an edit or cancellation applies to
+type RecurrenceScope string
+
+const (
+	RecurrenceScopeThis      RecurrenceScope = "this"
+	RecurrenceScopeFollowing RecurrenceScope = "following"
+	RecurrenceScopeAll       RecurrenceScope = "all"
+)
+
+type EventException struct {
+	ID           uuid.UUID  `db:"id" json:"id"`
+	EventID      uuid.UUID  `db:"event_id" json:"eventId"`
+	OriginalDate time.Time  `db:"original_date" json:"originalDate"`
+	Cancelled    bool       `db:"cancelled" json:"cancelled"`
+	Title        *string    `db:"title" json:"title,omitempty"`
+	Description  *string    `db:"description" json:"description,omitempty"`
+	Date         *time.Time `db:"date" json:"date,omitempty"`
+	StartTime    *string    `db:"start_time" json:"startTime,omitempty"`
+	EndTime      *string    `db:"end_time" json:"endTime,omitempty"`
+	Location     *string    `db:"location" json:"location,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updatedAt"`
+}
+
+type ImportAction string
+
+const (
+	ImportActionCreate ImportAction = "create"
+	ImportActionUpdate ImportAction = "update"
+	ImportActionSkip   ImportAction = "skip"
+)
+
+type ImportItem struct {
+	UID            string       `json:"uid"`
+	Action         ImportAction `json:"action"`
+	EventID        *uuid.UUID   `json:"eventId,omitempty"`
+	Title          string       `json:"title"`
+	Date           string       `json:"date"`
+	StartTime      string       `json:"startTime"`
+	EndTime        string       `json:"endTime"`
+	TimeZone       string       `json:"timeZone"`
+	Status         EventStatus  `json:"status"`
+	RecurrenceRule *string      `json:"recurrenceRule,omitempty"`
+	Exceptions     int          `json:"exceptions"`
+	Warnings       []string     `json:"warnings,omitempty"`
+	Error          string       `json:"error,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FeedScope string
+
+const (
+	FeedScopeMy     FeedScope = "my"
+	FeedScopeTeam   FeedScope = "team"
+	FeedScopePublic FeedScope = "public"
+)
+
+type CalendarFeed struct {
+	ID           uuid.UUID  `db:"id" json:"id"`
+	UserID       uuid.UUID  `db:"user_id" json:"userId"`
+	Name         string     `db:"name" json:"name"`
+	TokenHash    string     `db:"token_hash" json:"-"`
+	Scope        FeedScope  `db:"scope" json:"scope"`
+	TeamID       *uuid.UUID `db:"team_id" json:"teamId,omitempty"`
+	LastPolledAt *time.Time `db:"last_polled_at" json:"lastPolledAt,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"createdAt"`
+	RevokedAt    *time.Time `db:"revoked_at" json:"revokedAt,omitempty"`
+}
+
+type CreateFeedInput struct {
+	Name   string     `json:"name" binding:"required"`
+	Scope  FeedScope  `json:"scope" binding:"required,oneof=my team public"`
+	TeamID *uuid.UUID `json:"teamId"`
+}
+
+type UpdateFeedInput struct {
+	Name *string `json:"name"`
+}
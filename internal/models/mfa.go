@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MFAChallenge struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	UserID    uuid.UUID  `db:"user_id" json:"userId"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	Attempts  int        `db:"attempts" json:"attempts"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+}
+
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPInput struct {
+	Password string `json:"password" binding:"required"`
+	// Code is a TOTP code or a recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+type VerifyMFAInput struct {
+	Challenge string `json:"challenge" binding:"required"`
+	// Code is a TOTP code or a recovery code
+	Code string `json:"code" binding:"required"`
+	// NewPassword is required when an admin forced a password reset
+	NewPassword string `json:"newPassword" binding:"omitempty,min=6"`
+}
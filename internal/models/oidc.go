@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserIdentity struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	UserID    uuid.UUID `db:"user_id" json:"userId"`
+	Issuer    string    `db:"issuer" json:"issuer"`
+	Subject   string    `db:"subject" json:"subject"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+type OIDCLogin struct {
+	ID           uuid.UUID `db:"id" json:"id"`
+	StateHash    string    `db:"state_hash" json:"-"`
+	Nonce        string    `db:"nonce" json:"-"`
+	CodeVerifier string    `db:"code_verifier" json:"-"`
+	ExpiresAt    time.Time `db:"expires_at" json:"expiresAt"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+}
+
+type OIDCCallbackInput struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
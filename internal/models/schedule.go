@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BusyEvent is an event that takes up a user's time: their own personal events,
+// approved assignments and attendance registrations. BusyOccurrenceDate is set
+// when only one occurrence of a series is booked.
+type BusyEvent struct {
+	BusyUserID         uuid.UUID  `db:"busy_user_id"`
+	BusyOccurrenceDate *time.Time `db:"busy_occurrence_date"`
+	Event
+}
+
+// Conflict is a booking of a user that overlaps the event being scheduled. As
+// with BusyInterval, the booked event is only identified to the user themselves
+// and to its creator; anyone else sees ConflictBusyTitle.
+type Conflict struct {
+	UserID         uuid.UUID  `json:"userId"`
+	EventID        *uuid.UUID `json:"eventId,omitempty"`
+	OccurrenceDate *string    `json:"occurrenceDate,omitempty"`
+	Title          string     `json:"title"`
+	StartsAt       time.Time  `json:"startsAt"`
+	EndsAt         time.Time  `json:"endsAt"`
+}
+
+// ConflictBusyTitle stands in for the title of a booking the caller may not see
+const ConflictBusyTitle = "Busy"
+
+// BusyInterval is a time a user is booked. The event is only identified to the
+// user themselves and to the event's creator.
+type BusyInterval struct {
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   time.Time  `json:"endsAt"`
+	EventID  *uuid.UUID `json:"eventId,omitempty"`
+	Title    *string    `json:"title,omitempty"`
+}
+
+type UserFreeBusy struct {
+	UserID   uuid.UUID      `json:"userId"`
+	UserName string         `json:"userName"`
+	TimeZone string         `json:"timeZone"`
+	Busy     []BusyInterval `json:"busy"`
+}
+
+// SuggestedSlot is a window in which at least the requested quorum is free
+type SuggestedSlot struct {
+	StartsAt    time.Time   `json:"startsAt"`
+	EndsAt      time.Time   `json:"endsAt"`
+	Available   []uuid.UUID `json:"available"`
+	Unavailable []uuid.UUID `json:"unavailable"`
+}
@@ -6,6 +6,25 @@ import (
 	"github.com/google/uuid"
 )
 
+type TeamRole string
+
+const (
+	TeamRoleOwner   TeamRole = "owner"
+	TeamRoleManager TeamRole = "manager"
+	TeamRoleMember  TeamRole = "member"
+)
+
+var teamRoleRank = map[TeamRole]int{
+	TeamRoleMember:  1,
+	TeamRoleManager: 2,
+	TeamRoleOwner:   3,
+}
+
+// AtLeast reports whether the role grants everything min does
+func (r TeamRole) AtLeast(min TeamRole) bool {
+	return teamRoleRank[r] >= teamRoleRank[min]
+}
+
 type Team struct {
 	ID          uuid.UUID `db:"id" json:"id"`
 	Name        string    `db:"name" json:"name"`
@@ -19,6 +38,7 @@ type TeamMember struct {
 	ID        uuid.UUID `db:"id" json:"id"`
 	TeamID    uuid.UUID `db:"team_id" json:"teamId"`
 	UserID    uuid.UUID `db:"user_id" json:"userId"`
+	Role      TeamRole  `db:"role" json:"role"`
 	CreatedAt time.Time `db:"created_at" json:"createdAt"`
 }
 
@@ -34,6 +54,12 @@ type UpdateTeamInput struct {
 
 type AddTeamMemberInput struct {
 	UserID uuid.UUID `json:"userId" binding:"required"`
+	// Defaults to member
+	Role TeamRole `json:"role" binding:"omitempty,oneof=owner manager member"`
+}
+
+type UpdateTeamMemberInput struct {
+	Role TeamRole `json:"role" binding:"required,oneof=owner manager member"`
 }
 
 type TeamWithMembers struct {
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshToken struct {
+	ID         uuid.UUID  `db:"id" json:"id"`
+	UserID     uuid.UUID  `db:"user_id" json:"userId"`
+	FamilyID   uuid.UUID  `db:"family_id" json:"-"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expiresAt"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revokedAt,omitempty"`
+	ReplacedBy *uuid.UUID `db:"replaced_by" json:"-"`
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutInput struct {
+	RefreshToken string `json:"refreshToken"`
+	// All signs the user out of every session
+	All bool `json:"all"`
+}
+
+type UserTokenPurpose string
+
+const (
+	UserTokenPasswordReset     UserTokenPurpose = "password_reset"
+	UserTokenEmailVerification UserTokenPurpose = "email_verification"
+)
+
+// UserToken is a single-use token sent to a user by email
+type UserToken struct {
+	ID        uuid.UUID        `db:"id" json:"id"`
+	UserID    uuid.UUID        `db:"user_id" json:"userId"`
+	Purpose   UserTokenPurpose `db:"purpose" json:"purpose"`
+	TokenHash string           `db:"token_hash" json:"-"`
+	ExpiresAt time.Time        `db:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time       `db:"used_at" json:"usedAt,omitempty"`
+	CreatedAt time.Time        `db:"created_at" json:"createdAt"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
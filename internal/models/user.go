@@ -14,41 +14,73 @@ const (
 )
 
 type User struct {
-	ID        uuid.UUID `db:"id" json:"id"`
-	Email     string    `db:"email" json:"email"`
-	Password  string    `db:"password" json:"-"`
-	Name      string    `db:"name" json:"name"`
-	Role      Role      `db:"role" json:"role"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	ID                    uuid.UUID  `db:"id" json:"id"`
+	Email                 string     `db:"email" json:"email"`
+	Password              string     `db:"password" json:"-"`
+	Name                  string     `db:"name" json:"name"`
+	Role                  Role       `db:"role" json:"role"`
+	TimeZone              string     `db:"time_zone" json:"timeZone"`
+	TokensValidAfter      *time.Time `db:"tokens_valid_after" json:"-"`
+	DeactivatedAt         *time.Time `db:"deactivated_at" json:"deactivatedAt,omitempty"`
+	PasswordResetRequired bool       `db:"password_reset_required" json:"passwordResetRequired"`
+	EmailVerifiedAt       *time.Time `db:"email_verified_at" json:"emailVerifiedAt,omitempty"`
+	TOTPSecret            *string    `db:"totp_secret" json:"-"`
+	TOTPEnabledAt         *time.Time `db:"totp_enabled_at" json:"-"`
+	TOTPLastStep          *int64     `db:"totp_last_step" json:"-"`
+	CreatedAt             time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt             time.Time  `db:"updated_at" json:"updatedAt"`
+}
+
+// Zone returns the user's preferred time zone, falling back to UTC
+func (u *User) Zone() *time.Location {
+	return loadZone(u.TimeZone)
 }
 
 type CreateUserInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
 	Name     string `json:"name" binding:"required"`
-	Role     Role   `json:"role"`
+	TimeZone string `json:"timeZone"`
+}
+
+type UpdateProfileInput struct {
+	Name     *string `json:"name"`
+	TimeZone *string `json:"timeZone"`
 }
 
 type LoginInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// NewPassword is required when an admin forced a password reset
+	NewPassword string `json:"newPassword" binding:"omitempty,min=6"`
+}
+
+type UpdateRoleInput struct {
+	Role Role `json:"role" binding:"required,oneof=admin user"`
 }
 
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Role      Role      `json:"role"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID            uuid.UUID  `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	Role          Role       `json:"role"`
+	TimeZone      string     `json:"timeZone"`
+	EmailVerified bool       `json:"emailVerified"`
+	MFAEnabled    bool       `json:"mfaEnabled"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
 }
 
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Email:     u.Email,
-		Name:      u.Name,
-		Role:      u.Role,
-		CreatedAt: u.CreatedAt,
+		ID:            u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		Role:          u.Role,
+		TimeZone:      u.TimeZone,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		MFAEnabled:    u.TOTPEnabledAt != nil,
+		DeactivatedAt: u.DeactivatedAt,
+		CreatedAt:     u.CreatedAt,
 	}
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// zones holds the locations loaded so far by name. time.LoadLocation reads
+// and parses the zoneinfo data on every call, and zones are looked up for
+// every event and user in a calendar or schedule.
+var zones sync.Map
+
+// loadZone returns the named location, falling back to UTC
+func loadZone(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	// Only valid names are kept, so the cache is bounded by the zone database
+	zones.Store(name, loc)
+	return loc
+}
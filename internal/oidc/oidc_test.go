@@ -0,0 +1,124 @@
+package oidc_test
+
+import (
+	"agenda-api/internal/oidc"
+	"agenda-api/internal/oidc/oidctest"
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+
+	idp, err := oidctest.NewServer("agenda")
+	if err != nil {
+		t.Fatalf("oidctest.NewServer: %v", err)
+	}
+	t.Cleanup(idp.Close)
+
+	provider := oidc.New(oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "agenda",
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}, http.DefaultClient)
+	return idp, provider
+}
+
+// signIn runs the flow up to the code the provider redirects back with
+func signIn(t *testing.T, idp *oidctest.Server, provider *oidc.Provider, verifier, nonce string, user oidctest.User) string {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, err := idp.Authorize(authURL, user)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return code
+}
+
+func TestExchange(t *testing.T) {
+	idp, provider := newProvider(t)
+
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	user := oidctest.User{
+		Subject:       "user-1",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		Name:          "Ada",
+		Groups:        []string{"staff", "agenda-admins"},
+	}
+	code := signIn(t, idp, provider, verifier, "nonce-1", user)
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if identity.Issuer != idp.Issuer() || identity.Subject != user.Subject {
+		t.Errorf("identity = %s/%s, want %s/%s", identity.Issuer, identity.Subject, idp.Issuer(), user.Subject)
+	}
+	if identity.Email != user.Email || !identity.EmailVerified || identity.Name != user.Name {
+		t.Errorf("identity = %+v, want the user's email, verification and name", identity)
+	}
+	if !slices.Equal(identity.Groups, user.Groups) {
+		t.Errorf("groups = %v, want %v", identity.Groups, user.Groups)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	user := oidctest.User{Subject: "user-1", Email: "ada@example.com"}
+
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+	}{
+		{"wrong PKCE verifier", "not-the-verifier", "nonce-1"},
+		{"wrong nonce", "", "other-nonce"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, provider := newProvider(t)
+
+			verifier, err := oidc.NewVerifier()
+			if err != nil {
+				t.Fatalf("NewVerifier: %v", err)
+			}
+			code := signIn(t, idp, provider, verifier, "nonce-1", user)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if _, err := provider.Exchange(context.Background(), code, verifier, tt.nonce); err == nil {
+				t.Error("Exchange succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestExchangeRedeemsCodeOnce(t *testing.T) {
+	idp, provider := newProvider(t)
+
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	code := signIn(t, idp, provider, verifier, "nonce-1", oidctest.User{Subject: "user-1"})
+
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce-1"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Error("second Exchange succeeded, want an error")
+	}
+}
@@ -0,0 +1,213 @@
+// Package policy decides what a user may do with a resource. Handlers and
+// route middleware ask it instead of comparing roles and owners themselves,
+// so every permission rule lives in the table below.
+package policy
+
+import (
+	"agenda-api/internal/models"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrForbidden means the subject may see the resource but not do this
+	ErrForbidden = errors.New("policy: forbidden")
+	// ErrNotFound means the resource is hidden from the subject altogether
+	ErrNotFound = errors.New("policy: not found")
+)
+
+type Action string
+
+const (
+	View   Action = "view"
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+
+	// Attendees and waitlists of an event
+	ViewAttendees Action = "view_attendees"
+	// Assignments of everyone on an event
+	ViewAssignments Action = "view_assignments"
+
+	// Adding and removing plain team members
+	ManageMembers Action = "manage_members"
+	// Granting, changing and removing owner and manager roles
+	ManageRoles Action = "manage_roles"
+	// Removing oneself from a team
+	Leave Action = "leave"
+	// Creating events for a team
+	CreateEvents Action = "create_events"
+
+	// Changing other users' roles and account status
+	ManageUsers Action = "manage_users"
+)
+
+type Kind string
+
+const (
+	KindEvent Kind = "event"
+	KindTeam  Kind = "team"
+	KindUsers Kind = "users"
+	// Things only their owner sees, like calendar feeds and API tokens
+	KindPersonal Kind = "personal"
+)
+
+// Relation is how a subject relates to a resource
+type Relation string
+
+const (
+	Admin       Relation = "admin"
+	Owner       Relation = "owner"
+	Participant Relation = "participant"
+	TeamOwner   Relation = "team_owner"
+	TeamManager Relation = "team_manager"
+	TeamMember  Relation = "team_member"
+	Anyone      Relation = "anyone"
+)
+
+// rules lists, per resource kind and action, the relations that allow it.
+// Anything not listed is denied.
+var rules = map[Kind]map[Action][]Relation{
+	KindEvent: {
+		Update:          {Admin, Owner, TeamManager},
+		Delete:          {Admin, Owner, TeamManager},
+		ViewAttendees:   {Admin, Owner, TeamManager},
+		ViewAssignments: {Admin, Owner, TeamMember, Participant},
+	},
+	KindTeam: {
+		Create:        {Anyone},
+		View:          {Admin, TeamMember},
+		Update:        {Admin, TeamManager},
+		Delete:        {Admin, TeamOwner},
+		ManageMembers: {Admin, TeamManager},
+		ManageRoles:   {Admin, TeamOwner},
+		Leave:         {TeamMember},
+		CreateEvents:  {Admin, TeamManager},
+	},
+	KindUsers: {
+		ManageUsers: {Admin},
+	},
+	KindPersonal: {
+		View:   {Owner},
+		Update: {Owner},
+		Delete: {Owner},
+	},
+}
+
+// Subject is the authenticated user asking
+type Subject struct {
+	UserID uuid.UUID
+	Role   models.Role
+}
+
+type Resource struct {
+	Kind Kind
+	// Creator or owner of the resource
+	OwnerID uuid.UUID
+	// Team the resource belongs to
+	TeamID *uuid.UUID
+	// Users taking part in an event
+	Participants []uuid.UUID
+}
+
+func Event(event *models.Event) Resource {
+	return Resource{Kind: KindEvent, OwnerID: event.CreatedBy, TeamID: event.TeamID}
+}
+
+func Team(teamID uuid.UUID) Resource {
+	return Resource{Kind: KindTeam, TeamID: &teamID}
+}
+
+// NewTeam stands for a team that is about to be created
+var NewTeam = Resource{Kind: KindTeam}
+
+// AllTeams is the list of every team, not just the subject's own
+var AllTeams = Resource{Kind: KindTeam}
+
+func Personal(ownerID uuid.UUID) Resource {
+	return Resource{Kind: KindPersonal, OwnerID: ownerID}
+}
+
+// Users is the user directory as a whole, for account administration
+var Users = Resource{Kind: KindUsers}
+
+// WithParticipants returns the resource with the users taking part in it
+func (r Resource) WithParticipants(userIDs []uuid.UUID) Resource {
+	r.Participants = userIDs
+	return r
+}
+
+// TeamRoleLookup returns a user's role in a team, sql.ErrNoRows for non-members
+type TeamRoleLookup interface {
+	GetMemberRole(teamID, userID uuid.UUID) (models.TeamRole, error)
+}
+
+type Policy struct {
+	teams TeamRoleLookup
+}
+
+func New(teams TeamRoleLookup) *Policy {
+	return &Policy{teams: teams}
+}
+
+// Authorize returns nil when the subject may perform the action, ErrNotFound
+// when the resource should be hidden from them and ErrForbidden otherwise
+func (p *Policy) Authorize(subject Subject, action Action, resource Resource) error {
+	var teamRole models.TeamRole
+	if resource.TeamID != nil {
+		role, err := p.teams.GetMemberRole(*resource.TeamID, subject.UserID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		teamRole = role
+	}
+	return Decide(subject, action, resource, teamRole)
+}
+
+// Decide applies the rules given the subject's role in the resource's team,
+// empty when they are not a member
+func Decide(subject Subject, action Action, resource Resource, teamRole models.TeamRole) error {
+	relations := Relations(subject, resource, teamRole)
+	for _, allowed := range rules[resource.Kind][action] {
+		if relations[allowed] {
+			return nil
+		}
+	}
+
+	// Teams are invisible to outsiders, and personal things to everyone else
+	switch {
+	case resource.Kind == KindTeam && !relations[Admin] && !relations[TeamMember]:
+		return ErrNotFound
+	case resource.Kind == KindPersonal:
+		return ErrNotFound
+	}
+	return ErrForbidden
+}
+
+// Relations lists how the subject relates to the resource. Team roles
+// include the ones below them.
+func Relations(subject Subject, resource Resource, teamRole models.TeamRole) map[Relation]bool {
+	relations := map[Relation]bool{Anyone: true}
+
+	if subject.Role == models.RoleAdmin {
+		relations[Admin] = true
+	}
+	if resource.OwnerID != uuid.Nil && resource.OwnerID == subject.UserID {
+		relations[Owner] = true
+	}
+	for _, userID := range resource.Participants {
+		if userID == subject.UserID {
+			relations[Participant] = true
+		}
+	}
+
+	if resource.TeamID != nil && teamRole != "" {
+		relations[TeamMember] = true
+		relations[TeamManager] = teamRole.AtLeast(models.TeamRoleManager)
+		relations[TeamOwner] = teamRole.AtLeast(models.TeamRoleOwner)
+	}
+
+	return relations
+}
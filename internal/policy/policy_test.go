@@ -0,0 +1,233 @@
+package policy
+
+import (
+	"agenda-api/internal/models"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// subjects relate to a resource in exactly one way each
+var subjects = []struct {
+	relation Relation
+	role     models.Role
+	teamRole models.TeamRole
+	owner    bool
+	partakes bool
+}{
+	{relation: Admin, role: models.RoleAdmin},
+	{relation: Owner, role: models.RoleUser, owner: true},
+	{relation: Participant, role: models.RoleUser, partakes: true},
+	{relation: TeamOwner, role: models.RoleUser, teamRole: models.TeamRoleOwner},
+	{relation: TeamManager, role: models.RoleUser, teamRole: models.TeamRoleManager},
+	{relation: TeamMember, role: models.RoleUser, teamRole: models.TeamRoleMember},
+	{relation: Anyone, role: models.RoleUser},
+}
+
+// allowed spells out the permission table independently of rules. Team roles
+// include the ones below them, so a team owner passes wherever a manager or
+// member does.
+var allowed = map[Kind]map[Action][]Relation{
+	KindEvent: {
+		Update:          {Admin, Owner, TeamOwner, TeamManager},
+		Delete:          {Admin, Owner, TeamOwner, TeamManager},
+		ViewAttendees:   {Admin, Owner, TeamOwner, TeamManager},
+		ViewAssignments: {Admin, Owner, TeamOwner, TeamManager, TeamMember, Participant},
+	},
+	KindTeam: {
+		Create:        {Admin, Owner, Participant, TeamOwner, TeamManager, TeamMember, Anyone},
+		View:          {Admin, TeamOwner, TeamManager, TeamMember},
+		Update:        {Admin, TeamOwner, TeamManager},
+		Delete:        {Admin, TeamOwner},
+		ManageMembers: {Admin, TeamOwner, TeamManager},
+		ManageRoles:   {Admin, TeamOwner},
+		Leave:         {TeamOwner, TeamManager, TeamMember},
+		CreateEvents:  {Admin, TeamOwner, TeamManager},
+	},
+	KindUsers: {
+		ManageUsers: {Admin},
+	},
+	KindPersonal: {
+		View:   {Owner},
+		Update: {Owner},
+		Delete: {Owner},
+	},
+}
+
+var actions = []Action{
+	View, Create, Update, Delete, ViewAttendees, ViewAssignments,
+	ManageMembers, ManageRoles, Leave, CreateEvents, ManageUsers,
+}
+
+func TestDecide(t *testing.T) {
+	userID, otherID := uuid.New(), uuid.New()
+	teamID := uuid.New()
+
+	for kind, kindActions := range allowed {
+		for _, action := range actions {
+			for _, s := range subjects {
+				name := string(kind) + "/" + string(action) + "/" + string(s.relation)
+				t.Run(name, func(t *testing.T) {
+					resource := Resource{Kind: kind, OwnerID: otherID, TeamID: &teamID}
+					if s.owner {
+						resource.OwnerID = userID
+					}
+					if s.partakes {
+						resource.Participants = []uuid.UUID{otherID, userID}
+					}
+
+					err := Decide(Subject{UserID: userID, Role: s.role}, action, resource, s.teamRole)
+
+					want := expected(kind, s.relation, contains(kindActions[action], s.relation))
+					if err != want {
+						t.Errorf("Decide = %v, want %v", err, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+// expected is the outcome for a subject with relation: allowed, or the
+// denial the kind hides behind
+func expected(kind Kind, relation Relation, ok bool) error {
+	switch {
+	case ok:
+		return nil
+	case kind == KindPersonal:
+		return ErrNotFound
+	case kind == KindTeam && relation != Admin && relation != TeamOwner && relation != TeamManager && relation != TeamMember:
+		return ErrNotFound
+	}
+	return ErrForbidden
+}
+
+func TestRulesAreCovered(t *testing.T) {
+	for kind, kindRules := range rules {
+		for action, relations := range kindRules {
+			if _, ok := allowed[kind][action]; !ok {
+				t.Errorf("rule %s/%s is not in the test table", kind, action)
+			}
+			for _, relation := range relations {
+				if !contains(allowed[kind][action], relation) {
+					t.Errorf("rule %s/%s allows %s, the test table does not", kind, action, relation)
+				}
+			}
+		}
+	}
+}
+
+func TestDecideWithoutTeam(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   Action
+		resource Resource
+		want     error
+	}{
+		{"anyone creates a team", Subject{UserID: userID, Role: models.RoleUser}, Create, NewTeam, nil},
+		{"admin lists all teams", Subject{UserID: userID, Role: models.RoleAdmin}, View, AllTeams, nil},
+		{"user does not list all teams", Subject{UserID: userID, Role: models.RoleUser}, View, AllTeams, ErrNotFound},
+		{"admin manages users", Subject{UserID: userID, Role: models.RoleAdmin}, ManageUsers, Users, nil},
+		{"user does not manage users", Subject{UserID: userID, Role: models.RoleUser}, ManageUsers, Users, ErrForbidden},
+		{"owner views personal", Subject{UserID: userID, Role: models.RoleUser}, View, Personal(userID), nil},
+		{"admin does not view personal", Subject{UserID: userID, Role: models.RoleAdmin}, View, Personal(uuid.New()), ErrNotFound},
+		{"event without team is not a team member's", Subject{UserID: userID, Role: models.RoleUser}, ViewAssignments, Resource{Kind: KindEvent, OwnerID: uuid.New()}, ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Decide(tt.subject, tt.action, tt.resource, ""); err != tt.want {
+				t.Errorf("Decide = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelations(t *testing.T) {
+	userID := uuid.New()
+	teamID := uuid.New()
+	team := Resource{Kind: KindTeam, TeamID: &teamID}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		resource Resource
+		teamRole models.TeamRole
+		want     []Relation
+	}{
+		{"stranger", Subject{UserID: userID, Role: models.RoleUser}, team, "", []Relation{Anyone}},
+		{"admin", Subject{UserID: userID, Role: models.RoleAdmin}, team, "", []Relation{Anyone, Admin}},
+		{"team member", Subject{UserID: userID, Role: models.RoleUser}, team, models.TeamRoleMember, []Relation{Anyone, TeamMember}},
+		{"team manager", Subject{UserID: userID, Role: models.RoleUser}, team, models.TeamRoleManager, []Relation{Anyone, TeamMember, TeamManager}},
+		{"team owner", Subject{UserID: userID, Role: models.RoleUser}, team, models.TeamRoleOwner, []Relation{Anyone, TeamMember, TeamManager, TeamOwner}},
+		{"team role without team", Subject{UserID: userID, Role: models.RoleUser}, Resource{Kind: KindEvent}, models.TeamRoleOwner, []Relation{Anyone}},
+		{"owner", Subject{UserID: userID, Role: models.RoleUser}, Personal(userID), "", []Relation{Anyone, Owner}},
+		{"nil owner", Subject{UserID: uuid.Nil, Role: models.RoleUser}, Resource{Kind: KindEvent}, "", []Relation{Anyone}},
+		{"participant", Subject{UserID: userID, Role: models.RoleUser}, Resource{Kind: KindEvent}.WithParticipants([]uuid.UUID{userID}), "", []Relation{Anyone, Participant}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Relations(tt.subject, tt.resource, tt.teamRole)
+			for _, relation := range tt.want {
+				if !got[relation] {
+					t.Errorf("missing %s in %v", relation, got)
+				}
+			}
+			for relation, ok := range got {
+				if ok && !contains(tt.want, relation) {
+					t.Errorf("unexpected %s in %v", relation, got)
+				}
+			}
+		})
+	}
+}
+
+type teamRoles map[uuid.UUID]models.TeamRole
+
+func (r teamRoles) GetMemberRole(teamID, userID uuid.UUID) (models.TeamRole, error) {
+	role, ok := r[userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return role, nil
+}
+
+type failingLookup struct{}
+
+func (failingLookup) GetMemberRole(teamID, userID uuid.UUID) (models.TeamRole, error) {
+	return "", errors.New("database is down")
+}
+
+func TestAuthorizeLooksUpTeamRole(t *testing.T) {
+	memberID, strangerID := uuid.New(), uuid.New()
+	teamID := uuid.New()
+	p := New(teamRoles{memberID: models.TeamRoleManager})
+
+	if err := p.Authorize(Subject{UserID: memberID, Role: models.RoleUser}, Update, Team(teamID)); err != nil {
+		t.Errorf("manager updating the team: %v", err)
+	}
+	if err := p.Authorize(Subject{UserID: strangerID, Role: models.RoleUser}, View, Team(teamID)); err != ErrNotFound {
+		t.Errorf("stranger viewing the team = %v, want %v", err, ErrNotFound)
+	}
+
+	failing := New(failingLookup{})
+	err := failing.Authorize(Subject{UserID: memberID, Role: models.RoleUser}, View, Team(teamID))
+	if err == nil || err == ErrNotFound || err == ErrForbidden {
+		t.Errorf("lookup failure = %v, want the lookup error", err)
+	}
+}
+
+func contains(relations []Relation, relation Relation) bool {
+	for _, r := range relations {
+		if r == relation {
+			return true
+		}
+	}
+	return false
+}
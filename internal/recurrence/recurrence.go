@@ -0,0 +1,257 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"agenda-api/internal/models"
+
+	"github.com/teambition/rrule-go"
+)
+
+const dateLayout = "2006-01-02"
+
+var frequencies = map[models.RecurrenceFrequency]rrule.Frequency{
+	models.RecurrenceDaily:   rrule.DAILY,
+	models.RecurrenceWeekly:  rrule.WEEKLY,
+	models.RecurrenceMonthly: rrule.MONTHLY,
+}
+
+var weekdays = map[string]rrule.Weekday{
+	"MO": rrule.MO,
+	"TU": rrule.TU,
+	"WE": rrule.WE,
+	"TH": rrule.TH,
+	"FR": rrule.FR,
+	"SA": rrule.SA,
+	"SU": rrule.SU,
+}
+
+// BuildRule converts the API recurrence input into an RRULE value (without
+// DTSTART). An until date is inclusive and read in loc.
+func BuildRule(input models.RecurrenceInput, loc *time.Location) (string, error) {
+	freq, ok := frequencies[input.Frequency]
+	if !ok {
+		return "", fmt.Errorf("unsupported frequency %q", input.Frequency)
+	}
+
+	option := rrule.ROption{Freq: freq, Interval: input.Interval}
+
+	for _, day := range input.ByDay {
+		weekday, ok := weekdays[strings.ToUpper(day)]
+		if !ok {
+			return "", fmt.Errorf("invalid byDay value %q", day)
+		}
+		option.Byweekday = append(option.Byweekday, weekday)
+	}
+
+	if input.Count != nil && input.Until != nil {
+		return "", errors.New("count and until cannot be combined")
+	}
+	if input.Count != nil {
+		option.Count = *input.Count
+	}
+	if input.Until != nil {
+		until, err := time.Parse(dateLayout, *input.Until)
+		if err != nil {
+			return "", errors.New("invalid until format. Use YYYY-MM-DD")
+		}
+		option.Until = endOfDay(until, loc)
+	}
+
+	return option.RRuleString(), nil
+}
+
+// Validate checks that rule is a well-formed RRULE value
+func Validate(rule string) error {
+	_, err := newRule(rule, time.Now().UTC().Truncate(24*time.Hour))
+	return err
+}
+
+// Between returns the occurrence start instants of a series within [start, end].
+// Occurrences are generated in the zone of dtstart, so they keep their wall-clock
+// time across DST changes.
+func Between(rule string, dtstart, start, end time.Time) ([]time.Time, error) {
+	r, err := newRule(rule, dtstart)
+	if err != nil {
+		return nil, err
+	}
+	return r.Between(start, end, true), nil
+}
+
+// IsOccurrence reports whether the series has an occurrence on date, a calendar
+// day in the zone of dtstart
+func IsOccurrence(rule string, dtstart, date time.Time) (bool, error) {
+	loc := dtstart.Location()
+	dates, err := Between(rule, dtstart, startOfDay(date, loc), endOfDay(date, loc))
+	if err != nil {
+		return false, err
+	}
+	return len(dates) > 0, nil
+}
+
+// Truncate ends the series on the day before at, a calendar day in loc
+func Truncate(rule string, at time.Time, loc *time.Location) (string, error) {
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return "", err
+	}
+	option.Count = 0
+	option.Until = endOfDay(at.AddDate(0, 0, -1), loc)
+	return option.RRuleString(), nil
+}
+
+// Split divides a series at the occurrence on day at, returning the rule that
+// ends the original series and the rule for a new series starting at at. A
+// COUNT limit is shared out so the total number of occurrences stays the same.
+func Split(rule string, dtstart, at time.Time) (before, after string, err error) {
+	loc := dtstart.Location()
+	before, err = Truncate(rule, at, loc)
+	if err != nil {
+		return "", "", err
+	}
+
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return "", "", err
+	}
+	if option.Count > 0 {
+		previous, err := Between(rule, dtstart, dtstart, startOfDay(at, loc).Add(-time.Second))
+		if err != nil {
+			return "", "", err
+		}
+		option.Count -= len(previous)
+		if option.Count < 1 {
+			option.Count = 1
+		}
+	}
+
+	return before, option.RRuleString(), nil
+}
+
+// Expand returns the occurrences of a recurring event starting within
+// [start, end) with its exceptions applied. Each occurrence carries its
+// original OccurrenceDate, the calendar day in the event's zone.
+func Expand(event models.Event, exceptions []models.EventException, start, end time.Time) ([]models.Event, error) {
+	if event.RecurrenceRule == nil {
+		return nil, nil
+	}
+
+	byDate := make(map[string]*models.EventException, len(exceptions))
+	for i := range exceptions {
+		byDate[exceptions[i].OriginalDate.Format(dateLayout)] = &exceptions[i]
+	}
+
+	dtstart := event.StartsAt.In(event.Zone())
+	starts, err := Between(*event.RecurrenceRule, dtstart, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var occurrences []models.Event
+	seen := make(map[string]bool, len(starts))
+	for _, occurrenceStart := range starts {
+		date := wallDate(occurrenceStart)
+		key := date.Format(dateLayout)
+		seen[key] = true
+
+		exception := byDate[key]
+		if exception != nil && exception.Cancelled {
+			continue
+		}
+		occurrence := Apply(event, date, exception)
+		if inRange(occurrence.StartsAt, start, end) {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	// Occurrences moved into the range from outside it
+	for i := range exceptions {
+		exception := &exceptions[i]
+		if exception.Cancelled || exception.Date == nil || seen[exception.OriginalDate.Format(dateLayout)] {
+			continue
+		}
+		occurrence := Apply(event, exception.OriginalDate, exception)
+		if !inRange(occurrence.StartsAt, start, end) {
+			continue
+		}
+		ok, err := IsOccurrence(*event.RecurrenceRule, dtstart, exception.OriginalDate)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartsAt.Before(occurrences[j].StartsAt)
+	})
+
+	return occurrences, nil
+}
+
+// Apply builds the occurrence of event on date, with exception overrides if any
+func Apply(event models.Event, date time.Time, exception *models.EventException) models.Event {
+	occurrence := event
+	occurrenceDate := date
+	occurrence.Date = date
+	occurrence.OccurrenceDate = &occurrenceDate
+
+	if exception != nil {
+		if exception.Title != nil {
+			occurrence.Title = *exception.Title
+		}
+		if exception.Description != nil {
+			occurrence.Description = *exception.Description
+		}
+		if exception.Date != nil {
+			occurrence.Date = *exception.Date
+		}
+		if exception.StartTime != nil {
+			occurrence.StartTime = *exception.StartTime
+		}
+		if exception.EndTime != nil {
+			occurrence.EndTime = *exception.EndTime
+		}
+		if exception.Location != nil {
+			occurrence.Location = *exception.Location
+		}
+		if exception.Cancelled {
+			occurrence.Status = models.EventStatusCancelled
+		}
+	}
+
+	// Times come from the database or validated input, so they always parse
+	occurrence.SyncInstants()
+	return occurrence
+}
+
+func newRule(rule string, dtstart time.Time) (*rrule.RRule, error) {
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, err
+	}
+	option.Dtstart = dtstart
+	return rrule.NewRRule(*option)
+}
+
+func inRange(t, start, end time.Time) bool {
+	return !t.Before(start) && t.Before(end)
+}
+
+// wallDate returns the calendar day of t in its own zone, as stored in DATE columns
+func wallDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfDay(date time.Time, loc *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+}
+
+func endOfDay(date time.Time, loc *time.Location) time.Time {
+	return startOfDay(date, loc).AddDate(0, 0, 1).Add(-time.Second)
+}
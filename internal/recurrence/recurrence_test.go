@@ -0,0 +1,334 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"agenda-api/internal/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// days lists the calendar days a rule produces from dtstart within a year
+func days(t *testing.T, rule string, dtstart time.Time) string {
+	t.Helper()
+	starts, err := Between(rule, dtstart, dtstart, dtstart.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("between %s: %v", rule, err)
+	}
+	var out []string
+	for _, start := range starts {
+		out = append(out, start.Format(dateLayout))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestBuildRule(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtstart := time.Date(2025, 3, 3, 9, 0, 0, 0, amsterdam) // a Monday
+
+	tests := []struct {
+		name  string
+		input models.RecurrenceInput
+		want  string
+		err   string
+	}{
+		{
+			name:  "daily count",
+			input: models.RecurrenceInput{Frequency: models.RecurrenceDaily, Count: ptr(3)},
+			want:  "2025-03-03 2025-03-04 2025-03-05",
+		},
+		{
+			name:  "weekly by day",
+			input: models.RecurrenceInput{Frequency: models.RecurrenceWeekly, ByDay: []string{"mo", "TH"}, Count: ptr(4)},
+			want:  "2025-03-03 2025-03-06 2025-03-10 2025-03-13",
+		},
+		{
+			name:  "until is inclusive",
+			input: models.RecurrenceInput{Frequency: models.RecurrenceDaily, Interval: 2, Until: ptr("2025-03-07")},
+			want:  "2025-03-03 2025-03-05 2025-03-07",
+		},
+		{
+			name:  "count and until",
+			input: models.RecurrenceInput{Frequency: models.RecurrenceDaily, Count: ptr(3), Until: ptr("2025-03-07")},
+			err:   "cannot be combined",
+		},
+		{
+			name:  "invalid day",
+			input: models.RecurrenceInput{Frequency: models.RecurrenceWeekly, ByDay: []string{"XX"}},
+			err:   "invalid byDay",
+		},
+		{
+			name:  "invalid until",
+			input: models.RecurrenceInput{Frequency: models.RecurrenceDaily, Until: ptr("07/03/2025")},
+			err:   "invalid until",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := BuildRule(tt.input, amsterdam)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := days(t, rule, dtstart); got != tt.want {
+				t.Errorf("%s gives %s, want %s", rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	dtstart := time.Date(2025, 3, 3, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		rule string
+		want string
+	}{
+		{"count", "FREQ=DAILY;COUNT=10", "2025-03-03 2025-03-04 2025-03-05"},
+		{"until", "FREQ=DAILY;UNTIL=20250310T235959Z", "2025-03-03 2025-03-04 2025-03-05"},
+		{"unbounded", "FREQ=DAILY", "2025-03-03 2025-03-04 2025-03-05"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A late start must not spill the last occurrence past the day
+			rule, err := Truncate(tt.rule, date("2025-03-06"), time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := days(t, rule, dtstart); got != tt.want {
+				t.Errorf("%s gives %s, want %s", rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dtstart := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC) // a Monday
+
+	tests := []struct {
+		name   string
+		rule   string
+		at     string
+		before string
+		after  string
+	}{
+		{
+			name:   "count is carried across",
+			rule:   "FREQ=DAILY;COUNT=5",
+			at:     "2025-03-05",
+			before: "2025-03-03 2025-03-04",
+			after:  "2025-03-05 2025-03-06 2025-03-07",
+		},
+		{
+			name:   "count with by day",
+			rule:   "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=5",
+			at:     "2025-03-10",
+			before: "2025-03-03 2025-03-05",
+			after:  "2025-03-10 2025-03-12 2025-03-17",
+		},
+		{
+			name:   "count at the first occurrence",
+			rule:   "FREQ=DAILY;COUNT=3",
+			at:     "2025-03-03",
+			before: "",
+			after:  "2025-03-03 2025-03-04 2025-03-05",
+		},
+		{
+			name:   "count at the last occurrence",
+			rule:   "FREQ=DAILY;COUNT=3",
+			at:     "2025-03-05",
+			before: "2025-03-03 2025-03-04",
+			after:  "2025-03-05",
+		},
+		{
+			name:   "until is kept",
+			rule:   "FREQ=DAILY;INTERVAL=2;UNTIL=20250311T235959Z",
+			at:     "2025-03-07",
+			before: "2025-03-03 2025-03-05",
+			after:  "2025-03-07 2025-03-09 2025-03-11",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := date(tt.at)
+			before, after, err := Split(tt.rule, dtstart, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := days(t, before, dtstart); got != tt.before {
+				t.Errorf("before %s gives %q, want %q", before, got, tt.before)
+			}
+			newStart := time.Date(at.Year(), at.Month(), at.Day(), 9, 0, 0, 0, time.UTC)
+			if got := days(t, after, newStart); got != tt.after {
+				t.Errorf("after %s gives %q, want %q", after, got, tt.after)
+			}
+		})
+	}
+}
+
+func series(t *testing.T, zone, rule string) models.Event {
+	t.Helper()
+	event := models.Event{
+		Title:          "Standup",
+		Location:       "Room 1",
+		Date:           date("2025-03-28"),
+		StartTime:      "09:00:00",
+		EndTime:        "09:15:00",
+		Status:         models.EventStatusPublished,
+		RecurrenceRule: &rule,
+		TimeZone:       zone,
+	}
+	if err := event.SyncInstants(); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestExpand(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 3, 28, 0, 0, 0, 0, amsterdam)
+	end := start.AddDate(0, 0, 5)
+
+	tests := []struct {
+		name       string
+		rule       string
+		exceptions []models.EventException
+		want       []string
+	}{
+		{
+			name: "keeps wall-clock time across DST",
+			rule: "FREQ=DAILY",
+			want: []string{
+				"2025-03-28 08:00 Standup", "2025-03-29 08:00 Standup", "2025-03-30 07:00 Standup",
+				"2025-03-31 07:00 Standup", "2025-04-01 07:00 Standup",
+			},
+		},
+		{
+			name: "count ends the series",
+			rule: "FREQ=DAILY;COUNT=2",
+			want: []string{"2025-03-28 08:00 Standup", "2025-03-29 08:00 Standup"},
+		},
+		{
+			name: "cancelled occurrences are left out",
+			rule: "FREQ=DAILY;COUNT=3",
+			exceptions: []models.EventException{
+				{OriginalDate: date("2025-03-29"), Cancelled: true},
+			},
+			want: []string{"2025-03-28 08:00 Standup", "2025-03-30 07:00 Standup"},
+		},
+		{
+			name: "overrides apply to their occurrence",
+			rule: "FREQ=DAILY;COUNT=2",
+			exceptions: []models.EventException{
+				{OriginalDate: date("2025-03-29"), Title: ptr("Retro"), StartTime: ptr("10:00:00"), EndTime: ptr("11:00:00")},
+			},
+			want: []string{"2025-03-28 08:00 Standup", "2025-03-29 09:00 Retro"},
+		},
+		{
+			name: "moved out of the range",
+			rule: "FREQ=DAILY;COUNT=2",
+			exceptions: []models.EventException{
+				{OriginalDate: date("2025-03-29"), Date: ptr(date("2025-04-10"))},
+			},
+			want: []string{"2025-03-28 08:00 Standup"},
+		},
+		{
+			name: "moved into the range",
+			rule: "FREQ=WEEKLY;COUNT=2",
+			exceptions: []models.EventException{
+				{OriginalDate: date("2025-04-04"), Date: ptr(date("2025-03-31"))},
+			},
+			want: []string{"2025-03-28 08:00 Standup", "2025-03-31 07:00 Standup"},
+		},
+		{
+			name: "exceptions off the series are ignored",
+			rule: "FREQ=WEEKLY;COUNT=2",
+			exceptions: []models.EventException{
+				{OriginalDate: date("2025-04-05"), Date: ptr(date("2025-03-31"))},
+			},
+			want: []string{"2025-03-28 08:00 Standup"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			occurrences, err := Expand(series(t, "Europe/Amsterdam", tt.rule), tt.exceptions, start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range occurrences {
+				got = append(got, o.StartsAt.UTC().Format("2006-01-02 15:04")+" "+o.Title)
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	event := series(t, "UTC", "FREQ=DAILY")
+	day := date("2025-03-30")
+
+	plain := Apply(event, day, nil)
+	if !plain.Date.Equal(day) || plain.OccurrenceDate == nil || !plain.OccurrenceDate.Equal(day) {
+		t.Errorf("date = %v, occurrence date = %v", plain.Date, plain.OccurrenceDate)
+	}
+	if want := time.Date(2025, 3, 30, 9, 0, 0, 0, time.UTC); !plain.StartsAt.Equal(want) {
+		t.Errorf("starts at %v, want %v", plain.StartsAt, want)
+	}
+
+	moved := Apply(event, day, &models.EventException{
+		OriginalDate: day,
+		Date:         ptr(date("2025-03-31")),
+		EndTime:      ptr("08:00:00"),
+		Location:     ptr("Room 2"),
+		Description:  ptr("Moved"),
+	})
+	if !moved.OccurrenceDate.Equal(day) {
+		t.Errorf("occurrence date = %v, want the original day", moved.OccurrenceDate)
+	}
+	if moved.Location != "Room 2" || moved.Description != "Moved" || moved.Title != "Standup" {
+		t.Errorf("overrides = %q %q %q", moved.Location, moved.Description, moved.Title)
+	}
+	// Ending before it starts runs into the next day
+	if want := time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC); !moved.EndsAt.Equal(want) {
+		t.Errorf("ends at %v, want %v", moved.EndsAt, want)
+	}
+
+	cancelled := Apply(event, day, &models.EventException{OriginalDate: day, Cancelled: true})
+	if cancelled.Status != models.EventStatusCancelled {
+		t.Errorf("status = %s", cancelled.Status)
+	}
+	if event.OccurrenceDate != nil || !event.Date.Equal(date("2025-03-28")) {
+		t.Error("Apply modified the series")
+	}
+}
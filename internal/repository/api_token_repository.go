@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type APITokenRepository struct {
+	db *contextDB
+}
+
+func NewAPITokenRepository(db *sqlx.DB) *APITokenRepository {
+	return &APITokenRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *APITokenRepository) With(ctx context.Context) *APITokenRepository {
+	return &APITokenRepository{db: r.db.with(ctx)}
+}
+
+func (r *APITokenRepository) Create(apiToken *models.APIToken) error {
+	query := `
+		INSERT INTO api_tokens (id, user_id, name, token_hash, prefix, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowx(
+		query,
+		apiToken.ID, apiToken.UserID, apiToken.Name, apiToken.TokenHash, apiToken.Prefix,
+		apiToken.Scopes, apiToken.ExpiresAt, apiToken.CreatedAt,
+	).Scan(&apiToken.ID, &apiToken.CreatedAt)
+}
+
+func (r *APITokenRepository) GetByID(id uuid.UUID) (*models.APIToken, error) {
+	var apiToken models.APIToken
+	query := `SELECT * FROM api_tokens WHERE id = $1`
+	err := r.db.Get(&apiToken, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &apiToken, nil
+}
+
+func (r *APITokenRepository) GetActiveByUserID(userID uuid.UUID) ([]models.APIToken, error) {
+	var apiTokens []models.APIToken
+	query := `
+		SELECT * FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`
+	err := r.db.Select(&apiTokens, query, userID)
+	return apiTokens, err
+}
+
+func (r *APITokenRepository) Revoke(id uuid.UUID) error {
+	query := `UPDATE api_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), id)
+	return err
+}
+
+// Authenticate looks up an active, unexpired token of an active user and
+// records its use; sql.ErrNoRows means the token is not valid
+func (r *APITokenRepository) Authenticate(tokenHash string) (*models.APITokenOwner, error) {
+	var owner models.APITokenOwner
+	query := `
+		UPDATE api_tokens t SET last_used_at = $2
+		FROM users u
+		WHERE t.user_id = u.id AND t.token_hash = $1
+		  AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > $2)
+		  AND u.deactivated_at IS NULL
+		RETURNING t.*, u.email, u.role, u.totp_enabled_at`
+	err := r.db.Get(&owner, query, tokenHash, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
@@ -2,37 +2,49 @@ package repository
 
 import (
 	"agenda-api/internal/models"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type AssignmentRepository struct {
-	db *sqlx.DB
+	db *contextDB
 }
 
 func NewAssignmentRepository(db *sqlx.DB) *AssignmentRepository {
-	return &AssignmentRepository{db: db}
+	return &AssignmentRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *AssignmentRepository) With(ctx context.Context) *AssignmentRepository {
+	return &AssignmentRepository{db: r.db.with(ctx)}
 }
 
 func (r *AssignmentRepository) Create(assignment *models.EventAssignment) error {
 	query := `
-		INSERT INTO event_assignments (id, event_id, user_id, status, assigned_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO event_assignments (id, event_id, user_id, status, role, assigned_at, responded_at, occurrence_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, assigned_at`
 
+	if assignment.Role == "" {
+		assignment.Role = models.ParticipantRoleParticipant
+	}
+
 	return r.db.QueryRowx(
 		query,
-		assignment.ID, assignment.EventID, assignment.UserID, assignment.Status, assignment.AssignedAt,
+		assignment.ID, assignment.EventID, assignment.UserID, assignment.Status, assignment.Role,
+		assignment.AssignedAt, assignment.RespondedAt, assignment.OccurrenceDate,
 	).Scan(&assignment.ID, &assignment.AssignedAt)
 }
 
 func (r *AssignmentRepository) CreateBatch(assignments []models.EventAssignment) error {
 	query := `
-		INSERT INTO event_assignments (id, event_id, user_id, status, assigned_at)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (event_id, user_id) DO NOTHING`
+		INSERT INTO event_assignments (id, event_id, user_id, status, assigned_at, responded_at, occurrence_date, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING`
 
 	tx, err := r.db.Beginx()
 	if err != nil {
@@ -40,7 +52,7 @@ func (r *AssignmentRepository) CreateBatch(assignments []models.EventAssignment)
 	}
 
 	for _, a := range assignments {
-		_, err := tx.Exec(query, a.ID, a.EventID, a.UserID, a.Status, a.AssignedAt)
+		_, err := tx.Exec(query, a.ID, a.EventID, a.UserID, a.Status, a.AssignedAt, a.RespondedAt, a.OccurrenceDate, a.Reason)
 		if err != nil {
 			tx.Rollback()
 			return err
@@ -62,7 +74,7 @@ func (r *AssignmentRepository) GetByID(id uuid.UUID) (*models.EventAssignment, e
 
 func (r *AssignmentRepository) GetByEventAndUser(eventID, userID uuid.UUID) (*models.EventAssignment, error) {
 	var assignment models.EventAssignment
-	query := `SELECT * FROM event_assignments WHERE event_id = $1 AND user_id = $2`
+	query := `SELECT * FROM event_assignments WHERE event_id = $1 AND user_id = $2 AND occurrence_date IS NULL`
 	err := r.db.Get(&assignment, query, eventID, userID)
 	if err != nil {
 		return nil, err
@@ -70,6 +82,26 @@ func (r *AssignmentRepository) GetByEventAndUser(eventID, userID uuid.UUID) (*mo
 	return &assignment, nil
 }
 
+func (r *AssignmentRepository) GetByEventUserAndOccurrence(eventID, userID uuid.UUID, occurrenceDate time.Time) (*models.EventAssignment, error) {
+	var assignment models.EventAssignment
+	query := `SELECT * FROM event_assignments WHERE event_id = $1 AND user_id = $2 AND occurrence_date = $3`
+	err := r.db.Get(&assignment, query, eventID, userID, occurrenceDate)
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+func (r *AssignmentRepository) GetOccurrencesByUserID(userID uuid.UUID, eventIDs []uuid.UUID, start, end time.Time) ([]models.EventAssignment, error) {
+	var assignments []models.EventAssignment
+	query := `
+		SELECT * FROM event_assignments
+		WHERE user_id = $1 AND event_id = ANY($2)
+		  AND occurrence_date >= $3 AND occurrence_date <= $4`
+	err := r.db.Select(&assignments, query, userID, pq.Array(eventIDs), start, end)
+	return assignments, err
+}
+
 func (r *AssignmentRepository) GetByUserID(userID uuid.UUID, status *models.AssignmentStatus) ([]models.EventAssignmentWithDetails, error) {
 	var assignments []models.EventAssignmentWithDetails
 	var query string
@@ -77,17 +109,17 @@ func (r *AssignmentRepository) GetByUserID(userID uuid.UUID, status *models.Assi
 
 	baseQuery := `
 		SELECT ea.*, u.name as user_name, u.email as user_email,
-		       e.title as event_title, e.date::text as event_date
+		       e.title as event_title, COALESCE(ea.occurrence_date, e.date)::text as event_date
 		FROM event_assignments ea
 		INNER JOIN users u ON ea.user_id = u.id
 		INNER JOIN events e ON ea.event_id = e.id
 		WHERE ea.user_id = $1`
 
 	if status != nil {
-		query = baseQuery + ` AND ea.status = $2 ORDER BY e.date, e.start_time`
+		query = baseQuery + ` AND ea.status = $2 ORDER BY e.starts_at`
 		args = append(args, userID, *status)
 	} else {
-		query = baseQuery + ` ORDER BY e.date, e.start_time`
+		query = baseQuery + ` ORDER BY e.starts_at`
 		args = append(args, userID)
 	}
 
@@ -99,12 +131,12 @@ func (r *AssignmentRepository) GetByEventID(eventID uuid.UUID) ([]models.EventAs
 	var assignments []models.EventAssignmentWithDetails
 	query := `
 		SELECT ea.*, u.name as user_name, u.email as user_email,
-		       e.title as event_title, e.date::text as event_date
+		       e.title as event_title, COALESCE(ea.occurrence_date, e.date)::text as event_date
 		FROM event_assignments ea
 		INNER JOIN users u ON ea.user_id = u.id
 		INNER JOIN events e ON ea.event_id = e.id
 		WHERE ea.event_id = $1
-		ORDER BY u.name`
+		ORDER BY u.name, ea.occurrence_date NULLS FIRST`
 	err := r.db.Select(&assignments, query, eventID)
 	return assignments, err
 }
@@ -137,3 +169,17 @@ func (r *AssignmentRepository) GetPendingCountByUserID(userID uuid.UUID) (int, e
 	err := r.db.Get(&count, query, userID)
 	return count, err
 }
+
+func (r *AssignmentRepository) GetByEventIDs(eventIDs []uuid.UUID) ([]models.EventAssignmentWithDetails, error) {
+	var assignments []models.EventAssignmentWithDetails
+	query := `
+		SELECT ea.*, u.name as user_name, u.email as user_email,
+		       e.title as event_title, COALESCE(ea.occurrence_date, e.date)::text as event_date
+		FROM event_assignments ea
+		INNER JOIN users u ON ea.user_id = u.id
+		INNER JOIN events e ON ea.event_id = e.id
+		WHERE ea.event_id = ANY($1)
+		ORDER BY u.name, ea.occurrence_date NULLS FIRST`
+	err := r.db.Select(&assignments, query, pq.Array(eventIDs))
+	return assignments, err
+}
@@ -2,65 +2,326 @@ package repository
 
 import (
 	"agenda-api/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
+var (
+	ErrAlreadyRegistered = errors.New("already registered")
+	ErrAlreadyWaitlisted = errors.New("already waitlisted")
+)
+
 type AttendanceRepository struct {
-	db *sqlx.DB
+	db *contextDB
 }
 
 func NewAttendanceRepository(db *sqlx.DB) *AttendanceRepository {
-	return &AttendanceRepository{db: db}
+	return &AttendanceRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *AttendanceRepository) With(ctx context.Context) *AttendanceRepository {
+	return &AttendanceRepository{db: r.db.with(ctx)}
 }
 
 func (r *AttendanceRepository) Create(attendance *models.Attendance) error {
 	query := `
-		INSERT INTO attendance (id, event_id, user_id, status, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO attendance (id, event_id, user_id, status, created_at, occurrence_date, waitlisted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at`
 
 	return r.db.QueryRowx(
 		query,
 		attendance.ID, attendance.EventID, attendance.UserID, attendance.Status, attendance.CreatedAt,
+		attendance.OccurrenceDate, attendance.WaitlistedAt,
 	).Scan(&attendance.ID, &attendance.CreatedAt)
 }
 
-func (r *AttendanceRepository) GetByEventAndUser(eventID, userID uuid.UUID) (*models.Attendance, error) {
+func (r *AttendanceRepository) GetByEventAndUser(eventID, userID uuid.UUID, occurrenceDate *time.Time) (*models.Attendance, error) {
 	var attendance models.Attendance
-	query := `SELECT * FROM attendance WHERE event_id = $1 AND user_id = $2`
-	err := r.db.Get(&attendance, query, eventID, userID)
+	query := `
+		SELECT * FROM attendance
+		WHERE event_id = $1 AND user_id = $2 AND occurrence_date IS NOT DISTINCT FROM $3`
+	err := r.db.Get(&attendance, query, eventID, userID, occurrenceDate)
 	if err != nil {
 		return nil, err
 	}
 	return &attendance, nil
 }
 
-func (r *AttendanceRepository) GetByEventID(eventID uuid.UUID) ([]models.AttendanceWithUser, error) {
+func (r *AttendanceRepository) GetByEventID(eventID uuid.UUID, occurrenceDate *time.Time) ([]models.AttendanceWithUser, error) {
 	var attendances []models.AttendanceWithUser
 	query := `
 		SELECT a.*, u.name as user_name, u.email as user_email
 		FROM attendance a
 		JOIN users u ON a.user_id = u.id
 		WHERE a.event_id = $1 AND a.status = 'registered'
+		  AND a.occurrence_date IS NOT DISTINCT FROM $2
 		ORDER BY a.created_at`
 
-	err := r.db.Select(&attendances, query, eventID)
+	err := r.db.Select(&attendances, query, eventID, occurrenceDate)
+	return attendances, err
+}
+
+// GetWaitlist returns the waitlisted registrations of an event in promotion order
+func (r *AttendanceRepository) GetWaitlist(eventID uuid.UUID, occurrenceDate *time.Time) ([]models.AttendanceWithUser, error) {
+	var attendances []models.AttendanceWithUser
+	query := `
+		SELECT a.*, u.name as user_name, u.email as user_email,
+		       ROW_NUMBER() OVER (ORDER BY a.waitlisted_at, a.id) as waitlist_position
+		FROM attendance a
+		JOIN users u ON a.user_id = u.id
+		WHERE a.event_id = $1 AND a.status = 'waitlisted'
+		  AND a.occurrence_date IS NOT DISTINCT FROM $2
+		ORDER BY a.waitlisted_at, a.id`
+
+	err := r.db.Select(&attendances, query, eventID, occurrenceDate)
 	return attendances, err
 }
 
 func (r *AttendanceRepository) GetByUserID(userID uuid.UUID) ([]models.Attendance, error) {
 	var attendances []models.Attendance
-	query := `SELECT * FROM attendance WHERE user_id = $1 ORDER BY created_at DESC`
+	query := `
+		SELECT a.*,
+		       CASE WHEN a.status = 'waitlisted' THEN (
+		           SELECT COUNT(*) + 1 FROM attendance w
+		           WHERE w.event_id = a.event_id AND w.status = 'waitlisted'
+		             AND w.occurrence_date IS NOT DISTINCT FROM a.occurrence_date
+		             AND (w.waitlisted_at, w.id) < (a.waitlisted_at, a.id)
+		       ) END as waitlist_position
+		FROM attendance a
+		WHERE a.user_id = $1
+		ORDER BY a.created_at DESC`
 	err := r.db.Select(&attendances, query, userID)
 	return attendances, err
 }
 
-func (r *AttendanceRepository) UpdateStatus(id uuid.UUID, status models.AttendanceStatus) error {
-	query := `UPDATE attendance SET status = $1 WHERE id = $2`
-	_, err := r.db.Exec(query, status, id)
-	return err
+// Register registers a user for an event, or puts them on the waitlist once
+// the event's capacity is reached or others are already waiting. Registrations
+// for the same event are serialized by locking the event row, and the
+// capacity is read under that lock, so neither concurrent registrations nor a
+// concurrent capacity change can overbook it. A cancelled registration is
+// reused; created is false in that case.
+func (r *AttendanceRepository) Register(attendance *models.Attendance) (created bool, err error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	capacity, err := lockEvent(tx, attendance.EventID)
+	if err != nil {
+		return false, err
+	}
+
+	var existing models.Attendance
+	err = tx.Get(&existing, `
+		SELECT * FROM attendance
+		WHERE event_id = $1 AND user_id = $2 AND occurrence_date IS NOT DISTINCT FROM $3`,
+		attendance.EventID, attendance.UserID, attendance.OccurrenceDate,
+	)
+	switch {
+	case err == sql.ErrNoRows:
+		err = nil
+	case err != nil:
+		return false, err
+	case existing.Status == models.AttendanceStatusWaitlisted:
+		return false, ErrAlreadyWaitlisted
+	case existing.Status != models.AttendanceStatusCancelled:
+		return false, ErrAlreadyRegistered
+	}
+
+	attendance.Status = models.AttendanceStatusRegistered
+	attendance.WaitlistedAt = nil
+	if capacity != nil {
+		var counts struct {
+			Registered int `db:"registered"`
+			Waitlisted int `db:"waitlisted"`
+		}
+		if err = tx.Get(&counts, `
+			SELECT COUNT(*) FILTER (WHERE status = 'registered') AS registered,
+			       COUNT(*) FILTER (WHERE status = 'waitlisted') AS waitlisted
+			FROM attendance
+			WHERE event_id = $1 AND occurrence_date IS NOT DISTINCT FROM $2`,
+			attendance.EventID, attendance.OccurrenceDate,
+		); err != nil {
+			return false, err
+		}
+		// A free place belongs to the first person waiting, not to a newcomer
+		if counts.Registered >= *capacity || counts.Waitlisted > 0 {
+			now := time.Now()
+			attendance.Status = models.AttendanceStatusWaitlisted
+			attendance.WaitlistedAt = &now
+		}
+	}
+
+	if existing.ID != uuid.Nil {
+		attendance.ID = existing.ID
+		attendance.CreatedAt = existing.CreatedAt
+		_, err = tx.Exec(
+			`UPDATE attendance SET status = $1, waitlisted_at = $2 WHERE id = $3`,
+			attendance.Status, attendance.WaitlistedAt, attendance.ID,
+		)
+	} else {
+		created = true
+		err = tx.QueryRowx(`
+			INSERT INTO attendance (id, event_id, user_id, status, created_at, occurrence_date, waitlisted_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at`,
+			attendance.ID, attendance.EventID, attendance.UserID, attendance.Status, attendance.CreatedAt,
+			attendance.OccurrenceDate, attendance.WaitlistedAt,
+		).Scan(&attendance.ID, &attendance.CreatedAt)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return created, tx.Commit()
+}
+
+// lockEvent takes a row lock on the event until the end of the transaction
+// and returns its capacity as of then
+func lockEvent(tx *contextTx, eventID uuid.UUID) (*int, error) {
+	var capacity *int
+	err := tx.Get(&capacity, `SELECT capacity FROM events WHERE id = $1 FOR UPDATE`, eventID)
+	return capacity, err
+}
+
+func (r *AttendanceRepository) GetWaitlistPosition(attendance *models.Attendance) (int, error) {
+	var position int
+	query := `
+		SELECT COUNT(*) + 1 FROM attendance
+		WHERE event_id = $1 AND status = 'waitlisted' AND occurrence_date IS NOT DISTINCT FROM $2
+		  AND (waitlisted_at, id) < ($3, $4)`
+	err := r.db.Get(&position, query, attendance.EventID, attendance.OccurrenceDate, attendance.WaitlistedAt, attendance.ID)
+	return position, err
+}
+
+// GetWaitlistedOccurrences returns the occurrences of an event that have a
+// waitlist, with nil standing for a single event
+func (r *AttendanceRepository) GetWaitlistedOccurrences(eventID uuid.UUID) ([]*time.Time, error) {
+	var dates []sql.NullTime
+	query := `SELECT DISTINCT occurrence_date FROM attendance WHERE event_id = $1 AND status = 'waitlisted'`
+	if err := r.db.Select(&dates, query, eventID); err != nil {
+		return nil, err
+	}
+
+	occurrences := make([]*time.Time, len(dates))
+	for i, date := range dates {
+		if date.Valid {
+			occurrences[i] = &date.Time
+		}
+	}
+	return occurrences, nil
+}
+
+// Cancel cancels a registration or a place on the waitlist under the event
+// lock and, when the registration held a place, gives it to the first person
+// waiting in the same transaction. It returns the status the registration was
+// cancelled from, or sql.ErrNoRows when it was already cancelled.
+func (r *AttendanceRepository) Cancel(attendance *models.Attendance) (models.AttendanceStatus, []models.Attendance, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	capacity, err := lockEvent(tx, attendance.EventID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var status models.AttendanceStatus
+	if err := tx.Get(&status, `SELECT status FROM attendance WHERE id = $1`, attendance.ID); err != nil {
+		return "", nil, err
+	}
+	if status == models.AttendanceStatusCancelled {
+		return "", nil, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE attendance SET status = 'cancelled', waitlisted_at = NULL WHERE id = $1`, attendance.ID,
+	); err != nil {
+		return "", nil, err
+	}
+
+	var promoted []models.Attendance
+	if status == models.AttendanceStatusRegistered {
+		promoted, err = promoteWaitlisted(tx, attendance.EventID, attendance.OccurrenceDate, capacity)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return status, promoted, tx.Commit()
+}
+
+// PromoteWaitlisted moves waitlisted registrations, first come first served,
+// into the places left free under the event's capacity (all of them when it
+// has none) and returns the promoted registrations
+func (r *AttendanceRepository) PromoteWaitlisted(eventID uuid.UUID, occurrenceDate *time.Time) ([]models.Attendance, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	capacity, err := lockEvent(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	promoted, err := promoteWaitlisted(tx, eventID, occurrenceDate, capacity)
+	if err != nil {
+		return nil, err
+	}
+	return promoted, tx.Commit()
+}
+
+// promoteWaitlisted fills the free places of an occurrence from its waitlist;
+// the caller holds the event lock
+func promoteWaitlisted(tx *contextTx, eventID uuid.UUID, occurrenceDate *time.Time, capacity *int) ([]models.Attendance, error) {
+	var limit *int
+	if capacity != nil {
+		var registered int
+		if err := tx.Get(&registered, `
+			SELECT COUNT(*) FROM attendance
+			WHERE event_id = $1 AND status = 'registered' AND occurrence_date IS NOT DISTINCT FROM $2`,
+			eventID, occurrenceDate,
+		); err != nil {
+			return nil, err
+		}
+		free := *capacity - registered
+		if free <= 0 {
+			return nil, nil
+		}
+		limit = &free
+	}
+
+	var promoted []models.Attendance
+	query := `
+		UPDATE attendance SET status = 'registered', waitlisted_at = NULL
+		WHERE id IN (
+		    SELECT id FROM attendance
+		    WHERE event_id = $1 AND status = 'waitlisted' AND occurrence_date IS NOT DISTINCT FROM $2
+		    ORDER BY waitlisted_at, id
+		    LIMIT $3
+		    FOR UPDATE
+		)
+		RETURNING *`
+	if err := tx.Select(&promoted, query, eventID, occurrenceDate, limit); err != nil {
+		return nil, err
+	}
+	return promoted, nil
 }
 
 func (r *AttendanceRepository) Delete(eventID, userID uuid.UUID) error {
@@ -69,9 +330,11 @@ func (r *AttendanceRepository) Delete(eventID, userID uuid.UUID) error {
 	return err
 }
 
-func (r *AttendanceRepository) CountByEventID(eventID uuid.UUID) (int, error) {
+func (r *AttendanceRepository) CountByEventID(eventID uuid.UUID, occurrenceDate *time.Time) (int, error) {
 	var count int
-	query := `SELECT COUNT(*) FROM attendance WHERE event_id = $1 AND status = 'registered'`
-	err := r.db.Get(&count, query, eventID)
+	query := `
+		SELECT COUNT(*) FROM attendance
+		WHERE event_id = $1 AND status = 'registered' AND occurrence_date IS NOT DISTINCT FROM $2`
+	err := r.db.Get(&count, query, eventID, occurrenceDate)
 	return count, err
 }
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRegisterDoesNotOverbook(t *testing.T) {
+	db := testDB(t)
+
+	const capacity, registrations = 5, 300
+
+	// Fewer connections than registrations, so they queue on the pool as
+	// well as on the event lock without exhausting the server's connections
+	db.SetMaxOpenConns(25)
+
+	organizer := createTestUser(t, db)
+	places := capacity
+	event := createTestEvent(t, db, organizer.ID, &places)
+
+	users := make([]*models.User, registrations)
+	for i := range users {
+		users[i] = createTestUser(t, db)
+	}
+
+	repo := NewAttendanceRepository(db)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, registrations)
+	for _, user := range users {
+		wg.Add(1)
+		go func(userID uuid.UUID) {
+			defer wg.Done()
+			_, err := repo.Register(&models.Attendance{
+				ID:        uuid.New(),
+				EventID:   event.ID,
+				UserID:    userID,
+				CreatedAt: time.Now(),
+			})
+			errs <- err
+		}(user.ID)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+
+	registered, err := repo.CountByEventID(event.ID, nil)
+	if err != nil {
+		t.Fatalf("CountByEventID: %v", err)
+	}
+	if registered != capacity {
+		t.Errorf("registered = %d, want %d", registered, capacity)
+	}
+
+	waitlist, err := repo.GetWaitlist(event.ID, nil)
+	if err != nil {
+		t.Fatalf("GetWaitlist: %v", err)
+	}
+	if len(waitlist) != registrations-capacity {
+		t.Errorf("waitlisted = %d, want %d", len(waitlist), registrations-capacity)
+	}
+	for i, attendance := range waitlist {
+		if attendance.Position == nil || *attendance.Position != i+1 {
+			t.Errorf("waitlist[%d] has position %v, want %d", i, attendance.Position, i+1)
+		}
+	}
+}
+
+func TestRegisterReadsCapacityUnderLock(t *testing.T) {
+	db := testDB(t)
+
+	organizer := createTestUser(t, db)
+	places := 1
+	event := createTestEvent(t, db, organizer.ID, &places)
+
+	repo := NewAttendanceRepository(db)
+	register := func(userID uuid.UUID) *models.Attendance {
+		t.Helper()
+		attendance := &models.Attendance{ID: uuid.New(), EventID: event.ID, UserID: userID, CreatedAt: time.Now()}
+		if _, err := repo.Register(attendance); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		return attendance
+	}
+
+	if got := register(createTestUser(t, db).ID).Status; got != models.AttendanceStatusRegistered {
+		t.Fatalf("first registration = %s, want registered", got)
+	}
+
+	// The capacity stored now applies, not the one the caller last saw
+	if _, err := db.Exec(`UPDATE events SET capacity = 2 WHERE id = $1`, event.ID); err != nil {
+		t.Fatalf("raise capacity: %v", err)
+	}
+	if got := register(createTestUser(t, db).ID).Status; got != models.AttendanceStatusRegistered {
+		t.Errorf("second registration = %s, want registered", got)
+	}
+	if got := register(createTestUser(t, db).ID).Status; got != models.AttendanceStatusWaitlisted {
+		t.Errorf("third registration = %s, want waitlisted", got)
+	}
+}
+
+func TestRegisterQueuesBehindWaitlist(t *testing.T) {
+	db := testDB(t)
+
+	organizer := createTestUser(t, db)
+	places := 1
+	event := createTestEvent(t, db, organizer.ID, &places)
+
+	repo := NewAttendanceRepository(db)
+	register := func() *models.Attendance {
+		t.Helper()
+		attendance := &models.Attendance{ID: uuid.New(), EventID: event.ID, UserID: createTestUser(t, db).ID, CreatedAt: time.Now()}
+		if _, err := repo.Register(attendance); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		return attendance
+	}
+
+	register()
+	register()
+	// A place frees up without the waitlist being promoted yet
+	if _, err := db.Exec(`UPDATE events SET capacity = 2 WHERE id = $1`, event.ID); err != nil {
+		t.Fatalf("raise capacity: %v", err)
+	}
+	if got := register().Status; got != models.AttendanceStatusWaitlisted {
+		t.Errorf("newcomer = %s, want waitlisted behind the existing waitlist", got)
+	}
+}
+
+func TestCancelPromotesFirstWaitlisted(t *testing.T) {
+	db := testDB(t)
+
+	organizer := createTestUser(t, db)
+	places := 1
+	event := createTestEvent(t, db, organizer.ID, &places)
+
+	repo := NewAttendanceRepository(db)
+	attendances := make([]*models.Attendance, 3)
+	for i := range attendances {
+		attendances[i] = &models.Attendance{ID: uuid.New(), EventID: event.ID, UserID: createTestUser(t, db).ID, CreatedAt: time.Now()}
+		if _, err := repo.Register(attendances[i]); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+
+	status, promoted, err := repo.Cancel(attendances[0])
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if status != models.AttendanceStatusRegistered {
+		t.Errorf("cancelled from %s, want registered", status)
+	}
+	if len(promoted) != 1 || promoted[0].ID != attendances[1].ID {
+		t.Errorf("promoted %v, want the first waitlisted registration %s", promoted, attendances[1].ID)
+	}
+
+	// Leaving the waitlist frees no place
+	status, promoted, err = repo.Cancel(attendances[2])
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if status != models.AttendanceStatusWaitlisted || len(promoted) != 0 {
+		t.Errorf("cancel from waitlist = %s, promoted %v; want waitlisted, none", status, promoted)
+	}
+
+	if _, _, err := repo.Cancel(attendances[0]); err != sql.ErrNoRows {
+		t.Errorf("second Cancel = %v, want %v", err, sql.ErrNoRows)
+	}
+}
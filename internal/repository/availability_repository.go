@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type AvailabilityRepository struct {
+	db *contextDB
+}
+
+func NewAvailabilityRepository(db *sqlx.DB) *AvailabilityRepository {
+	return &AvailabilityRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *AvailabilityRepository) With(ctx context.Context) *AvailabilityRepository {
+	return &AvailabilityRepository{db: r.db.with(ctx)}
+}
+
+func (r *AvailabilityRepository) GetWorkingHours(userID uuid.UUID) ([]models.WorkingHours, error) {
+	var hours []models.WorkingHours
+	query := `SELECT * FROM working_hours WHERE user_id = $1 ORDER BY weekday`
+	err := r.db.Select(&hours, query, userID)
+	return hours, err
+}
+
+func (r *AvailabilityRepository) GetWorkingHoursByUserIDs(userIDs []uuid.UUID) ([]models.WorkingHours, error) {
+	var hours []models.WorkingHours
+	query := `SELECT * FROM working_hours WHERE user_id = ANY($1) ORDER BY user_id, weekday`
+	err := r.db.Select(&hours, query, pq.Array(userIDs))
+	return hours, err
+}
+
+func (r *AvailabilityRepository) ReplaceWorkingHours(userID uuid.UUID, hours []models.WorkingHours) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM working_hours WHERE user_id = $1`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `
+		INSERT INTO working_hours (user_id, weekday, start_time, end_time)
+		VALUES ($1, $2, $3, $4)`
+	for _, h := range hours {
+		if _, err := tx.Exec(query, userID, h.Weekday, h.StartTime, h.EndTime); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *AvailabilityRepository) CreateOutOfOffice(ooo *models.OutOfOffice) error {
+	query := `
+		INSERT INTO out_of_office (id, user_id, kind, note, starts_at, ends_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowx(
+		query,
+		ooo.ID, ooo.UserID, ooo.Kind, ooo.Note, ooo.StartsAt, ooo.EndsAt, ooo.CreatedAt,
+	).Scan(&ooo.ID, &ooo.CreatedAt)
+}
+
+func (r *AvailabilityRepository) GetOutOfOfficeByID(id uuid.UUID) (*models.OutOfOffice, error) {
+	var ooo models.OutOfOffice
+	query := `SELECT * FROM out_of_office WHERE id = $1`
+	err := r.db.Get(&ooo, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &ooo, nil
+}
+
+func (r *AvailabilityRepository) GetOutOfOfficeByUserID(userID uuid.UUID) ([]models.OutOfOffice, error) {
+	var blocks []models.OutOfOffice
+	query := `SELECT * FROM out_of_office WHERE user_id = $1 ORDER BY starts_at`
+	err := r.db.Select(&blocks, query, userID)
+	return blocks, err
+}
+
+// GetOutOfOfficeByUserIDs returns the blocks of userIDs overlapping [start, end)
+func (r *AvailabilityRepository) GetOutOfOfficeByUserIDs(userIDs []uuid.UUID, start, end time.Time) ([]models.OutOfOffice, error) {
+	var blocks []models.OutOfOffice
+	query := `
+		SELECT * FROM out_of_office
+		WHERE user_id = ANY($1) AND starts_at < $3 AND ends_at > $2
+		ORDER BY starts_at`
+	err := r.db.Select(&blocks, query, pq.Array(userIDs), start, end)
+	return blocks, err
+}
+
+func (r *AvailabilityRepository) DeleteOutOfOffice(id uuid.UUID) error {
+	query := `DELETE FROM out_of_office WHERE id = $1`
+	_, err := r.db.Exec(query, id)
+	return err
+}
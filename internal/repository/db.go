@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextDB runs the queries of a repository under the context it was bound
+// to with With, recording a span per statement that is named after the
+// repository method issuing it. Bound values never reach the span. Queries
+// outside a recording span cost nothing extra: no span is started and the
+// stack is not walked.
+type contextDB struct {
+	db  *sqlx.DB
+	ctx context.Context
+}
+
+func newContextDB(db *sqlx.DB) *contextDB {
+	return &contextDB{db: db, ctx: context.Background()}
+}
+
+// with binds ctx, so that queries carry its span and stop when it is cancelled
+func (d *contextDB) with(ctx context.Context) *contextDB {
+	return &contextDB{db: d.db, ctx: ctx}
+}
+
+func (d *contextDB) Get(dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(d.ctx, query)
+	err := d.db.GetContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (d *contextDB) Select(dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(d.ctx, query)
+	err := d.db.SelectContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (d *contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(d.ctx, query)
+	result, err := d.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (d *contextDB) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startQuery(d.ctx, query)
+	row := d.db.QueryRowxContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+func (d *contextDB) Beginx() (*contextTx, error) {
+	tx, err := d.db.BeginTxx(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &contextTx{tx: tx, ctx: d.ctx}, nil
+}
+
+// contextTx is a transaction begun by contextDB
+type contextTx struct {
+	tx  *sqlx.Tx
+	ctx context.Context
+}
+
+func (t *contextTx) Get(dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(t.ctx, query)
+	err := t.tx.GetContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (t *contextTx) Select(dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startQuery(t.ctx, query)
+	err := t.tx.SelectContext(ctx, dest, query, args...)
+	endQuery(span, err)
+	return err
+}
+
+func (t *contextTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(t.ctx, query)
+	result, err := t.tx.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (t *contextTx) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	ctx, span := startQuery(t.ctx, query)
+	row := t.tx.QueryRowxContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+func (t *contextTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *contextTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// rowQueryer runs single-row queries, inside a transaction or not
+type rowQueryer interface {
+	QueryRowx(query string, args ...interface{}) *sqlx.Row
+}
+
+var tracer = otel.Tracer("agenda-api/internal/repository")
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, nil
+	}
+
+	operation := "query"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracer.Start(ctx, statementName(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+func endQuery(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+var packagePath = reflect.TypeOf(contextDB{}).PkgPath() + "."
+
+// statementName names a query after the first repository function on the
+// stack outside this file, e.g. "EventRepository.GetCalendarByUserID"
+func statementName() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		name, ok := strings.CutPrefix(frame.Function, packagePath)
+		if ok && !strings.HasPrefix(name, "(*contextDB)") && !strings.HasPrefix(name, "(*contextTx)") {
+			return strings.NewReplacer("(*", "", ")", "").Replace(name)
+		}
+		if !more {
+			return "query"
+		}
+	}
+}
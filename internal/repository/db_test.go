@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestStartQuerySkipsUnrecordedSpans(t *testing.T) {
+	// Without an exporter the request span exists but is not recording
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()))
+	ctx, root := provider.Tracer("test").Start(context.Background(), "GET /api/events")
+	if root.IsRecording() {
+		t.Fatal("span records without an exporter")
+	}
+
+	got, span := startQuery(ctx, "SELECT 1")
+	if span != nil || got != ctx {
+		t.Errorf("startQuery started span %v", span)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := startQuery(ctx, "SELECT * FROM events WHERE id = $1")
+		endQuery(span, nil)
+	})
+	if allocs != 0 {
+		t.Errorf("startQuery allocates %v times per unrecorded query, want 0", allocs)
+	}
+}
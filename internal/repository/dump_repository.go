@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// dumpTables are exported and imported in this order, parents before children
+var dumpTables = []string{
+	"users",
+	"teams",
+	"team_members",
+	"events",
+	"event_exceptions",
+	"event_assignments",
+	"attendance",
+	"calendar_feeds",
+	"working_hours",
+	"out_of_office",
+	"recovery_codes",
+	"user_identities",
+}
+
+// dumpSecretTables hold nothing but credentials and are only exported on request
+var dumpSecretTables = map[string]bool{
+	"recovery_codes": true,
+}
+
+// dumpSecretColumns are overwritten with these values unless secrets are
+// exported. Imported accounts then have no usable password or second factor
+// and are signed in again through a password reset.
+var dumpSecretColumns = map[string]string{
+	"users": `{"password": "", "totp_secret": null, "totp_enabled_at": null, "totp_last_step": null}`,
+}
+
+type DumpRepository struct {
+	db *contextDB
+}
+
+func NewDumpRepository(db *sqlx.DB) *DumpRepository {
+	return &DumpRepository{db: newContextDB(db)}
+}
+
+// Export reads every dumped table in one snapshot. Password hashes, TOTP
+// secrets and recovery codes are left out unless secrets is set.
+func (r *DumpRepository) Export(secrets bool) ([]models.DumpTable, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY`); err != nil {
+		return nil, err
+	}
+
+	tables := make([]models.DumpTable, 0, len(dumpTables))
+	for _, name := range dumpTables {
+		if dumpSecretTables[name] && !secrets {
+			continue
+		}
+		var rows []byte
+		query := fmt.Sprintf(`SELECT COALESCE(json_agg(t), '[]') FROM %s t`, name)
+		if redacted, ok := dumpSecretColumns[name]; ok && !secrets {
+			query = fmt.Sprintf(`SELECT COALESCE(json_agg(to_jsonb(t) || '%s'::jsonb), '[]') FROM %s t`, redacted, name)
+		}
+		if err := tx.Get(&rows, query); err != nil {
+			return nil, fmt.Errorf("export %s: %w", name, err)
+		}
+		tables = append(tables, models.DumpTable{Name: name, Rows: json.RawMessage(rows)})
+	}
+	return tables, nil
+}
+
+// Import inserts the rows of a dump in one transaction and returns how many
+// rows each table gained. Rows whose key already exists are left untouched.
+func (r *DumpRepository) Import(tables []models.DumpTable) (map[string]int64, error) {
+	byName := make(map[string]json.RawMessage, len(tables))
+	for _, table := range tables {
+		byName[table.Name] = table.Rows
+	}
+	for name := range byName {
+		if !isDumpTable(name) {
+			return nil, fmt.Errorf("import: unknown table %q", name)
+		}
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := make(map[string]int64, len(byName))
+	for _, name := range dumpTables {
+		rows, ok := byName[name]
+		if !ok {
+			continue
+		}
+		query := fmt.Sprintf(
+			`INSERT INTO %[1]s SELECT * FROM json_populate_recordset(NULL::%[1]s, $1) ON CONFLICT DO NOTHING`, name,
+		)
+		result, err := tx.Exec(query, string(rows))
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("import %s: %w", name, err)
+		}
+		inserted[name], _ = result.RowsAffected()
+	}
+
+	return inserted, tx.Commit()
+}
+
+func isDumpTable(name string) bool {
+	for _, table := range dumpTables {
+		if table == name {
+			return true
+		}
+	}
+	return false
+}
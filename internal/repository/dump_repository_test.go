@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"encoding/json"
+	"testing"
+)
+
+func TestExportLeavesOutSecrets(t *testing.T) {
+	db := testDB(t)
+	user := createTestUser(t, db)
+
+	if _, err := db.Exec(`UPDATE users SET password = 'bcrypt-hash' WHERE id = $1`, user.ID); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	mfa := NewMFARepository(db)
+	if err := mfa.SetPendingSecret(user.ID, "TOTPSECRET"); err != nil {
+		t.Fatalf("SetPendingSecret: %v", err)
+	}
+	if err := mfa.EnableTOTP(user.ID, 1, []string{"code-hash"}); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	exported := func(secrets bool) (map[string]interface{}, bool) {
+		t.Helper()
+		tables, err := NewDumpRepository(db).Export(secrets)
+		if err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		var row map[string]interface{}
+		recoveryCodes := false
+		for _, table := range tables {
+			switch table.Name {
+			case "recovery_codes":
+				recoveryCodes = true
+			case "users":
+				row = findRow(t, table, user.ID.String())
+			}
+		}
+		return row, recoveryCodes
+	}
+
+	row, recoveryCodes := exported(false)
+	if row["password"] != "" || row["totp_secret"] != nil || row["totp_enabled_at"] != nil {
+		t.Errorf("user row = %v, want password, totp_secret and totp_enabled_at cleared", row)
+	}
+	if row["email"] != user.Email {
+		t.Errorf("email = %v, want %s", row["email"], user.Email)
+	}
+	if recoveryCodes {
+		t.Error("recovery_codes exported without secrets")
+	}
+
+	row, recoveryCodes = exported(true)
+	if row["password"] != "bcrypt-hash" || row["totp_secret"] != "TOTPSECRET" {
+		t.Errorf("user row = %v, want secrets with -include-secrets", row)
+	}
+	if !recoveryCodes {
+		t.Error("recovery_codes missing with secrets")
+	}
+}
+
+func findRow(t *testing.T, table models.DumpTable, id string) map[string]interface{} {
+	t.Helper()
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(table.Rows, &rows); err != nil {
+		t.Fatalf("decode %s: %v", table.Name, err)
+	}
+	for _, row := range rows {
+		if row["id"] == id {
+			return row
+		}
+	}
+	t.Fatalf("%s has no row %s", table.Name, id)
+	return nil
+}
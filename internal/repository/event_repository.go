@@ -2,31 +2,43 @@ package repository
 
 import (
 	"agenda-api/internal/models"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type EventRepository struct {
-	db *sqlx.DB
+	db *contextDB
 }
 
 func NewEventRepository(db *sqlx.DB) *EventRepository {
-	return &EventRepository{db: db}
+	return &EventRepository{db: newContextDB(db)}
 }
 
+// With returns a copy of the repository whose queries run under ctx
+func (r *EventRepository) With(ctx context.Context) *EventRepository {
+	return &EventRepository{db: r.db.with(ctx)}
+}
+
+const insertEventQuery = `
+	INSERT INTO events (id, title, description, date, start_time, end_time, location, capacity, status, type, team_id, created_by, created_at, updated_at, recurrence_rule, ical_uid, time_zone, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	RETURNING id, created_at, updated_at`
+
 func (r *EventRepository) Create(event *models.Event) error {
-	query := `
-		INSERT INTO events (id, title, description, date, start_time, end_time, location, capacity, status, type, team_id, created_by, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-		RETURNING id, created_at, updated_at`
+	return insertEvent(r.db, event)
+}
 
-	return r.db.QueryRowx(
-		query,
+func insertEvent(q rowQueryer, event *models.Event) error {
+	return q.QueryRowx(
+		insertEventQuery,
 		event.ID, event.Title, event.Description, event.Date, event.StartTime, event.EndTime,
 		event.Location, event.Capacity, event.Status, event.Type, event.TeamID, event.CreatedBy,
-		event.CreatedAt, event.UpdatedAt,
+		event.CreatedAt, event.UpdatedAt, event.RecurrenceRule, event.ICalUID, event.TimeZone,
+		event.StartsAt, event.EndsAt,
 	).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt)
 }
 
@@ -40,6 +52,16 @@ func (r *EventRepository) GetByID(id uuid.UUID) (*models.Event, error) {
 	return &event, nil
 }
 
+func (r *EventRepository) GetByICalUID(createdBy uuid.UUID, uid string) (*models.Event, error) {
+	var event models.Event
+	query := `SELECT * FROM events WHERE created_by = $1 AND ical_uid = $2`
+	err := r.db.Get(&event, query, createdBy, uid)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
 func (r *EventRepository) GetAll(status *models.EventStatus) ([]models.EventWithAttendeeCount, error) {
 	var events []models.EventWithAttendeeCount
 	var query string
@@ -53,10 +75,10 @@ func (r *EventRepository) GetAll(status *models.EventStatus) ([]models.EventWith
 		LEFT JOIN attendance a ON e.id = a.event_id`
 
 	if status != nil {
-		query = baseQuery + ` WHERE e.status = $1 GROUP BY e.id, t.name ORDER BY e.date, e.start_time`
+		query = baseQuery + ` WHERE e.status = $1 GROUP BY e.id, t.name ORDER BY e.starts_at`
 		args = append(args, *status)
 	} else {
-		query = baseQuery + ` GROUP BY e.id, t.name ORDER BY e.date, e.start_time`
+		query = baseQuery + ` GROUP BY e.id, t.name ORDER BY e.starts_at`
 	}
 
 	err := r.db.Select(&events, query, args...)
@@ -71,9 +93,10 @@ func (r *EventRepository) GetByDateRange(start, end time.Time) ([]models.EventWi
 		FROM events e
 		LEFT JOIN teams t ON e.team_id = t.id
 		LEFT JOIN attendance a ON e.id = a.event_id
-		WHERE e.date >= $1 AND e.date <= $2 AND e.status = 'published'
+		WHERE e.starts_at >= $1 AND e.starts_at < $2 AND e.status = 'published'
+		  AND e.recurrence_rule IS NULL
 		GROUP BY e.id, t.name
-		ORDER BY e.date, e.start_time`
+		ORDER BY e.starts_at`
 
 	err := r.db.Select(&events, query, start, end)
 	return events, err
@@ -83,14 +106,16 @@ func (r *EventRepository) Update(event *models.Event) error {
 	query := `
 		UPDATE events
 		SET title = $1, description = $2, date = $3, start_time = $4, end_time = $5,
-		    location = $6, capacity = $7, status = $8, type = $9, team_id = $10, updated_at = $11
-		WHERE id = $12`
+		    location = $6, capacity = $7, status = $8, type = $9, team_id = $10, updated_at = $11,
+		    recurrence_rule = $12, time_zone = $13, starts_at = $14, ends_at = $15
+		WHERE id = $16`
 
 	event.UpdatedAt = time.Now()
 	_, err := r.db.Exec(
 		query,
 		event.Title, event.Description, event.Date, event.StartTime, event.EndTime,
-		event.Location, event.Capacity, event.Status, event.Type, event.TeamID, event.UpdatedAt, event.ID,
+		event.Location, event.Capacity, event.Status, event.Type, event.TeamID, event.UpdatedAt,
+		event.RecurrenceRule, event.TimeZone, event.StartsAt, event.EndsAt, event.ID,
 	)
 	return err
 }
@@ -103,7 +128,7 @@ func (r *EventRepository) Delete(id uuid.UUID) error {
 
 func (r *EventRepository) GetByCreatedBy(userID uuid.UUID) ([]models.Event, error) {
 	var events []models.Event
-	query := `SELECT * FROM events WHERE created_by = $1 ORDER BY date, start_time`
+	query := `SELECT * FROM events WHERE created_by = $1 ORDER BY starts_at`
 	err := r.db.Select(&events, query, userID)
 	return events, err
 }
@@ -115,10 +140,10 @@ func (r *EventRepository) GetPersonalByUserID(userID uuid.UUID) ([]models.EventW
 		       COALESCE(COUNT(ea.id), 0) as participant_count
 		FROM events e
 		LEFT JOIN teams t ON e.team_id = t.id
-		LEFT JOIN event_assignments ea ON e.id = ea.event_id
+		LEFT JOIN event_assignments ea ON e.id = ea.event_id AND ea.occurrence_date IS NULL
 		WHERE e.type = 'personal' AND e.created_by = $1
 		GROUP BY e.id, t.name
-		ORDER BY e.date, e.start_time`
+		ORDER BY e.starts_at`
 	err := r.db.Select(&events, query, userID)
 	return events, err
 }
@@ -129,19 +154,19 @@ func (r *EventRepository) GetTeamEventsByUserID(userID uuid.UUID) ([]models.Even
 		SELECT e.*, ea_user.status as assignment_status, t.name as team_name,
 		       COALESCE(COUNT(ea_all.id), 0) as participant_count
 		FROM events e
-		INNER JOIN event_assignments ea_user ON e.id = ea_user.event_id AND ea_user.user_id = $1
+		INNER JOIN event_assignments ea_user ON e.id = ea_user.event_id AND ea_user.user_id = $1 AND ea_user.occurrence_date IS NULL
 		LEFT JOIN teams t ON e.team_id = t.id
-		LEFT JOIN event_assignments ea_all ON e.id = ea_all.event_id
+		LEFT JOIN event_assignments ea_all ON e.id = ea_all.event_id AND ea_all.occurrence_date IS NULL
 		WHERE e.status = 'published'
 		GROUP BY e.id, ea_user.status, t.name
-		ORDER BY e.date, e.start_time`
+		ORDER BY e.starts_at`
 	err := r.db.Select(&events, query, userID)
 	return events, err
 }
 
 func (r *EventRepository) GetByTeamID(teamID uuid.UUID) ([]models.Event, error) {
 	var events []models.Event
-	query := `SELECT * FROM events WHERE team_id = $1 ORDER BY date, start_time`
+	query := `SELECT * FROM events WHERE team_id = $1 ORDER BY starts_at`
 	err := r.db.Select(&events, query, teamID)
 	return events, err
 }
@@ -151,16 +176,17 @@ func (r *EventRepository) GetCalendarByUserID(userID uuid.UUID, start, end time.
 	query := `
 		SELECT e.*, ea.status as assignment_status, t.name as team_name
 		FROM events e
-		LEFT JOIN event_assignments ea ON e.id = ea.event_id AND ea.user_id = $1
+		LEFT JOIN event_assignments ea ON e.id = ea.event_id AND ea.user_id = $1 AND ea.occurrence_date IS NULL
 		LEFT JOIN teams t ON e.team_id = t.id
-		WHERE e.date >= $2 AND e.date <= $3
+		WHERE e.starts_at >= $2 AND e.starts_at < $3
 		  AND e.status = 'published'
+		  AND e.recurrence_rule IS NULL
 		  AND (
 		    (e.type = 'personal' AND e.created_by = $1)
 		    OR (e.type = 'team' AND ea.user_id = $1)
 		    OR (ea.user_id = $1 AND ea.status = 'approved')
 		  )
-		ORDER BY e.date, e.start_time`
+		ORDER BY e.starts_at`
 	err := r.db.Select(&events, query, userID, start, end)
 	return events, err
 }
@@ -195,7 +221,7 @@ func (r *EventRepository) GetParticipants(eventID uuid.UUID) ([]models.EventPart
 		SELECT ea.user_id, u.name as user_name, u.email as user_email, ea.role
 		FROM event_assignments ea
 		INNER JOIN users u ON ea.user_id = u.id
-		WHERE ea.event_id = $1
+		WHERE ea.event_id = $1 AND ea.occurrence_date IS NULL
 		ORDER BY ea.role, u.name`
 	err := r.db.Select(&participants, query, eventID)
 	if err != nil {
@@ -206,7 +232,7 @@ func (r *EventRepository) GetParticipants(eventID uuid.UUID) ([]models.EventPart
 
 func (r *EventRepository) SetParticipants(eventID uuid.UUID, participants []models.ParticipantInput) error {
 	// Delete existing participants for this event
-	_, err := r.db.Exec(`DELETE FROM event_assignments WHERE event_id = $1`, eventID)
+	_, err := r.db.Exec(`DELETE FROM event_assignments WHERE event_id = $1 AND occurrence_date IS NULL`, eventID)
 	if err != nil {
 		return err
 	}
@@ -230,3 +256,253 @@ func (r *EventRepository) SetParticipants(eventID uuid.UUID, participants []mode
 
 	return nil
 }
+
+func (r *EventRepository) GetPublishedSeries(end time.Time) ([]models.EventWithAttendeeCount, error) {
+	var events []models.EventWithAttendeeCount
+	query := `
+		SELECT e.*, t.name as team_name, 0 as attendee_count
+		FROM events e
+		LEFT JOIN teams t ON e.team_id = t.id
+		WHERE e.recurrence_rule IS NOT NULL AND e.starts_at < $1 AND e.status = 'published'
+		ORDER BY e.starts_at`
+	err := r.db.Select(&events, query, end)
+	return events, err
+}
+
+func (r *EventRepository) GetSeriesCalendarByUserID(userID uuid.UUID, end time.Time) ([]models.EventWithAssignment, error) {
+	var events []models.EventWithAssignment
+	query := `
+		SELECT e.*, ea.status as assignment_status, t.name as team_name
+		FROM events e
+		LEFT JOIN event_assignments ea ON e.id = ea.event_id AND ea.user_id = $1 AND ea.occurrence_date IS NULL
+		LEFT JOIN teams t ON e.team_id = t.id
+		WHERE e.recurrence_rule IS NOT NULL AND e.starts_at < $2
+		  AND e.status = 'published'
+		  AND (
+		    (e.type = 'personal' AND e.created_by = $1)
+		    OR ea.user_id = $1
+		  )
+		ORDER BY e.starts_at`
+	err := r.db.Select(&events, query, userID, end)
+	return events, err
+}
+
+// GetBusyByUserIDs returns the published events booked by any of userIDs that
+// overlap [start, end), plus every recurring series they are booked on that
+// starts before end. Series still need to be expanded by the caller.
+func (r *EventRepository) GetBusyByUserIDs(userIDs []uuid.UUID, start, end time.Time) ([]models.BusyEvent, error) {
+	var events []models.BusyEvent
+	query := `
+		SELECT b.user_id as busy_user_id, b.occurrence_date as busy_occurrence_date, e.*
+		FROM events e
+		INNER JOIN (
+		    SELECT id as event_id, created_by as user_id, NULL::date as occurrence_date
+		    FROM events WHERE type = 'personal'
+		    UNION
+		    SELECT event_id, user_id, occurrence_date FROM event_assignments WHERE status = 'approved'
+		    UNION
+		    SELECT event_id, user_id, occurrence_date FROM attendance WHERE status = 'registered'
+		) b ON b.event_id = e.id
+		WHERE b.user_id = ANY($1)
+		  AND e.status = 'published'
+		  AND (
+		    (e.recurrence_rule IS NULL AND e.starts_at < $3 AND e.ends_at > $2)
+		    OR (e.recurrence_rule IS NOT NULL AND e.starts_at < $3)
+		  )
+		ORDER BY e.starts_at`
+	err := r.db.Select(&events, query, pq.Array(userIDs), start, end)
+	return events, err
+}
+
+func (r *EventRepository) GetOccurrenceAttendeeCounts(eventIDs []uuid.UUID, start, end time.Time) ([]models.OccurrenceCount, error) {
+	var counts []models.OccurrenceCount
+	query := `
+		SELECT event_id, occurrence_date, COUNT(*) as count
+		FROM attendance
+		WHERE event_id = ANY($1) AND status = 'registered'
+		  AND occurrence_date >= $2 AND occurrence_date <= $3
+		GROUP BY event_id, occurrence_date`
+	err := r.db.Select(&counts, query, pq.Array(eventIDs), start, end)
+	return counts, err
+}
+
+func (r *EventRepository) GetExceptions(eventIDs []uuid.UUID) ([]models.EventException, error) {
+	var exceptions []models.EventException
+	query := `SELECT * FROM event_exceptions WHERE event_id = ANY($1) ORDER BY original_date`
+	err := r.db.Select(&exceptions, query, pq.Array(eventIDs))
+	return exceptions, err
+}
+
+func (r *EventRepository) GetException(eventID uuid.UUID, originalDate time.Time) (*models.EventException, error) {
+	var exception models.EventException
+	query := `SELECT * FROM event_exceptions WHERE event_id = $1 AND original_date = $2`
+	err := r.db.Get(&exception, query, eventID, originalDate)
+	if err != nil {
+		return nil, err
+	}
+	return &exception, nil
+}
+
+func (r *EventRepository) UpsertException(exception *models.EventException) error {
+	query := `
+		INSERT INTO event_exceptions (id, event_id, original_date, cancelled, title, description, date, start_time, end_time, location, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (event_id, original_date) DO UPDATE
+		SET cancelled = EXCLUDED.cancelled, title = EXCLUDED.title, description = EXCLUDED.description,
+		    date = EXCLUDED.date, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time,
+		    location = EXCLUDED.location, updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at, updated_at`
+
+	return r.db.QueryRowx(
+		query,
+		exception.ID, exception.EventID, exception.OriginalDate, exception.Cancelled,
+		exception.Title, exception.Description, exception.Date, exception.StartTime, exception.EndTime,
+		exception.Location, exception.CreatedAt, exception.UpdatedAt,
+	).Scan(&exception.ID, &exception.CreatedAt, &exception.UpdatedAt)
+}
+
+// SplitSeries ends the original series before from and moves every occurrence
+// from that date onwards, with its exceptions, registrations and responses, to next.
+func (r *EventRepository) SplitSeries(original, next *models.Event, from time.Time) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	original.UpdatedAt = time.Now()
+	if _, err := tx.Exec(
+		`UPDATE events SET recurrence_rule = $1, updated_at = $2 WHERE id = $3`,
+		original.RecurrenceRule, original.UpdatedAt, original.ID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertEvent(tx, next); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	statements := []string{
+		`UPDATE event_exceptions SET event_id = $1 WHERE event_id = $2 AND original_date >= $3`,
+		`UPDATE attendance SET event_id = $1 WHERE event_id = $2 AND occurrence_date >= $3`,
+		`UPDATE event_assignments SET event_id = $1 WHERE event_id = $2 AND occurrence_date >= $3`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, next.ID, original.ID, from); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Series-wide participants and team assignments carry over to the new series
+	if _, err := tx.Exec(`
+		INSERT INTO event_assignments (id, event_id, user_id, status, role, assigned_at, responded_at)
+		SELECT uuid_generate_v4(), $1, user_id, status, role, assigned_at, responded_at
+		FROM event_assignments
+		WHERE event_id = $2 AND occurrence_date IS NULL`,
+		next.ID, original.ID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TruncateSeries ends the series before from and drops everything tracked for
+// the removed occurrences.
+func (r *EventRepository) TruncateSeries(event *models.Event, from time.Time) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	event.UpdatedAt = time.Now()
+	if _, err := tx.Exec(
+		`UPDATE events SET recurrence_rule = $1, updated_at = $2 WHERE id = $3`,
+		event.RecurrenceRule, event.UpdatedAt, event.ID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	statements := []string{
+		`DELETE FROM event_exceptions WHERE event_id = $1 AND original_date >= $2`,
+		`DELETE FROM attendance WHERE event_id = $1 AND occurrence_date >= $2`,
+		`DELETE FROM event_assignments WHERE event_id = $1 AND occurrence_date >= $2`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, event.ID, from); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *EventRepository) GetForExport(start, end time.Time) ([]models.Event, error) {
+	var events []models.Event
+	query := `
+		SELECT * FROM events
+		WHERE status IN ('published', 'cancelled')
+		  AND (
+		    (recurrence_rule IS NULL AND starts_at >= $1 AND starts_at < $2)
+		    OR (recurrence_rule IS NOT NULL AND starts_at < $2)
+		  )
+		ORDER BY starts_at`
+	err := r.db.Select(&events, query, start, end)
+	return events, err
+}
+
+func (r *EventRepository) GetExportByUserID(userID uuid.UUID, start, end time.Time) ([]models.Event, error) {
+	var events []models.Event
+	query := `
+		SELECT e.*
+		FROM events e
+		LEFT JOIN event_assignments ea ON e.id = ea.event_id AND ea.user_id = $1 AND ea.occurrence_date IS NULL
+		WHERE e.status IN ('published', 'cancelled')
+		  AND (
+		    (e.recurrence_rule IS NULL AND e.starts_at >= $2 AND e.starts_at < $3)
+		    OR (e.recurrence_rule IS NOT NULL AND e.starts_at < $3)
+		  )
+		  AND (
+		    (e.type = 'personal' AND e.created_by = $1)
+		    OR (e.type = 'team' AND ea.user_id = $1)
+		    OR (ea.user_id = $1 AND ea.status = 'approved')
+		  )
+		ORDER BY e.starts_at`
+	err := r.db.Select(&events, query, userID, start, end)
+	return events, err
+}
+
+func (r *EventRepository) ReplaceExceptions(eventID uuid.UUID, exceptions []models.EventException) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM event_exceptions WHERE event_id = $1`, eventID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `
+		INSERT INTO event_exceptions (id, event_id, original_date, cancelled, title, description, date, start_time, end_time, location, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (event_id, original_date) DO NOTHING`
+	for _, e := range exceptions {
+		_, err := tx.Exec(
+			query,
+			e.ID, eventID, e.OriginalDate, e.Cancelled, e.Title, e.Description, e.Date,
+			e.StartTime, e.EndTime, e.Location, e.CreatedAt, e.UpdatedAt,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type FeedRepository struct {
+	db *contextDB
+}
+
+func NewFeedRepository(db *sqlx.DB) *FeedRepository {
+	return &FeedRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *FeedRepository) With(ctx context.Context) *FeedRepository {
+	return &FeedRepository{db: r.db.with(ctx)}
+}
+
+func (r *FeedRepository) Create(feed *models.CalendarFeed) error {
+	query := `
+		INSERT INTO calendar_feeds (id, user_id, name, token_hash, scope, team_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowx(
+		query,
+		feed.ID, feed.UserID, feed.Name, feed.TokenHash, feed.Scope, feed.TeamID, feed.CreatedAt,
+	).Scan(&feed.ID, &feed.CreatedAt)
+}
+
+func (r *FeedRepository) GetByID(id uuid.UUID) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	query := `SELECT * FROM calendar_feeds WHERE id = $1`
+	err := r.db.Get(&feed, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (r *FeedRepository) GetActiveByTokenHash(tokenHash string) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	query := `SELECT * FROM calendar_feeds WHERE token_hash = $1 AND revoked_at IS NULL`
+	err := r.db.Get(&feed, query, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (r *FeedRepository) GetActiveByUserID(userID uuid.UUID) ([]models.CalendarFeed, error) {
+	var feeds []models.CalendarFeed
+	query := `
+		SELECT * FROM calendar_feeds
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`
+	err := r.db.Select(&feeds, query, userID)
+	return feeds, err
+}
+
+func (r *FeedRepository) UpdateName(id uuid.UUID, name string) error {
+	query := `UPDATE calendar_feeds SET name = $1 WHERE id = $2`
+	_, err := r.db.Exec(query, name, id)
+	return err
+}
+
+func (r *FeedRepository) Revoke(id uuid.UUID) error {
+	query := `UPDATE calendar_feeds SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), id)
+	return err
+}
+
+func (r *FeedRepository) TouchLastPolled(id uuid.UUID) error {
+	query := `UPDATE calendar_feeds SET last_polled_at = $1 WHERE id = $2`
+	_, err := r.db.Exec(query, time.Now(), id)
+	return err
+}
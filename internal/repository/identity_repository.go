@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type IdentityRepository struct {
+	db *contextDB
+}
+
+func NewIdentityRepository(db *sqlx.DB) *IdentityRepository {
+	return &IdentityRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *IdentityRepository) With(ctx context.Context) *IdentityRepository {
+	return &IdentityRepository{db: r.db.with(ctx)}
+}
+
+func (r *IdentityRepository) CreateLogin(login *models.OIDCLogin) error {
+	query := `
+		INSERT INTO oidc_logins (id, state_hash, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.Exec(query, login.ID, login.StateHash, login.Nonce, login.CodeVerifier, login.ExpiresAt, login.CreatedAt)
+	return err
+}
+
+// ConsumeLogin removes a pending sign-on so its state cannot be replayed;
+// sql.ErrNoRows means it is unknown or expired
+func (r *IdentityRepository) ConsumeLogin(stateHash string) (*models.OIDCLogin, error) {
+	// Clear out abandoned attempts on the way
+	if _, err := r.db.Exec(`DELETE FROM oidc_logins WHERE expires_at <= $1`, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var login models.OIDCLogin
+	query := `DELETE FROM oidc_logins WHERE state_hash = $1 AND expires_at > $2 RETURNING *`
+	err := r.db.Get(&login, query, stateHash, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (r *IdentityRepository) GetUserID(issuer, subject string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	query := `SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2`
+	err := r.db.Get(&userID, query, issuer, subject)
+	return userID, err
+}
+
+func (r *IdentityRepository) Link(userID uuid.UUID, issuer, subject string) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, issuer, subject, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.Exec(query, uuid.New(), userID, issuer, subject, time.Now())
+	return err
+}
+
+// Provision creates a user signing in through an identity provider for the
+// first time, together with the link to that provider
+func (r *IdentityRepository) Provision(user *models.User, issuer, subject string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowx(`
+		INSERT INTO users (id, email, password, name, role, time_zone, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at`,
+		user.ID, user.Email, user.Password, user.Name, user.Role, user.TimeZone, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_identities (id, user_id, issuer, subject, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		uuid.New(), user.ID, issuer, subject, time.Now(),
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LoginAttemptRepository is the Postgres lockout.Store, shared by replicas
+type LoginAttemptRepository struct {
+	db *contextDB
+	// Rows untouched for this long are dropped
+	retention time.Duration
+}
+
+func NewLoginAttemptRepository(db *sqlx.DB, retention time.Duration) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: newContextDB(db), retention: retention}
+}
+
+func (r *LoginAttemptRepository) Fail(key string, now time.Time, window time.Duration) (int, error) {
+	// Stale rows are cleaned up as failures come in
+	if _, err := r.db.Exec(
+		`DELETE FROM login_attempts WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $2)`,
+		now.Add(-r.retention), now,
+	); err != nil {
+		return 0, err
+	}
+
+	var failures int
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+		    failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+		    last_failure_at = $2
+		RETURNING failures`
+	err := r.db.Get(&failures, query, key, now, now.Add(-window))
+	return failures, err
+}
+
+func (r *LoginAttemptRepository) Lock(key string, until time.Time) error {
+	query := `UPDATE login_attempts SET locked_until = $1 WHERE key = $2`
+	_, err := r.db.Exec(query, until, key)
+	return err
+}
+
+func (r *LoginAttemptRepository) LockedUntil(key string) (time.Time, error) {
+	var until sql.NullTime
+	query := `SELECT locked_until FROM login_attempts WHERE key = $1`
+	err := r.db.Get(&until, query, key)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return until.Time, err
+}
+
+func (r *LoginAttemptRepository) Reset(key string) error {
+	query := `DELETE FROM login_attempts WHERE key = $1`
+	_, err := r.db.Exec(query, key)
+	return err
+}
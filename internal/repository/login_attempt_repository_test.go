@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"agenda-api/internal/lockout/lockouttest"
+	"testing"
+	"time"
+)
+
+func TestLoginAttemptRepository(t *testing.T) {
+	lockouttest.TestStore(t, NewLoginAttemptRepository(testDB(t), 24*time.Hour))
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxMFAAttempts is how many codes can be tried against one login challenge
+const maxMFAAttempts = 5
+
+type MFARepository struct {
+	db *contextDB
+}
+
+func NewMFARepository(db *sqlx.DB) *MFARepository {
+	return &MFARepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *MFARepository) With(ctx context.Context) *MFARepository {
+	return &MFARepository{db: r.db.with(ctx)}
+}
+
+// SetPendingSecret starts an enrolment; the secret is not used for logins
+// until EnableTOTP
+func (r *MFARepository) SetPendingSecret(userID uuid.UUID, secret string) error {
+	query := `
+		UPDATE users SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $2
+		WHERE id = $3`
+	_, err := r.db.Exec(query, secret, time.Now(), userID)
+	return err
+}
+
+// EnableTOTP completes an enrolment and replaces the user's recovery codes
+func (r *MFARepository) EnableTOTP(userID uuid.UUID, step int64, codeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE users SET totp_enabled_at = $1, totp_last_step = $2, updated_at = $1 WHERE id = $3`,
+		time.Now(), step, userID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *MFARepository) DisableTOTP(userID uuid.UUID) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $1
+		WHERE id = $2`,
+		time.Now(), userID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records a verified TOTP time step. It returns false when that step
+// or a later one was already used, i.e. the code is being replayed.
+func (r *MFARepository) UseStep(userID uuid.UUID, step int64) (bool, error) {
+	query := `
+		UPDATE users SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+	result, err := r.db.Exec(query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *MFARepository) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *contextTx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(query, uuid.New(), userID, hash, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode spends a recovery code; false means it is unknown or used
+func (r *MFARepository) UseRecoveryCode(userID uuid.UUID, codeHash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *MFARepository) CountRecoveryCodes(userID uuid.UUID) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.Get(&count, query, userID)
+	return count, err
+}
+
+func (r *MFARepository) CreateChallenge(challenge *models.MFAChallenge) error {
+	query := `
+		INSERT INTO mfa_challenges (id, user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowx(
+		query,
+		challenge.ID, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt, challenge.CreatedAt,
+	).Scan(&challenge.ID, &challenge.CreatedAt)
+}
+
+// AttemptChallenge counts an attempt against an open challenge and returns it;
+// sql.ErrNoRows means the challenge is unknown, expired, used or out of attempts
+func (r *MFARepository) AttemptChallenge(tokenHash string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	query := `
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2 AND attempts < $3
+		RETURNING *`
+	err := r.db.Get(&challenge, query, tokenHash, time.Now(), maxMFAAttempts)
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// CompleteChallenge closes a challenge; false means it was completed already
+func (r *MFARepository) CompleteChallenge(id uuid.UUID) (bool, error) {
+	query := `UPDATE mfa_challenges SET used_at = $1 WHERE id = $2 AND used_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
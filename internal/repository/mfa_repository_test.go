@@ -0,0 +1,39 @@
+package repository
+
+import "testing"
+
+func TestUseStepRefusesReplays(t *testing.T) {
+	db := testDB(t)
+	user := createTestUser(t, db)
+	repo := NewMFARepository(db)
+
+	if err := repo.SetPendingSecret(user.ID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.EnableTOTP(user.ID, 100, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		step int64
+		want bool
+	}{
+		{"the enrolment step", 100, false},
+		{"an earlier step", 99, false},
+		{"the next step", 101, true},
+		{"the same step again", 101, false},
+		{"a skipped step", 103, true},
+		{"a step within the skew window", 102, false},
+	}
+
+	for _, tt := range tests {
+		used, err := repo.UseStep(user.ID, tt.step)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if used != tt.want {
+			t.Errorf("%s: UseStep(%d) = %v, want %v", tt.name, tt.step, used, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"agenda-api/internal/database"
+	"agenda-api/internal/migrate"
+	"agenda-api/internal/models"
+	"agenda-api/migrations"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it.
+// Tests using it are skipped when the variable is not set.
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := database.NewPostgresDB(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runner, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createTestUser inserts a user that is deleted, with everything it owns,
+// when the test ends
+func createTestUser(t *testing.T, db *sqlx.DB) *models.User {
+	t.Helper()
+
+	now := time.Now()
+	user := &models.User{
+		ID:        uuid.New(),
+		Name:      "Test user",
+		Role:      models.RoleUser,
+		TimeZone:  "UTC",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	user.Email = user.ID.String() + "@example.com"
+	if err := NewUserRepository(db).Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() { NewUserRepository(db).Delete(user.ID) })
+	return user
+}
+
+// createTestEvent inserts a published event created by createdBy
+func createTestEvent(t *testing.T, db *sqlx.DB, createdBy uuid.UUID, capacity *int) *models.Event {
+	t.Helper()
+
+	now := time.Now()
+	date := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 7)
+	event := &models.Event{
+		ID:        uuid.New(),
+		Title:     "Test event",
+		Date:      date,
+		StartTime: "10:00",
+		EndTime:   "11:00",
+		Location:  "Room 1",
+		Capacity:  capacity,
+		Status:    models.EventStatusPublished,
+		Type:      models.EventTypePersonal,
+		CreatedBy: createdBy,
+		TimeZone:  "UTC",
+		StartsAt:  date.Add(10 * time.Hour),
+		EndsAt:    date.Add(11 * time.Hour),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := NewEventRepository(db).Create(event); err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	return event
+}
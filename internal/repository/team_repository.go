@@ -2,31 +2,58 @@ package repository
 
 import (
 	"agenda-api/internal/models"
+	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
+// ErrLastOwner is returned for a change that would leave a team without an owner
+var ErrLastOwner = errors.New("team needs at least one owner")
+
 type TeamRepository struct {
-	db *sqlx.DB
+	db *contextDB
 }
 
 func NewTeamRepository(db *sqlx.DB) *TeamRepository {
-	return &TeamRepository{db: db}
+	return &TeamRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *TeamRepository) With(ctx context.Context) *TeamRepository {
+	return &TeamRepository{db: r.db.with(ctx)}
 }
 
+// Create stores a team with its creator as owner
 func (r *TeamRepository) Create(team *models.Team) error {
-	query := `
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowx(`
 		INSERT INTO teams (id, name, description, created_by, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at`
-
-	return r.db.QueryRowx(
-		query,
+		RETURNING id, created_at, updated_at`,
 		team.ID, team.Name, team.Description, team.CreatedBy,
 		team.CreatedAt, team.UpdatedAt,
-	).Scan(&team.ID, &team.CreatedAt, &team.UpdatedAt)
+	).Scan(&team.ID, &team.CreatedAt, &team.UpdatedAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO team_members (id, team_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		uuid.New(), team.ID, team.CreatedBy, models.TeamRoleOwner, team.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *TeamRepository) GetByID(id uuid.UUID) (*models.Team, error) {
@@ -83,20 +110,36 @@ func (r *TeamRepository) Delete(id uuid.UUID) error {
 
 func (r *TeamRepository) AddMember(member *models.TeamMember) error {
 	query := `
-		INSERT INTO team_members (id, team_id, user_id, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO team_members (id, team_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at`
 
 	return r.db.QueryRowx(
 		query,
-		member.ID, member.TeamID, member.UserID, member.CreatedAt,
+		member.ID, member.TeamID, member.UserID, member.Role, member.CreatedAt,
 	).Scan(&member.ID, &member.CreatedAt)
 }
 
+// RemoveMember takes the user out of the team, or returns ErrLastOwner if
+// they are its only owner
 func (r *TeamRepository) RemoveMember(teamID, userID uuid.UUID) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := lockOwners(tx, teamID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	query := `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`
-	_, err := r.db.Exec(query, teamID, userID)
-	return err
+	if _, err := tx.Exec(query, teamID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *TeamRepository) GetMembers(teamID uuid.UUID) ([]models.TeamMemberWithUser, error) {
@@ -117,3 +160,51 @@ func (r *TeamRepository) IsMember(teamID, userID uuid.UUID) (bool, error) {
 	err := r.db.Get(&count, query, teamID, userID)
 	return count > 0, err
 }
+
+// GetMemberRole returns the user's role in the team; sql.ErrNoRows means
+// they are not a member
+func (r *TeamRepository) GetMemberRole(teamID, userID uuid.UUID) (models.TeamRole, error) {
+	var role models.TeamRole
+	query := `SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2`
+	err := r.db.Get(&role, query, teamID, userID)
+	return role, err
+}
+
+// UpdateMemberRole changes the user's role in the team, or returns
+// ErrLastOwner if that demotes its only owner
+func (r *TeamRepository) UpdateMemberRole(teamID, userID uuid.UUID, role models.TeamRole) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if role != models.TeamRoleOwner {
+		if err := lockOwners(tx, teamID, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	query := `UPDATE team_members SET role = $1 WHERE team_id = $2 AND user_id = $3`
+	if _, err := tx.Exec(query, role, teamID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockOwners locks the owner rows of the team until tx ends and returns
+// ErrLastOwner if userID is the only owner. Concurrent changes to owners
+// queue up behind the lock, so two owners cannot demote each other at once.
+func lockOwners(tx *contextTx, teamID, userID uuid.UUID) error {
+	var owners []uuid.UUID
+	query := `SELECT user_id FROM team_members WHERE team_id = $1 AND role = $2 FOR UPDATE`
+	if err := tx.Select(&owners, query, teamID, models.TeamRoleOwner); err != nil {
+		return err
+	}
+	if len(owners) == 1 && owners[0] == userID {
+		return ErrLastOwner
+	}
+	return nil
+}
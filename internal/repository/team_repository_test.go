@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// createTestTeam creates a team owned by owner, deleted when the test ends
+func createTestTeam(t *testing.T, db *sqlx.DB, owner *models.User) *models.Team {
+	t.Helper()
+
+	now := time.Now()
+	team := &models.Team{ID: uuid.New(), Name: "Team " + owner.ID.String(), CreatedBy: owner.ID, CreatedAt: now, UpdatedAt: now}
+	if err := NewTeamRepository(db).Create(team); err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	t.Cleanup(func() { NewTeamRepository(db).Delete(team.ID) })
+	return team
+}
+
+func addTestMember(t *testing.T, db *sqlx.DB, team *models.Team, user *models.User, role models.TeamRole) {
+	t.Helper()
+	if err := NewTeamRepository(db).AddMember(&models.TeamMember{
+		ID: uuid.New(), TeamID: team.ID, UserID: user.ID, Role: role, CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+}
+
+func TestLastOwnerIsKept(t *testing.T) {
+	db := testDB(t)
+	repo := NewTeamRepository(db)
+	owner := createTestUser(t, db)
+	member := createTestUser(t, db)
+	team := createTestTeam(t, db, owner)
+	addTestMember(t, db, team, member, models.TeamRoleMember)
+
+	if err := repo.UpdateMemberRole(team.ID, owner.ID, models.TeamRoleManager); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("demoting the last owner = %v, want ErrLastOwner", err)
+	}
+	if err := repo.RemoveMember(team.ID, owner.ID); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("removing the last owner = %v, want ErrLastOwner", err)
+	}
+	if err := repo.UpdateMemberRole(team.ID, owner.ID, models.TeamRoleOwner); err != nil {
+		t.Errorf("keeping the last owner an owner: %v", err)
+	}
+
+	if err := repo.UpdateMemberRole(team.ID, member.ID, models.TeamRoleOwner); err != nil {
+		t.Fatalf("promoting a member: %v", err)
+	}
+	if err := repo.RemoveMember(team.ID, owner.ID); err != nil {
+		t.Errorf("removing one of two owners: %v", err)
+	}
+	if err := repo.RemoveMember(team.ID, member.ID); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("removing the remaining owner = %v, want ErrLastOwner", err)
+	}
+}
+
+func TestOwnersCannotDemoteEachOtherAtOnce(t *testing.T) {
+	db := testDB(t)
+	first := createTestUser(t, db)
+	second := createTestUser(t, db)
+	team := createTestTeam(t, db, first)
+	addTestMember(t, db, team, second, models.TeamRoleOwner)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, user := range []*models.User{first, second} {
+		wg.Add(1)
+		go func(i int, userID uuid.UUID) {
+			defer wg.Done()
+			if i == 0 {
+				errs[i] = NewTeamRepository(db).UpdateMemberRole(team.ID, userID, models.TeamRoleMember)
+			} else {
+				errs[i] = NewTeamRepository(db).RemoveMember(team.ID, userID)
+			}
+		}(i, user.ID)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, ErrLastOwner):
+			failed++
+		case err != nil:
+			t.Fatal(err)
+		}
+	}
+	if failed != 1 {
+		t.Errorf("%d of 2 changes refused, want 1", failed)
+	}
+
+	var owners int
+	if err := db.Get(&owners, `SELECT COUNT(*) FROM team_members WHERE team_id = $1 AND role = 'owner'`, team.ID); err != nil {
+		t.Fatal(err)
+	}
+	if owners != 1 {
+		t.Errorf("team has %d owners, want 1", owners)
+	}
+}
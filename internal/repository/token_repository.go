@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type TokenRepository struct {
+	db *contextDB
+}
+
+func NewTokenRepository(db *sqlx.DB) *TokenRepository {
+	return &TokenRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *TokenRepository) With(ctx context.Context) *TokenRepository {
+	return &TokenRepository{db: r.db.with(ctx)}
+}
+
+func (r *TokenRepository) CreateRefreshToken(refreshToken *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowx(
+		query,
+		refreshToken.ID, refreshToken.UserID, refreshToken.FamilyID, refreshToken.TokenHash,
+		refreshToken.ExpiresAt, refreshToken.CreatedAt,
+	).Scan(&refreshToken.ID, &refreshToken.CreatedAt)
+}
+
+func (r *TokenRepository) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	query := `SELECT * FROM refresh_tokens WHERE token_hash = $1`
+	err := r.db.Get(&refreshToken, query, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+// RotateRefreshToken revokes a refresh token in favour of its successor. It
+// returns false, without storing the successor, when the token was already
+// used, so that two concurrent refreshes cannot both succeed.
+func (r *TokenRepository) RotateRefreshToken(current *models.RefreshToken, next *models.RefreshToken) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		next.ID, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt, next.CreatedAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE refresh_tokens SET revoked_at = $1, replaced_by = $2
+		WHERE id = $3 AND revoked_at IS NULL`,
+		time.Now(), next.ID, current.ID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *TokenRepository) RevokeFamily(familyID uuid.UUID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), familyID)
+	return err
+}
+
+// RevokeAccessToken blocks a single access token until it expires
+func (r *TokenRepository) RevokeAccessToken(jti, userID uuid.UUID, expiresAt time.Time) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Entries past their expiry no longer matter
+	if _, err := tx.Exec(`DELETE FROM revoked_tokens WHERE expires_at < $1`, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`,
+		jti, userID, expiresAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeAllForUser invalidates every access and refresh token issued to a user
+// so far. Access tokens carry iat in whole seconds, so the cut-off is kept in
+// seconds too and covers every token issued in the second of the revocation,
+// even one issued just after it; that client has to sign in again.
+func (r *TokenRepository) RevokeAllForUser(userID uuid.UUID) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(
+		`UPDATE users SET tokens_valid_after = $1 WHERE id = $2`,
+		now.Truncate(time.Second), userID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`,
+		now, userID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsRevoked reports whether an access token was revoked, either on its own or
+// by revoking every token of its user issued up to and including the second
+// of the revocation. Tokens of deactivated or deleted users count as revoked.
+func (r *TokenRepository) IsRevoked(jti, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	query := `
+		SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		    OR NOT EXISTS(
+		        SELECT 1 FROM users
+		        WHERE id = $2 AND deactivated_at IS NULL
+		          AND (tokens_valid_after IS NULL OR tokens_valid_after < $3)
+		    )`
+	err := r.db.Get(&revoked, query, jti, userID, issuedAt)
+	return revoked, err
+}
+
+// CreateUserToken stores an emailed token, invalidating earlier unused tokens
+// of the same purpose so only the latest email works
+func (r *TokenRepository) CreateUserToken(userToken *models.UserToken) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL`,
+		time.Now(), userToken.UserID, userToken.Purpose,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		userToken.ID, userToken.UserID, userToken.Purpose, userToken.TokenHash,
+		userToken.ExpiresAt, userToken.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns it;
+// sql.ErrNoRows means the token is invalid
+func (r *TokenRepository) ConsumeUserToken(tokenHash string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	var userToken models.UserToken
+	query := `
+		UPDATE user_tokens SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING *`
+	err := r.db.Get(&userToken, query, time.Now(), tokenHash, purpose)
+	if err != nil {
+		return nil, err
+	}
+	return &userToken, nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevokeAllForUserCoversItsSecond(t *testing.T) {
+	db := testDB(t)
+	user := createTestUser(t, db)
+	repo := NewTokenRepository(db)
+
+	isRevoked := func(issuedAt time.Time) bool {
+		t.Helper()
+		revoked, err := repo.IsRevoked(uuid.New(), user.ID, issuedAt)
+		if err != nil {
+			t.Fatalf("IsRevoked: %v", err)
+		}
+		return revoked
+	}
+
+	// Access tokens carry iat in whole seconds
+	issued := time.Now().Truncate(time.Second)
+	if isRevoked(issued) {
+		t.Fatal("token revoked before any revocation")
+	}
+
+	if err := repo.RevokeAllForUser(user.ID); err != nil {
+		t.Fatalf("RevokeAllForUser: %v", err)
+	}
+	var validAfter time.Time
+	if err := db.Get(&validAfter, `SELECT tokens_valid_after FROM users WHERE id = $1`, user.ID); err != nil {
+		t.Fatalf("read tokens_valid_after: %v", err)
+	}
+
+	if !isRevoked(issued) {
+		t.Error("token issued earlier in the second of the revocation is still valid")
+	}
+	if !isRevoked(validAfter) {
+		t.Error("token issued in the second of the revocation is still valid")
+	}
+	if isRevoked(validAfter.Add(time.Second)) {
+		t.Error("token issued after the revocation is revoked")
+	}
+}
@@ -2,28 +2,39 @@ package repository
 
 import (
 	"agenda-api/internal/models"
+	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// firstAdminLockKey serializes PromoteFirstAdmin across connections
+const firstAdminLockKey = 7_263_118_005
+
 type UserRepository struct {
-	db *sqlx.DB
+	db *contextDB
 }
 
 func NewUserRepository(db *sqlx.DB) *UserRepository {
-	return &UserRepository{db: db}
+	return &UserRepository{db: newContextDB(db)}
+}
+
+// With returns a copy of the repository whose queries run under ctx
+func (r *UserRepository) With(ctx context.Context) *UserRepository {
+	return &UserRepository{db: r.db.with(ctx)}
 }
 
 func (r *UserRepository) Create(user *models.User) error {
 	query := `
-		INSERT INTO users (id, email, password, name, role, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO users (id, email, password, name, role, time_zone, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at`
 
 	return r.db.QueryRowx(
 		query,
-		user.ID, user.Email, user.Password, user.Name, user.Role, user.CreatedAt, user.UpdatedAt,
+		user.ID, user.Email, user.Password, user.Name, user.Role, user.TimeZone, user.CreatedAt, user.UpdatedAt,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 }
 
@@ -37,6 +48,20 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 	return &user, nil
 }
 
+func (r *UserRepository) GetByIDs(ids []uuid.UUID) ([]models.User, error) {
+	var users []models.User
+	query := `SELECT * FROM users WHERE id = ANY($1)`
+	err := r.db.Select(&users, query, pq.Array(ids))
+	return users, err
+}
+
+func (r *UserRepository) UpdateProfile(user *models.User) error {
+	query := `UPDATE users SET name = $1, time_zone = $2, updated_at = $3 WHERE id = $4`
+	user.UpdatedAt = time.Now()
+	_, err := r.db.Exec(query, user.Name, user.TimeZone, user.UpdatedAt, user.ID)
+	return err
+}
+
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	var user models.User
 	query := `SELECT * FROM users WHERE email = $1`
@@ -61,6 +86,84 @@ func (r *UserRepository) GetAll() ([]models.User, error) {
 	return users, err
 }
 
+func (r *UserRepository) CountActiveByRole(role models.Role) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM users WHERE role = $1 AND deactivated_at IS NULL`
+	err := r.db.Get(&count, query, role)
+	return count, err
+}
+
+// PromoteFirstAdmin makes the user an admin if there is no active admin yet
+// and reports whether it did. The check and the update run under an advisory
+// lock, so concurrent calls promote at most one user.
+func (r *UserRepository) PromoteFirstAdmin(id uuid.UUID) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, firstAdminLockKey); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE users SET role = $1, updated_at = $2
+		WHERE id = $3 AND deactivated_at IS NULL
+		  AND NOT EXISTS(SELECT 1 FROM users WHERE role = $1 AND deactivated_at IS NULL)`,
+		models.RoleAdmin, time.Now(), id,
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	promoted, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return promoted > 0, tx.Commit()
+}
+
+func (r *UserRepository) UpdateRole(id uuid.UUID, role models.Role) error {
+	query := `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, role, time.Now(), id)
+	return err
+}
+
+// SetDeactivated deactivates a user, or reactivates them when at is nil
+func (r *UserRepository) SetDeactivated(id uuid.UUID, at *time.Time) error {
+	query := `UPDATE users SET deactivated_at = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, at, time.Now(), id)
+	return err
+}
+
+func (r *UserRepository) SetPasswordResetRequired(id uuid.UUID, required bool) error {
+	query := `UPDATE users SET password_reset_required = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, required, time.Now(), id)
+	return err
+}
+
+// UpdatePassword stores a new password hash and clears any forced reset
+func (r *UserRepository) UpdatePassword(id uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password = $1, password_reset_required = FALSE, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, passwordHash, time.Now(), id)
+	return err
+}
+
+func (r *UserRepository) MarkEmailVerified(id uuid.UUID) error {
+	query := `UPDATE users SET email_verified_at = $1, updated_at = $1 WHERE id = $2 AND email_verified_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), id)
+	return err
+}
+
+func (r *UserRepository) Delete(id uuid.UUID) error {
+	query := `DELETE FROM users WHERE id = $1`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
 func (r *UserRepository) GetByRole(role models.Role) ([]models.User, error) {
 	var users []models.User
 	query := `SELECT * FROM users WHERE role = $1 ORDER BY name`
@@ -72,7 +175,7 @@ func (r *UserRepository) Search(query string) ([]models.User, error) {
 	var users []models.User
 	searchQuery := `
 		SELECT * FROM users
-		WHERE name ILIKE $1 OR email ILIKE $1
+		WHERE (name ILIKE $1 OR email ILIKE $1) AND deactivated_at IS NULL
 		ORDER BY name
 		LIMIT 20`
 	searchPattern := "%" + query + "%"
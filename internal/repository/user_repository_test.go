@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"agenda-api/internal/models"
+	"sync"
+	"testing"
+)
+
+func TestPromoteFirstAdminPromotesOnlyOne(t *testing.T) {
+	db := testDB(t)
+
+	var admins int
+	if err := db.Get(&admins, `SELECT COUNT(*) FROM users WHERE role = 'admin' AND deactivated_at IS NULL`); err != nil {
+		t.Fatalf("count admins: %v", err)
+	}
+	if admins > 0 {
+		t.Skip("the test database already has an admin")
+	}
+
+	const candidates = 10
+	users := make([]*models.User, candidates)
+	for i := range users {
+		users[i] = createTestUser(t, db)
+	}
+
+	repo := NewUserRepository(db)
+
+	var wg sync.WaitGroup
+	results := make(chan bool, candidates)
+	for _, user := range users {
+		wg.Add(1)
+		go func(user *models.User) {
+			defer wg.Done()
+			promoted, err := repo.PromoteFirstAdmin(user.ID)
+			if err != nil {
+				t.Errorf("PromoteFirstAdmin: %v", err)
+			}
+			results <- promoted
+		}(user)
+	}
+	wg.Wait()
+	close(results)
+
+	promoted := 0
+	for ok := range results {
+		if ok {
+			promoted++
+		}
+	}
+	if promoted != 1 {
+		t.Errorf("promoted %d users, want 1", promoted)
+	}
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"agenda-api/internal/config"
+	"agenda-api/internal/lockout"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIPIgnoresUntrustedForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{"no trusted proxies", nil, "192.0.2.10"},
+		{"request from a trusted proxy", []string{"192.0.2.0/24"}, "203.0.113.7"},
+		{"request from another address", []string{"198.51.100.1"}, "192.0.2.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newEngine(&config.Config{GinMode: gin.TestMode, TrustedProxies: tt.proxies})
+			r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = "192.0.2.10:51000"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Real-IP", "203.0.113.8")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("ClientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpoofedForwardedForKeepsIPLockout(t *testing.T) {
+	const threshold = 3
+	guard := lockout.NewGuard(
+		lockout.NewMemoryStore(time.Hour),
+		lockout.Policy{},
+		lockout.Policy{Threshold: threshold, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	// Every attempt fails, like a login with a guessed password
+	r := newEngine(&config.Config{GinMode: gin.TestMode})
+	r.POST("/login", func(c *gin.Context) {
+		email := c.Query("email")
+		if wait, _ := guard.Check(email, c.ClientIP()); wait > 0 {
+			c.Status(http.StatusTooManyRequests)
+			return
+		}
+		guard.Fail(email, c.ClientIP())
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for i := 0; i <= threshold; i++ {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/login?email=user%d@example.com", i), nil)
+		req.RemoteAddr = "192.0.2.10:51000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		want := http.StatusUnauthorized
+		if i == threshold {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Errorf("attempt %d = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -3,16 +3,30 @@ package router
 import (
 	"agenda-api/internal/config"
 	"agenda-api/internal/handlers"
+	"agenda-api/internal/keyset"
+	"agenda-api/internal/lockout"
+	"agenda-api/internal/mailer"
+	"agenda-api/internal/metrics"
 	"agenda-api/internal/middleware"
+	"agenda-api/internal/models"
+	"agenda-api/internal/oidc"
+	"agenda-api/internal/policy"
 	"agenda-api/internal/repository"
+	"agenda-api/internal/tracing"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
-func Setup(db *sqlx.DB, cfg *config.Config) *gin.Engine {
-	gin.SetMode(cfg.GinMode)
-	r := gin.Default()
+func Setup(db *sqlx.DB, cfg *config.Config, mail mailer.Mailer, keys *keyset.Set, health *handlers.HealthHandler) *gin.Engine {
+	r := newEngine(cfg)
+
+	r.Use(tracing.Middleware(cfg.TracingServiceName)...)
+	r.Use(metrics.Middleware())
 
 	r.Use(middleware.CORS())
 
@@ -22,14 +36,79 @@ func Setup(db *sqlx.DB, cfg *config.Config) *gin.Engine {
 	attendanceRepo := repository.NewAttendanceRepository(db)
 	teamRepo := repository.NewTeamRepository(db)
 	assignmentRepo := repository.NewAssignmentRepository(db)
+	feedRepo := repository.NewFeedRepository(db)
+	availabilityRepo := repository.NewAvailabilityRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+
+	// Login lockout: 1 minute after the threshold, doubling up to an hour
+	var attemptStore lockout.Store = lockout.NewMemoryStore(24 * time.Hour)
+	if cfg.LoginAttemptStore == "postgres" {
+		attemptStore = repository.NewLoginAttemptRepository(db, 24*time.Hour)
+	}
+	loginGuard := lockout.NewGuard(
+		attemptStore,
+		lockout.Policy{Threshold: cfg.LoginMaxFailures, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+		lockout.Policy{Threshold: cfg.LoginIPMaxFailures, BaseLock: time.Minute, MaxLock: time.Hour, Window: time.Hour},
+		slog.Default(),
+	)
+
+	// Every permission check goes through the policy
+	authz := policy.New(teamRepo)
 
 	// Handlers
-	authHandler := handlers.NewAuthHandler(userRepo, cfg.JWTSecret, cfg.JWTExpirationHours)
-	eventHandler := handlers.NewEventHandler(eventRepo, teamRepo, assignmentRepo)
-	attendanceHandler := handlers.NewAttendanceHandler(attendanceRepo, eventRepo)
-	teamHandler := handlers.NewTeamHandler(teamRepo, userRepo)
-	assignmentHandler := handlers.NewAssignmentHandler(assignmentRepo, eventRepo)
-	userHandler := handlers.NewUserHandler(userRepo)
+	authHandler := handlers.NewAuthHandler(userRepo, tokenRepo, mfaRepo, loginGuard, mail, handlers.AuthConfig{
+		Keys:                keys,
+		AccessTokenTTL:      time.Duration(cfg.JWTExpirationMinutes) * time.Minute,
+		RefreshTokenTTL:     time.Duration(cfg.RefreshTokenExpirationHours) * time.Hour,
+		BootstrapAdminEmail: cfg.BootstrapAdminEmail,
+		AppURL:              cfg.AppURL,
+		RequireAdminMFA:     cfg.RequireAdminMFA,
+	})
+	mfaHandler := handlers.NewMFAHandler(userRepo, mfaRepo, cfg.MFAIssuer)
+	eventHandler := handlers.NewEventHandler(eventRepo, teamRepo, assignmentRepo, userRepo, availabilityRepo, attendanceRepo, authz, cfg.RequireVerifiedEmail)
+	attendanceHandler := handlers.NewAttendanceHandler(attendanceRepo, eventRepo, authz)
+	teamHandler := handlers.NewTeamHandler(teamRepo, userRepo, authz, cfg.RequireVerifiedEmail)
+	assignmentHandler := handlers.NewAssignmentHandler(assignmentRepo, eventRepo, authz)
+	userHandler := handlers.NewUserHandler(userRepo, tokenRepo, loginGuard)
+	icalHandler := handlers.NewICalHandler(eventRepo, assignmentRepo, userRepo, teamRepo)
+	feedHandler := handlers.NewFeedHandler(feedRepo, eventRepo, teamRepo, userRepo, authz, icalHandler)
+	scheduleHandler := handlers.NewScheduleHandler(eventRepo, userRepo, teamRepo, availabilityRepo, authz)
+	availabilityHandler := handlers.NewAvailabilityHandler(availabilityRepo, userRepo, authz)
+	apiTokenHandler := handlers.NewAPITokenHandler(apiTokenRepo, authz)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+
+	var oidcHandler *handlers.OIDCHandler
+	if cfg.OIDCIssuer != "" {
+		provider := oidc.New(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+			GroupsClaim:  cfg.OIDCGroupsClaim,
+		}, &http.Client{Timeout: 10 * time.Second})
+		oidcHandler = handlers.NewOIDCHandler(authHandler, userRepo, tokenRepo, identityRepo, provider, cfg.OIDCAdminGroup)
+	}
+
+	jwtAuth := middleware.JWTAuth(keys, tokenRepo)
+	// apiAuth also admits personal access tokens carrying the scope
+	apiAuth := func(scope models.APIScope) gin.HandlerFunc {
+		return middleware.TokenAuth(keys, tokenRepo, apiTokenRepo, scope, cfg.RequireAdminMFA)
+	}
+	eventsRead := apiAuth(models.ScopeEventsRead)
+	eventsWrite := apiAuth(models.ScopeEventsWrite)
+	teamsAdmin := apiAuth(models.ScopeTeamsAdmin)
+
+	// Public keys for services verifying our access tokens
+	r.GET("/.well-known/jwks.json", jwksHandler.Serve)
+
+	// Probes for load balancers and orchestrators
+	r.GET("/healthz", health.Live)
+	r.GET("/readyz", health.Ready)
+	r.GET("/metrics", metrics.Handler(cfg.MetricsToken))
 
 	api := r.Group("/api")
 	{
@@ -38,7 +117,26 @@ func Setup(db *sqlx.DB, cfg *config.Config) *gin.Engine {
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
-			auth.GET("/me", middleware.JWTAuth(cfg.JWTSecret), authHandler.Me)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", jwtAuth, authHandler.Logout)
+			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/verify-email/resend", jwtAuth, authHandler.ResendVerification)
+			auth.POST("/mfa/verify", authHandler.VerifyMFA)
+			auth.GET("/mfa", jwtAuth, mfaHandler.Status)
+			auth.POST("/mfa/totp/enroll", jwtAuth, mfaHandler.Enroll)
+			auth.POST("/mfa/totp/confirm", jwtAuth, mfaHandler.Confirm)
+			auth.POST("/mfa/totp/disable", jwtAuth, mfaHandler.Disable)
+			auth.POST("/mfa/recovery-codes", jwtAuth, mfaHandler.RegenerateRecoveryCodes)
+			auth.GET("/me", jwtAuth, authHandler.Me)
+			auth.PATCH("/me", jwtAuth, authHandler.UpdateMe)
+
+			// Single sign-on
+			if oidcHandler != nil {
+				auth.POST("/oidc/start", oidcHandler.Start)
+				auth.POST("/oidc/callback", oidcHandler.Callback)
+			}
 		}
 
 		// Events routes (public)
@@ -46,128 +144,226 @@ func Setup(db *sqlx.DB, cfg *config.Config) *gin.Engine {
 		{
 			events.GET("", eventHandler.GetAll)
 			events.GET("/calendar", eventHandler.GetCalendar)
+			events.GET("/calendar.ics", icalHandler.ExportCalendar)
 			events.GET("/:id", eventHandler.GetByID)
 
 			// Protected event routes
 			events.POST("",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsWrite,
 				eventHandler.Create,
 			)
 
+			events.POST("/import/preview",
+				eventsWrite,
+				eventHandler.PreviewImport,
+			)
+
+			events.POST("/import",
+				eventsWrite,
+				eventHandler.Import,
+			)
+
 			events.PATCH("/:id",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsWrite,
 				eventHandler.Update,
 			)
 
 			events.DELETE("/:id",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsWrite,
 				eventHandler.Delete,
 			)
 
 			// Attendance routes
 			events.POST("/:id/register",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsWrite,
 				attendanceHandler.Register,
 			)
 
 			events.DELETE("/:id/register",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsWrite,
 				attendanceHandler.Cancel,
 			)
 
 			events.GET("/:id/attendees",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsRead,
 				attendanceHandler.GetAttendees,
 			)
 
+			events.GET("/:id/waitlist",
+				eventsRead,
+				attendanceHandler.GetWaitlist,
+			)
+
 			// Assignment routes for events
 			events.GET("/:id/assignments",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsRead,
 				assignmentHandler.GetByEventID,
 			)
 
 			events.POST("/:id/assignments/respond",
-				middleware.JWTAuth(cfg.JWTSecret),
+				eventsWrite,
 				assignmentHandler.Respond,
 			)
 		}
 
+		// Scheduling routes
+		schedule := api.Group("/schedule")
+		{
+			schedule.GET("/free-busy",
+				eventsRead,
+				scheduleHandler.FreeBusy,
+			)
+
+			schedule.GET("/suggestions",
+				eventsRead,
+				scheduleHandler.SuggestSlots,
+			)
+		}
+
+		// Calendar feeds (authenticated by the secret token in the URL)
+		api.GET("/feeds/:token", feedHandler.Serve)
+
 		// Users routes
 		users := api.Group("/users")
 		{
 			users.GET("/search",
-				middleware.JWTAuth(cfg.JWTSecret),
+				jwtAuth,
 				userHandler.Search,
 			)
 
 			users.GET("",
-				middleware.JWTAuth(cfg.JWTSecret),
+				jwtAuth,
 				userHandler.GetAll,
 			)
 
 			users.GET("/:id",
-				middleware.JWTAuth(cfg.JWTSecret),
+				jwtAuth,
 				userHandler.GetByID,
 			)
 		}
 
-		// Teams routes (admin only for management)
+		// User management (admin only)
+		admin := api.Group("/admin")
+		admin.Use(jwtAuth, middleware.Authorize(authz, policy.ManageUsers, policy.Users))
+		{
+			admin.PATCH("/users/:id/role", userHandler.UpdateRole)
+			admin.POST("/users/:id/deactivate", userHandler.Deactivate)
+			admin.POST("/users/:id/reactivate", userHandler.Reactivate)
+			admin.POST("/users/:id/force-password-reset", userHandler.ForcePasswordReset)
+			admin.POST("/users/:id/unlock", userHandler.Unlock)
+			admin.DELETE("/users/:id", userHandler.Delete)
+		}
+
+		// Teams routes; access within a team follows the policy
+		viewTeam := middleware.AuthorizeTeam(authz, policy.View)
+
 		teams := api.Group("/teams")
 		{
 			teams.GET("",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
 				teamHandler.GetAll,
 			)
 
 			teams.POST("",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
 				teamHandler.Create,
 			)
 
 			teams.GET("/:id",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
+				viewTeam,
 				teamHandler.GetByID,
 			)
 
 			teams.PATCH("/:id",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
+				middleware.AuthorizeTeam(authz, policy.Update),
 				teamHandler.Update,
 			)
 
 			teams.DELETE("/:id",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
+				middleware.AuthorizeTeam(authz, policy.Delete),
 				teamHandler.Delete,
 			)
 
+			teams.GET("/:id/calendar.ics",
+				eventsRead,
+				viewTeam,
+				icalHandler.ExportTeamCalendar,
+			)
+
 			// Team members
 			teams.GET("/:id/members",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
+				viewTeam,
 				teamHandler.GetMembers,
 			)
 
 			teams.POST("/:id/members",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
+				middleware.AuthorizeTeam(authz, policy.ManageMembers),
 				teamHandler.AddMember,
 			)
 
+			teams.PATCH("/:id/members/:userId",
+				teamsAdmin,
+				middleware.AuthorizeTeam(authz, policy.ManageRoles),
+				teamHandler.UpdateMemberRole,
+			)
+
+			// Members may remove themselves; the handler checks removing others
 			teams.DELETE("/:id/members/:userId",
-				middleware.JWTAuth(cfg.JWTSecret),
+				teamsAdmin,
+				viewTeam,
 				teamHandler.RemoveMember,
 			)
 		}
 
 		// My routes (user's personal data)
 		my := api.Group("/my")
-		my.Use(middleware.JWTAuth(cfg.JWTSecret))
+		my.Use(jwtAuth)
 		{
-			my.GET("/calendar", eventHandler.GetMyCalendar)
-			my.GET("/events", eventHandler.GetMyEvents)
 			my.GET("/teams", teamHandler.GetMyTeams)
-			my.GET("/assignments", assignmentHandler.GetMyAssignments)
 			my.GET("/assignments/pending-count", assignmentHandler.GetPendingCount)
-			my.GET("/registrations", attendanceHandler.GetMyRegistrations)
+			my.GET("/feeds", feedHandler.GetMyFeeds)
+			my.POST("/feeds", feedHandler.Create)
+			my.PATCH("/feeds/:id", feedHandler.Update)
+			my.DELETE("/feeds/:id", feedHandler.Revoke)
+			my.GET("/working-hours", availabilityHandler.GetMyWorkingHours)
+			my.PUT("/working-hours", availabilityHandler.SetMyWorkingHours)
+			my.GET("/out-of-office", availabilityHandler.GetMyOutOfOffice)
+			my.POST("/out-of-office", availabilityHandler.CreateOutOfOffice)
+			my.DELETE("/out-of-office/:id", availabilityHandler.DeleteOutOfOffice)
+			my.GET("/api-tokens", apiTokenHandler.GetMyTokens)
+			my.POST("/api-tokens", apiTokenHandler.Create)
+			my.DELETE("/api-tokens/:id", apiTokenHandler.Revoke)
+		}
+
+		// My schedule, also readable with an events:read API token
+		mySchedule := api.Group("/my")
+		mySchedule.Use(eventsRead)
+		{
+			mySchedule.GET("/calendar", eventHandler.GetMyCalendar)
+			mySchedule.GET("/calendar.ics", icalHandler.ExportMyCalendar)
+			mySchedule.GET("/events", eventHandler.GetMyEvents)
+			mySchedule.GET("/assignments", assignmentHandler.GetMyAssignments)
+			mySchedule.GET("/registrations", attendanceHandler.GetMyRegistrations)
 		}
 	}
 
 	return r
 }
+
+// newEngine creates the engine every route is added to. The client IP, which
+// login lockouts are keyed on, is the connection's address unless it belongs
+// to a trusted proxy, so clients cannot pick their own with X-Forwarded-For.
+// Feed tokens are kept out of the access log.
+func newEngine(cfg *config.Config) *gin.Engine {
+	gin.SetMode(cfg.GinMode)
+	r := gin.New()
+	r.Use(middleware.Logger(gin.DefaultWriter), gin.Recovery())
+	// config.Load has validated the list, and an empty one cannot fail
+	_ = r.SetTrustedProxies(cfg.TrustedProxies)
+	return r
+}
@@ -0,0 +1,392 @@
+package router
+
+import (
+	"agenda-api/internal/config"
+	"agenda-api/internal/database"
+	"agenda-api/internal/handlers"
+	"agenda-api/internal/keyset"
+	"agenda-api/internal/mailer"
+	"agenda-api/internal/middleware"
+	"agenda-api/internal/migrate"
+	"agenda-api/internal/models"
+	"agenda-api/internal/repository"
+	"agenda-api/internal/token"
+	"agenda-api/migrations"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type routerTest struct {
+	t      *testing.T
+	db     *sqlx.DB
+	keys   *keyset.Set
+	router *gin.Engine
+}
+
+// newRouterTest serves the full API against the database in
+// TEST_DATABASE_URL; the test is skipped when the variable is not set
+func newRouterTest(t *testing.T) *routerTest {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := database.NewPostgresDB(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	runner, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	keys, err := keyset.New(keyset.Options{Algorithm: "HS256", Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("keyset.New: %v", err)
+	}
+
+	cfg := &config.Config{
+		GinMode:            gin.TestMode,
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 50,
+	}
+	r := Setup(db, cfg, mailer.NewLogMailer(io.Discard), keys, handlers.NewHealthHandler(db, runner))
+
+	return &routerTest{t: t, db: db, keys: keys, router: r}
+}
+
+// user creates an account, deleted with everything it owns after the test
+func (rt *routerTest) user(role models.Role) *models.User {
+	rt.t.Helper()
+
+	now := time.Now()
+	user := &models.User{
+		ID:        uuid.New(),
+		Name:      "Test user",
+		Role:      role,
+		TimeZone:  "UTC",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	user.Email = user.ID.String() + "@example.com"
+	if err := repository.NewUserRepository(rt.db).Create(user); err != nil {
+		rt.t.Fatalf("create user: %v", err)
+	}
+	rt.t.Cleanup(func() { rt.db.Exec(`DELETE FROM users WHERE id = $1`, user.ID) })
+	return user
+}
+
+// team creates a team owned by owner with the given plain members
+func (rt *routerTest) team(owner *models.User, members ...*models.User) *models.Team {
+	rt.t.Helper()
+
+	now := time.Now()
+	team := &models.Team{ID: uuid.New(), Name: "Team " + owner.ID.String(), CreatedBy: owner.ID, CreatedAt: now, UpdatedAt: now}
+	repo := repository.NewTeamRepository(rt.db)
+	if err := repo.Create(team); err != nil {
+		rt.t.Fatalf("create team: %v", err)
+	}
+	for _, member := range members {
+		if err := repo.AddMember(&models.TeamMember{
+			ID: uuid.New(), TeamID: team.ID, UserID: member.ID, Role: models.TeamRoleMember, CreatedAt: now,
+		}); err != nil {
+			rt.t.Fatalf("add member: %v", err)
+		}
+	}
+	return team
+}
+
+// event creates a published personal event of owner
+func (rt *routerTest) event(owner *models.User) *models.Event {
+	rt.t.Helper()
+
+	now := time.Now()
+	date := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 7)
+	event := &models.Event{
+		ID:        uuid.New(),
+		Title:     "Private event",
+		Date:      date,
+		StartTime: "10:00",
+		EndTime:   "11:00",
+		Location:  "Room 1",
+		Status:    models.EventStatusPublished,
+		Type:      models.EventTypePersonal,
+		CreatedBy: owner.ID,
+		TimeZone:  "UTC",
+		StartsAt:  date.Add(10 * time.Hour),
+		EndsAt:    date.Add(11 * time.Hour),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repository.NewEventRepository(rt.db).Create(event); err != nil {
+		rt.t.Fatalf("create event: %v", err)
+	}
+	return event
+}
+
+// do sends a request as user and returns the response
+func (rt *routerTest) do(user *models.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+	rt.t.Helper()
+
+	now := time.Now()
+	signed, err := rt.keys.Sign(&middleware.Claims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	})
+	if err != nil {
+		rt.t.Fatalf("sign token: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	rt.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	rt := newRouterTest(t)
+
+	owner := rt.user(models.RoleUser)
+	member := rt.user(models.RoleUser)
+	stranger := rt.user(models.RoleUser)
+	admin := rt.user(models.RoleAdmin)
+
+	team := rt.team(owner, member)
+	teamPath := "/api/teams/" + team.ID.String()
+	event := rt.event(owner)
+	eventPath := "/api/events/" + event.ID.String()
+
+	tests := []struct {
+		name   string
+		user   *models.User
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"member views team", member, http.MethodGet, teamPath, nil, http.StatusOK},
+		{"stranger views team", stranger, http.MethodGet, teamPath, nil, http.StatusNotFound},
+		{"stranger lists members", stranger, http.MethodGet, teamPath + "/members", nil, http.StatusNotFound},
+		{"stranger exports team calendar", stranger, http.MethodGet, teamPath + "/calendar.ics", nil, http.StatusNotFound},
+		{"member updates team", member, http.MethodPatch, teamPath, gin.H{"name": "Renamed"}, http.StatusForbidden},
+		{"member deletes team", member, http.MethodDelete, teamPath, nil, http.StatusForbidden},
+		{"member adds member", member, http.MethodPost, teamPath + "/members", gin.H{"userId": stranger.ID}, http.StatusForbidden},
+		{"member removes owner", member, http.MethodDelete, teamPath + "/members/" + owner.ID.String(), nil, http.StatusForbidden},
+		{"admin views team", admin, http.MethodGet, teamPath, nil, http.StatusOK},
+		{"stranger updates event", stranger, http.MethodPatch, eventPath, gin.H{"title": "Mine now"}, http.StatusForbidden},
+		{"stranger deletes event", stranger, http.MethodDelete, eventPath, nil, http.StatusForbidden},
+		{"stranger views attendees", stranger, http.MethodGet, eventPath + "/attendees", nil, http.StatusForbidden},
+		{"stranger views assignments", stranger, http.MethodGet, eventPath + "/assignments", nil, http.StatusForbidden},
+		{"owner views assignments", owner, http.MethodGet, eventPath + "/assignments", nil, http.StatusOK},
+		{"user deactivates user", member, http.MethodPost, "/api/admin/users/" + stranger.ID.String() + "/deactivate", nil, http.StatusForbidden},
+		{"user changes role", member, http.MethodPatch, "/api/admin/users/" + member.ID.String() + "/role", gin.H{"role": "admin"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := rt.do(tt.user, tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestTeamListIsScopedToMembers(t *testing.T) {
+	rt := newRouterTest(t)
+
+	owner := rt.user(models.RoleUser)
+	member := rt.user(models.RoleUser)
+	other := rt.user(models.RoleUser)
+	admin := rt.user(models.RoleAdmin)
+
+	team := rt.team(owner, member)
+	otherTeam := rt.team(other)
+
+	list := func(user *models.User) map[uuid.UUID]bool {
+		t.Helper()
+		w := rt.do(user, http.MethodGet, "/api/teams", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var teams []models.Team
+		if err := json.Unmarshal(w.Body.Bytes(), &teams); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		ids := make(map[uuid.UUID]bool, len(teams))
+		for _, team := range teams {
+			ids[team.ID] = true
+		}
+		return ids
+	}
+
+	if ids := list(member); !ids[team.ID] || ids[otherTeam.ID] {
+		t.Errorf("member sees %v, want only their team %s", ids, team.ID)
+	}
+	if ids := list(admin); !ids[team.ID] || !ids[otherTeam.ID] {
+		t.Errorf("admin sees %v, want every team", ids)
+	}
+}
+
+func TestUpdateRejectsTeamChanges(t *testing.T) {
+	rt := newRouterTest(t)
+
+	owner := rt.user(models.RoleUser)
+	team := rt.team(owner)
+	event := rt.event(owner)
+	rule := "FREQ=DAILY;COUNT=5"
+	event.RecurrenceRule = &rule
+	if err := repository.NewEventRepository(rt.db).Update(event); err != nil {
+		t.Fatalf("make recurring: %v", err)
+	}
+	eventPath := "/api/events/" + event.ID.String()
+	following := eventPath + "?scope=following&occurrence=" + event.Date.AddDate(0, 0, 2).Format("2006-01-02")
+
+	tests := []struct {
+		name string
+		path string
+		body interface{}
+		want int
+	}{
+		{"type for the series", eventPath, gin.H{"type": "team", "teamId": team.ID}, http.StatusBadRequest},
+		{"team for the series", eventPath, gin.H{"teamId": team.ID}, http.StatusBadRequest},
+		{"type for following", following, gin.H{"type": "team", "teamId": team.ID}, http.StatusBadRequest},
+		{"unchanged type", following, gin.H{"type": "personal", "title": "Renamed"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := rt.do(owner, http.MethodPatch, tt.path, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	stored, err := repository.NewEventRepository(rt.db).GetByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Type != models.EventTypePersonal || stored.TeamID != nil {
+		t.Errorf("series became %s in team %v", stored.Type, stored.TeamID)
+	}
+}
+
+// loginTest holds a user with a password and TOTP enabled
+type loginTest struct {
+	*routerTest
+	user *models.User
+}
+
+const (
+	testPassword     = "correct horse"
+	testRecoveryCode = "abcde-fghij"
+)
+
+func newLoginTest(t *testing.T) *loginTest {
+	t.Helper()
+	rt := newRouterTest(t)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := rt.user(models.RoleUser)
+	if _, err := rt.db.Exec(`UPDATE users SET password = $1 WHERE id = $2`, string(hash), user.ID); err != nil {
+		t.Fatal(err)
+	}
+	mfa := repository.NewMFARepository(rt.db)
+	if err := mfa.SetPendingSecret(user.ID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfa.EnableTOTP(user.ID, 0, []string{token.Hash("abcdefghij")}); err != nil {
+		t.Fatal(err)
+	}
+	return &loginTest{routerTest: rt, user: user}
+}
+
+func (lt *loginTest) login(password string) *httptest.ResponseRecorder {
+	return lt.do(lt.user, http.MethodPost, "/api/auth/login", gin.H{"email": lt.user.Email, "password": password})
+}
+
+// failUpToThreshold fails one login short of the lockout
+func (lt *loginTest) failUpToThreshold() {
+	lt.t.Helper()
+	for i := 1; i < 5; i++ {
+		if w := lt.login("wrong"); w.Code != http.StatusUnauthorized {
+			lt.t.Fatalf("failure %d = %d: %s", i, w.Code, w.Body)
+		}
+	}
+}
+
+// challenge logs in with the password and returns the MFA challenge
+func (lt *loginTest) challenge() string {
+	lt.t.Helper()
+	w := lt.login(testPassword)
+	var body struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK || body.Challenge == "" {
+		lt.t.Fatalf("password = %d: %s", w.Code, w.Body)
+	}
+	return body.Challenge
+}
+
+func TestPasswordAloneKeepsFailedLogins(t *testing.T) {
+	lt := newLoginTest(t)
+
+	lt.failUpToThreshold()
+	lt.challenge()
+	if w := lt.login("wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("fifth failure = %d", w.Code)
+	}
+	if w := lt.login(testPassword); w.Code != http.StatusTooManyRequests {
+		t.Errorf("login after the fifth failure = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestSecondFactorClearsFailedLogins(t *testing.T) {
+	lt := newLoginTest(t)
+
+	lt.failUpToThreshold()
+	challenge := lt.challenge()
+	w := lt.do(lt.user, http.MethodPost, "/api/auth/mfa/verify", gin.H{"challenge": challenge, "code": testRecoveryCode})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify = %d: %s", w.Code, w.Body)
+	}
+
+	lt.failUpToThreshold()
+	if w := lt.login(testPassword); w.Code != http.StatusOK {
+		t.Errorf("login after a verified second factor = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,113 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 appendix B seed "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit SHA-1 codes; 6-digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := Validate(rfcSecret, tt.code, at)
+		if !ok {
+			t.Errorf("code %s rejected at %d", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / period; step != want {
+			t.Errorf("code %s at %d has step %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	// 050471 belongs to the step starting at 1111111110
+	const start, step = 1111111110, 1111111110 / period
+	tests := []struct {
+		name string
+		unix int64
+		ok   bool
+	}{
+		{"two steps early", start - period - 1, false},
+		{"one step early", start - period, true},
+		{"own step", start + 15, true},
+		{"one step late", start + period, true},
+		{"end of the window", start + 2*period - 1, true},
+		{"two steps late", start + 2*period, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, "050471", time.Unix(tt.unix, 0))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			// The step is the code's, not the clock's, so replays are caught
+			if ok && got != step {
+				t.Errorf("step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	at := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"short code", rfcSecret, "28708"},
+		{"long code", rfcSecret, "2870820"},
+		{"wrong code", rfcSecret, "287083"},
+		{"invalid secret", "not base32!", "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(tt.secret, tt.code, at); ok {
+				t.Error("accepted")
+			}
+		})
+	}
+
+	if _, ok := Validate(strings.ToLower(rfcSecret), "287082", at); !ok {
+		t.Error("lowercase secret rejected")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes: %v", secret, len(key), err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("secrets repeat")
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Agenda", "ada@example.com", rfcSecret)
+	want := "otpauth://totp/Agenda:ada@example.com?algorithm=SHA1&digits=6&issuer=Agenda&period=30&secret=" + rfcSecret
+	if got != want {
+		t.Errorf("URI = %s\nwant  %s", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Middleware starts a server span for every request with otelgin, continuing
+// the caller's trace when it sends a traceparent header. The trace ID is
+// returned in the X-Trace-Id header and added to JSON error responses, so
+// that a reported error can be found in the tracing backend.
+func Middleware(service string) []gin.HandlerFunc {
+	return []gin.HandlerFunc{otelgin.Middleware(service, otelgin.WithPropagators(propagator)), traceID}
+}
+
+func traceID(c *gin.Context) {
+	id := TraceIDFromContext(c.Request.Context())
+	if id == "" {
+		c.Next()
+		return
+	}
+	c.Header("X-Trace-Id", id)
+	c.Writer = &traceIDWriter{ResponseWriter: c.Writer, traceID: id}
+	c.Next()
+}
+
+// traceIDWriter adds a traceId field to JSON error bodies. Gin writes a JSON
+// response in a single call, so only the first write is rewritten.
+type traceIDWriter struct {
+	gin.ResponseWriter
+	traceID string
+	written bool
+}
+
+func (w *traceIDWriter) Write(b []byte) (int, error) {
+	if w.written || w.Status() < http.StatusBadRequest || len(b) == 0 || b[0] != '{' ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.written = true
+		return w.ResponseWriter.Write(b)
+	}
+	w.written = true
+
+	field := `{"traceId":"` + w.traceID + `"`
+	if len(b) > 1 && b[1] != '}' {
+		field += ","
+	}
+	if _, err := w.ResponseWriter.WriteString(field); err != nil {
+		return 0, err
+	}
+	if _, err := w.ResponseWriter.Write(b[1:]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *traceIDWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	saved := otel.GetTracerProvider()
+	otel.SetTracerProvider(NewTracerProvider(recorder, 1, resource.Empty()))
+	t.Cleanup(func() { otel.SetTracerProvider(saved) })
+	return recorder
+}
+
+func newEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware("test")...)
+	r.GET("/feeds/:token/calendar.ics", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/fail", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	})
+	return r
+}
+
+func TestMiddlewareRecordsRouteNotPath(t *testing.T) {
+	recorder := record(t)
+
+	newEngine().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/feeds/s3cr3t/calendar.ics?x=1", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := withoutPath{spans[0]}
+	if !strings.Contains(span.Name(), "/feeds/:token/calendar.ics") {
+		t.Errorf("name = %q", span.Name())
+	}
+	route := ""
+	for _, attr := range span.Attributes() {
+		if strings.Contains(attr.Value.Emit(), "s3cr3t") {
+			t.Errorf("attribute %s = %q leaks the path", attr.Key, attr.Value.Emit())
+		}
+		if attr.Key == "http.route" {
+			route = attr.Value.AsString()
+		}
+	}
+	if route != "/feeds/:token/calendar.ics" {
+		t.Errorf("http.route = %q", route)
+	}
+}
+
+func TestMiddlewareReturnsTraceID(t *testing.T) {
+	recorder := record(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	newEngine().ServeHTTP(w, req)
+
+	const want = "4bf92f3577b34da6a3ce929d0e0e4736"
+	if got := w.Header().Get("X-Trace-Id"); got != want {
+		t.Errorf("X-Trace-Id = %q, want %q", got, want)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["traceId"] != want || body["error"] != "Not found" {
+		t.Errorf("body = %v", body)
+	}
+	if spans := recorder.Ended(); len(spans) != 1 || spans[0].Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span does not continue the caller's trace: %v", spans)
+	}
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// pathAttributes hold the request path, which can carry secrets like feed
+// tokens. The route template in http.route says which endpoint was hit.
+var pathAttributes = map[attribute.Key]bool{
+	"http.target": true,
+	"url.path":    true,
+	"url.full":    true,
+	"http.url":    true,
+}
+
+// routeOnly passes spans on without their path attributes, whichever
+// instrumentation recorded them
+type routeOnly struct {
+	next sdktrace.SpanProcessor
+}
+
+func (p routeOnly) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p routeOnly) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.next.OnEnd(withoutPath{s})
+}
+
+func (p routeOnly) Shutdown(ctx context.Context) error   { return p.next.Shutdown(ctx) }
+func (p routeOnly) ForceFlush(ctx context.Context) error { return p.next.ForceFlush(ctx) }
+
+type withoutPath struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s withoutPath) Attributes() []attribute.KeyValue {
+	attrs := s.ReadOnlySpan.Attributes()
+	kept := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		if !pathAttributes[attr.Key] {
+			kept = append(kept, attr)
+		}
+	}
+	return kept
+}
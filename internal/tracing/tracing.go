@@ -0,0 +1,83 @@
+// Package tracing sets up OpenTelemetry for the process: W3C trace context
+// propagation, sampling and export of spans over OTLP/HTTP to a collector.
+// Without an endpoint spans are not recorded, but trace IDs are still
+// assigned and propagated.
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator reads and writes traceparent, tracestate and baggage headers
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Options configure tracing for the process
+type Options struct {
+	// Base URL of an OTLP/HTTP collector, e.g. http://localhost:4318; empty
+	// disables exporting
+	Endpoint    string
+	ServiceName string
+	// Fraction of new traces to record; requests carrying a traceparent follow
+	// the caller's decision
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and propagator and returns a
+// function that flushes the spans still queued. It must be called before any
+// span is started.
+func Setup(opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", opts.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Endpoint == "" {
+		// IDs are still generated for X-Trace-Id and outgoing traceparents
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()), sdktrace.WithResource(res))
+		otel.SetTracerProvider(provider)
+		return provider.Shutdown, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(opts.Endpoint, "/")+"/v1/traces"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewTracerProvider(sdktrace.NewBatchSpanProcessor(exporter), opts.SampleRatio, res)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider samples ratio of new traces and hands finished spans to
+// processor with any request path removed
+func NewTracerProvider(processor sdktrace.SpanProcessor, ratio float64, res *resource.Resource) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithSpanProcessor(routeOnly{processor}),
+		sdktrace.WithResource(res),
+	)
+}
+
+// TraceIDFromContext returns the ID of the trace ctx belongs to, or "" outside a trace
+func TraceIDFromContext(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,55 @@
+-- +migrate Up
+
+-- 1. Recurring events store their RRULE on the series row
+ALTER TABLE events ADD COLUMN recurrence_rule TEXT;
+
+CREATE INDEX idx_events_recurrence ON events(date) WHERE recurrence_rule IS NOT NULL;
+
+-- 2. Per-occurrence overrides and cancellations, keyed by the original occurrence date
+CREATE TABLE event_exceptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    original_date DATE NOT NULL,
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    title VARCHAR(255),
+    description TEXT,
+    date DATE,
+    start_time TIME,
+    end_time TIME,
+    location VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(event_id, original_date)
+);
+
+CREATE INDEX idx_event_exceptions_event_id ON event_exceptions(event_id);
+
+-- 3. Track attendance per occurrence (NULL = single event)
+ALTER TABLE attendance ADD COLUMN occurrence_date DATE;
+ALTER TABLE attendance DROP CONSTRAINT IF EXISTS attendance_event_id_user_id_key;
+CREATE UNIQUE INDEX idx_attendance_event_user ON attendance(event_id, user_id) WHERE occurrence_date IS NULL;
+CREATE UNIQUE INDEX idx_attendance_event_user_occurrence ON attendance(event_id, user_id, occurrence_date) WHERE occurrence_date IS NOT NULL;
+
+-- 4. Track assignments per occurrence (NULL = whole event or series)
+ALTER TABLE event_assignments ADD COLUMN occurrence_date DATE;
+ALTER TABLE event_assignments DROP CONSTRAINT IF EXISTS event_assignments_event_id_user_id_key;
+CREATE UNIQUE INDEX idx_event_assignments_event_user ON event_assignments(event_id, user_id) WHERE occurrence_date IS NULL;
+CREATE UNIQUE INDEX idx_event_assignments_event_user_occurrence ON event_assignments(event_id, user_id, occurrence_date) WHERE occurrence_date IS NOT NULL;
+
+-- +migrate Down
+DELETE FROM event_assignments WHERE occurrence_date IS NOT NULL;
+DROP INDEX IF EXISTS idx_event_assignments_event_user_occurrence;
+DROP INDEX IF EXISTS idx_event_assignments_event_user;
+ALTER TABLE event_assignments DROP COLUMN IF EXISTS occurrence_date;
+ALTER TABLE event_assignments ADD CONSTRAINT event_assignments_event_id_user_id_key UNIQUE (event_id, user_id);
+
+DELETE FROM attendance WHERE occurrence_date IS NOT NULL;
+DROP INDEX IF EXISTS idx_attendance_event_user_occurrence;
+DROP INDEX IF EXISTS idx_attendance_event_user;
+ALTER TABLE attendance DROP COLUMN IF EXISTS occurrence_date;
+ALTER TABLE attendance ADD CONSTRAINT attendance_event_id_user_id_key UNIQUE (event_id, user_id);
+
+DROP TABLE IF EXISTS event_exceptions;
+
+DROP INDEX IF EXISTS idx_events_recurrence;
+ALTER TABLE events DROP COLUMN IF EXISTS recurrence_rule;
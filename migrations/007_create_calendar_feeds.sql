@@ -0,0 +1,20 @@
+-- +migrate Up
+CREATE TYPE feed_scope AS ENUM ('my', 'team', 'public');
+
+CREATE TABLE calendar_feeds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scope feed_scope NOT NULL DEFAULT 'my',
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+    last_polled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_calendar_feeds_user_id ON calendar_feeds(user_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS calendar_feeds;
+DROP TYPE IF EXISTS feed_scope;
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- UID of the VEVENT an event was imported from, so re-imports update instead of duplicating
+ALTER TABLE events ADD COLUMN ical_uid VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_events_created_by_ical_uid ON events(created_by, ical_uid) WHERE ical_uid IS NOT NULL;
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_events_created_by_ical_uid;
+ALTER TABLE events DROP COLUMN IF EXISTS ical_uid;
@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- 1. Preferred zone for users
+ALTER TABLE users ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- 2. Events keep their wall-clock date and times in an IANA zone, plus the
+--    instants they resolve to. Existing events are assumed to be in UTC.
+ALTER TABLE events ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE events ADD COLUMN starts_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE events ADD COLUMN ends_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE events
+SET starts_at = (date + start_time) AT TIME ZONE time_zone,
+    ends_at = (date + end_time + CASE WHEN end_time < start_time THEN INTERVAL '1 day' ELSE INTERVAL '0' END) AT TIME ZONE time_zone;
+
+ALTER TABLE events ALTER COLUMN starts_at SET NOT NULL;
+ALTER TABLE events ALTER COLUMN ends_at SET NOT NULL;
+
+CREATE INDEX idx_events_starts_at ON events(starts_at);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_events_starts_at;
+ALTER TABLE events DROP COLUMN IF EXISTS ends_at;
+ALTER TABLE events DROP COLUMN IF EXISTS starts_at;
+ALTER TABLE events DROP COLUMN IF EXISTS time_zone;
+ALTER TABLE users DROP COLUMN IF EXISTS time_zone;
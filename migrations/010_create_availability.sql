@@ -0,0 +1,35 @@
+-- +migrate Up
+
+-- Weekly working hours, one range per weekday (0 = Sunday)
+CREATE TABLE working_hours (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    PRIMARY KEY (user_id, weekday),
+    CHECK (end_time > start_time)
+);
+
+CREATE TYPE out_of_office_kind AS ENUM ('vacation', 'sick_leave', 'other');
+
+CREATE TABLE out_of_office (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind out_of_office_kind NOT NULL DEFAULT 'vacation',
+    note TEXT,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_out_of_office_user_id ON out_of_office(user_id, starts_at);
+
+-- Why an assignment was answered automatically
+ALTER TABLE event_assignments ADD COLUMN reason VARCHAR(255);
+
+-- +migrate Down
+ALTER TABLE event_assignments DROP COLUMN IF EXISTS reason;
+DROP TABLE IF EXISTS out_of_office;
+DROP TYPE IF EXISTS out_of_office_kind;
+DROP TABLE IF EXISTS working_hours;
@@ -0,0 +1,13 @@
+-- +migrate Up
+ALTER TYPE attendance_status ADD VALUE IF NOT EXISTS 'waitlisted';
+
+-- Order of the waitlist; reset whenever someone rejoins it
+ALTER TABLE attendance ADD COLUMN waitlisted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_attendance_waitlist ON attendance(event_id, occurrence_date, waitlisted_at) WHERE waitlisted_at IS NOT NULL;
+
+-- +migrate Down
+-- Enum values cannot be dropped; waitlisted rows are cancelled instead
+DROP INDEX IF EXISTS idx_attendance_waitlist;
+UPDATE attendance SET status = 'cancelled' WHERE status = 'waitlisted';
+ALTER TABLE attendance DROP COLUMN IF EXISTS waitlisted_at;
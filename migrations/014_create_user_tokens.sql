@@ -0,0 +1,22 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TYPE user_token_purpose AS ENUM ('password_reset', 'email_verification');
+
+-- Single-use tokens sent by email; only their hashes are stored
+CREATE TABLE user_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose user_token_purpose NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_tokens_user_id ON user_tokens(user_id, purpose);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_tokens;
+DROP TYPE IF EXISTS user_token_purpose;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,13 @@
+-- +migrate Up
+-- Failed login counters shared by all API instances (LOGIN_ATTEMPT_STORE=postgres)
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_login_attempts_last_failure_at ON login_attempts(last_failure_at);
+
+-- +migrate Down
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TYPE team_role AS ENUM ('owner', 'manager', 'member');
+
+ALTER TABLE team_members ADD COLUMN role team_role NOT NULL DEFAULT 'member';
+
+-- Team creators own their teams
+INSERT INTO team_members (team_id, user_id, role)
+SELECT id, created_by, 'owner' FROM teams
+ON CONFLICT (team_id, user_id) DO UPDATE SET role = 'owner';
+
+-- +migrate Down
+ALTER TABLE team_members DROP COLUMN IF EXISTS role;
+DROP TYPE IF EXISTS team_role;